@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/middleware"
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/models"
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/store"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	defaultAccessTokenLifetimeDays = 30
+	maxAccessTokenLifetimeDays     = 365
+	maxAccessTokenNameLength       = 64
+)
+
+// AccessTokenHandler manages personal access tokens.
+// Its routes are not listed in the access token route scopes, so tokens can only be
+// created, listed and revoked from a browser session.
+type AccessTokenHandler struct {
+	accessTokenStore *store.AccessTokenStore
+}
+
+// NewAccessTokenHandler creates a new AccessTokenHandler
+func NewAccessTokenHandler(accessTokenStore *store.AccessTokenStore) *AccessTokenHandler {
+	return &AccessTokenHandler{
+		accessTokenStore: accessTokenStore,
+	}
+}
+
+// CreateAccessTokenRequest names a new token and selects its scopes.
+// ExpiresInDays defaults to 30 and may not exceed 365.
+type CreateAccessTokenRequest struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expires_in_days,omitempty"`
+}
+
+// CreateAccessTokenResponse returns the raw token, which is shown only once
+type CreateAccessTokenResponse struct {
+	*models.AccessToken
+	Token string `json:"token"`
+}
+
+// CreateAccessToken issues a personal access token for the authenticated user
+func (h *AccessTokenHandler) CreateAccessToken(c echo.Context) error {
+	userID, ok := c.Get(middleware.UserIDContextKey).(uuid.UUID)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid session")
+	}
+
+	var req CreateAccessTokenRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request")
+	}
+
+	if req.Name == "" || len(req.Name) > maxAccessTokenNameLength {
+		return echo.NewHTTPError(http.StatusBadRequest, "name must be between 1 and 64 characters")
+	}
+
+	if len(req.Scopes) == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "at least one scope is required")
+	}
+
+	scopes := make([]string, 0, len(req.Scopes))
+	for _, scope := range req.Scopes {
+		if !slices.Contains(models.AccessTokenScopes, scope) {
+			return echo.NewHTTPError(http.StatusBadRequest, "unknown scope "+scope)
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	days := req.ExpiresInDays
+	if days == 0 {
+		days = defaultAccessTokenLifetimeDays
+	}
+	if days < 0 || days > maxAccessTokenLifetimeDays {
+		return echo.NewHTTPError(http.StatusBadRequest, "expires_in_days must be between 1 and 365")
+	}
+
+	accessToken, token := h.accessTokenStore.Create(userID, req.Name, scopes, time.Duration(days)*24*time.Hour)
+
+	return c.JSON(http.StatusCreated, CreateAccessTokenResponse{
+		AccessToken: accessToken,
+		Token:       token,
+	})
+}
+
+// ListAccessTokens returns the authenticated user's unexpired tokens, newest first
+func (h *AccessTokenHandler) ListAccessTokens(c echo.Context) error {
+	userID, ok := c.Get(middleware.UserIDContextKey).(uuid.UUID)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid session")
+	}
+
+	tokens := h.accessTokenStore.FindByUserID(userID)
+	slices.SortFunc(tokens, func(a, b *models.AccessToken) int {
+		return b.CreatedAt.Compare(a.CreatedAt)
+	})
+
+	return c.JSON(http.StatusOK, tokens)
+}
+
+// RevokeAccessToken deletes one of the authenticated user's tokens
+func (h *AccessTokenHandler) RevokeAccessToken(c echo.Context) error {
+	userID, ok := c.Get(middleware.UserIDContextKey).(uuid.UUID)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid session")
+	}
+
+	tokenID, err := uuid.Parse(c.Param("tokenID"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid token id")
+	}
+
+	if err := h.accessTokenStore.Revoke(userID, tokenID); err != nil {
+		if errors.Is(err, store.ErrAccessTokenNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "access token not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to revoke access token")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
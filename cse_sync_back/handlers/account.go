@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/middleware"
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/store"
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/username"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+const maxAccountDeletionGraceDays = int(store.AccountDeletionMaxGrace / (24 * time.Hour))
+
+// AccountHandler handles renaming and deletion of the session user's account
+type AccountHandler struct {
+	userStore            *store.UserStore
+	accountDeletionStore *store.AccountDeletionStore
+	usernamePolicy       username.Policy
+}
+
+// NewAccountHandler creates a new AccountHandler
+func NewAccountHandler(userStore *store.UserStore, accountDeletionStore *store.AccountDeletionStore, usernamePolicy username.Policy) *AccountHandler {
+	return &AccountHandler{
+		userStore:            userStore,
+		accountDeletionStore: accountDeletionStore,
+		usernamePolicy:       usernamePolicy,
+	}
+}
+
+// ChangeUsernameRequest carries the new username
+type ChangeUsernameRequest struct {
+	Username string `json:"username"`
+}
+
+// ChangeUsernameResponse reports the stored form of the new username
+type ChangeUsernameResponse struct {
+	UserID            uuid.UUID `json:"user_id"`
+	Username          string    `json:"username"`
+	UsernameChangedAt time.Time `json:"username_changed_at"`
+}
+
+// ChangeUsername renames the session user. The old name stays reserved for the
+// user during store.UsernameCooldown so nobody else can take it over right away.
+func (h *AccountHandler) ChangeUsername(c echo.Context) error {
+	userID, ok := c.Get(middleware.UserIDContextKey).(uuid.UUID)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid session")
+	}
+
+	var req ChangeUsernameRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request")
+	}
+
+	name, err := h.usernamePolicy.Normalize(req.Username)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	user, err := h.userStore.Rename(userID, name)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrUsernameTaken):
+			return echo.NewHTTPError(http.StatusConflict, "username is not available")
+		case errors.Is(err, store.ErrUsernameChangeTooSoon):
+			return echo.NewHTTPError(http.StatusTooManyRequests, "username was changed too recently")
+		}
+		return echo.NewHTTPError(http.StatusNotFound, "user not found")
+	}
+
+	response := ChangeUsernameResponse{
+		UserID:   user.ID,
+		Username: user.Username,
+	}
+	if user.UsernameChangedAt != nil {
+		response.UsernameChangedAt = *user.UsernameChangedAt
+	}
+
+	return c.JSON(http.StatusOK, response)
+}
+
+// DeleteAccountRequest optionally delays the purge by GraceDays (at most 30), during
+// which the deletion can be canceled. Without it the account is purged at once.
+type DeleteAccountRequest struct {
+	GraceDays int `json:"grace_days,omitempty"`
+}
+
+// DeleteAccount deletes the session user's account with everything stored for it
+// and returns the deletion receipt. The route requires a recent step-up.
+func (h *AccountHandler) DeleteAccount(c echo.Context) error {
+	userID, ok := c.Get(middleware.UserIDContextKey).(uuid.UUID)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid session")
+	}
+
+	var req DeleteAccountRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request")
+	}
+
+	if req.GraceDays < 0 || req.GraceDays > maxAccountDeletionGraceDays {
+		return echo.NewHTTPError(http.StatusBadRequest, "grace_days must be between 0 and 30")
+	}
+
+	user, exists := h.userStore.FindByID(userID)
+	if !exists {
+		return echo.NewHTTPError(http.StatusNotFound, "user not found")
+	}
+
+	deletion, err := h.accountDeletionStore.Request(user, time.Duration(req.GraceDays)*24*time.Hour)
+	if err != nil {
+		if errors.Is(err, store.ErrAccountDeletionScheduled) {
+			return echo.NewHTTPError(http.StatusConflict, "account deletion already scheduled")
+		}
+		return echo.NewHTTPError(http.StatusNotFound, "user not found")
+	}
+
+	if req.GraceDays > 0 {
+		return c.JSON(http.StatusAccepted, deletion)
+	}
+
+	middleware.ClearSessionCookie(c)
+	return c.JSON(http.StatusOK, deletion)
+}
+
+// GetAccountDeletion returns the session user's scheduled deletion or the receipt of
+// their last finished one, which is only ever a failed one while they can sign in
+func (h *AccountHandler) GetAccountDeletion(c echo.Context) error {
+	userID, ok := c.Get(middleware.UserIDContextKey).(uuid.UUID)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid session")
+	}
+
+	deletion, exists := h.accountDeletionStore.Find(userID)
+	if !exists {
+		return echo.NewHTTPError(http.StatusNotFound, "no account deletion found")
+	}
+
+	return c.JSON(http.StatusOK, deletion)
+}
+
+// CancelAccountDeletion undoes the session user's scheduled deletion during its grace period
+func (h *AccountHandler) CancelAccountDeletion(c echo.Context) error {
+	userID, ok := c.Get(middleware.UserIDContextKey).(uuid.UUID)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid session")
+	}
+
+	deletion, err := h.accountDeletionStore.Cancel(userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "no account deletion scheduled")
+	}
+
+	return c.JSON(http.StatusOK, deletion)
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/models"
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/store"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	defaultInviteMaxUses       = 1
+	maxInviteMaxUses           = 1000
+	defaultInviteLifetimeHours = 7 * 24
+	maxInviteLifetimeHours     = 30 * 24
+	maxInviteNoteLength        = 128
+)
+
+// AdminHandler serves the operator API behind middleware.AdminMiddleware
+type AdminHandler struct {
+	inviteStore *store.InviteStore
+}
+
+// NewAdminHandler creates a new AdminHandler
+func NewAdminHandler(inviteStore *store.InviteStore) *AdminHandler {
+	return &AdminHandler{
+		inviteStore: inviteStore,
+	}
+}
+
+// CreateInviteRequest describes a new invite. MaxUses defaults to 1 and may not
+// exceed 1000; ExpiresInHours defaults to a week and may not exceed 30 days.
+type CreateInviteRequest struct {
+	Note           string `json:"note,omitempty"`
+	MaxUses        int    `json:"max_uses,omitempty"`
+	ExpiresInHours int    `json:"expires_in_hours,omitempty"`
+}
+
+// CreateInviteResponse returns the raw invite token, which is shown only once
+type CreateInviteResponse struct {
+	*models.Invite
+	Token string `json:"token"`
+}
+
+// CreateInvite issues an invite token for invite-only registration
+func (h *AdminHandler) CreateInvite(c echo.Context) error {
+	var req CreateInviteRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request")
+	}
+
+	if len(req.Note) > maxInviteNoteLength {
+		return echo.NewHTTPError(http.StatusBadRequest, "note must be at most 128 characters")
+	}
+
+	maxUses := req.MaxUses
+	if maxUses == 0 {
+		maxUses = defaultInviteMaxUses
+	}
+	if maxUses < 0 || maxUses > maxInviteMaxUses {
+		return echo.NewHTTPError(http.StatusBadRequest, "max_uses must be between 1 and 1000")
+	}
+
+	hours := req.ExpiresInHours
+	if hours == 0 {
+		hours = defaultInviteLifetimeHours
+	}
+	if hours < 0 || hours > maxInviteLifetimeHours {
+		return echo.NewHTTPError(http.StatusBadRequest, "expires_in_hours must be between 1 and 720")
+	}
+
+	invite, token := h.inviteStore.Create(req.Note, maxUses, time.Duration(hours)*time.Hour)
+
+	return c.JSON(http.StatusCreated, CreateInviteResponse{
+		Invite: invite,
+		Token:  token,
+	})
+}
+
+// ListInvites lists the invites, newest first
+func (h *AdminHandler) ListInvites(c echo.Context) error {
+	return c.JSON(http.StatusOK, h.inviteStore.List())
+}
+
+// RevokeInvite stops an invite from admitting further sign-ups
+func (h *AdminHandler) RevokeInvite(c echo.Context) error {
+	inviteID, err := uuid.Parse(c.Param("inviteID"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid invite id")
+	}
+
+	invite, err := h.inviteStore.Revoke(inviteID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "invite not found")
+	}
+
+	return c.JSON(http.StatusOK, invite)
+}
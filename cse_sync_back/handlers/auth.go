@@ -1,61 +1,145 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"time"
 
 	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/middleware"
 	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/models"
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/oidc"
 	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/store"
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/username"
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/webauthn"
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 )
 
-// AuthHandler handles authentication endpoints
+// AuthHandler handles authentication endpoints.
+// oidcProvider is nil unless single sign-on was enabled with EnableOIDC.
 type AuthHandler struct {
-	userStore    *store.UserStore
-	sessionStore *store.SessionStore
-	deviceStore  *store.DeviceStore
+	userStore         *store.UserStore
+	sessionStore      *store.SessionStore
+	registrationStore *store.RegistrationStore
+	deviceStore       *store.DeviceStore
+	credentialStore   *store.CredentialStore
+	recoveryCodeStore *store.RecoveryCodeStore
+	relyingParty      *webauthn.RelyingParty
+	totpStore         *store.TOTPStore
+	lockoutStore      *store.LockoutStore
+	challengeStore    *store.ChallengeStore
+	decoys            *DecoyGenerator
+	usernamePolicy    username.Policy
+	registrationMode  string
+	inviteStore       *store.InviteStore
+	oidcProvider      *oidc.Provider
+	oidcLoginStore    *store.OIDCLoginStore
 }
 
 // NewAuthHandler creates a new AuthHandler
-func NewAuthHandler(userStore *store.UserStore, sessionStore *store.SessionStore, deviceStore *store.DeviceStore) *AuthHandler {
+func NewAuthHandler(userStore *store.UserStore, sessionStore *store.SessionStore, registrationStore *store.RegistrationStore, deviceStore *store.DeviceStore, credentialStore *store.CredentialStore, recoveryCodeStore *store.RecoveryCodeStore, totpStore *store.TOTPStore, lockoutStore *store.LockoutStore, challengeStore *store.ChallengeStore, decoys *DecoyGenerator, usernamePolicy username.Policy, relyingParty *webauthn.RelyingParty) *AuthHandler {
 	return &AuthHandler{
-		userStore:    userStore,
-		sessionStore: sessionStore,
-		deviceStore:  deviceStore,
+		userStore:         userStore,
+		sessionStore:      sessionStore,
+		registrationStore: registrationStore,
+		deviceStore:       deviceStore,
+		credentialStore:   credentialStore,
+		recoveryCodeStore: recoveryCodeStore,
+		totpStore:         totpStore,
+		lockoutStore:      lockoutStore,
+		challengeStore:    challengeStore,
+		decoys:            decoys,
+		usernamePolicy:    usernamePolicy,
+		registrationMode:  models.RegistrationModeOpen,
+		relyingParty:      relyingParty,
 	}
 }
 
+// SetRegistrationMode chooses who may sign up: anyone (models.RegistrationModeOpen),
+// holders of an invite from inviteStore (models.RegistrationModeInvite) or nobody
+// (models.RegistrationModeClosed). Registration is open by default.
+func (h *AuthHandler) SetRegistrationMode(mode string, inviteStore *store.InviteStore) {
+	h.registrationMode = mode
+	h.inviteStore = inviteStore
+}
+
+// RegistrationModeResponse tells clients whether sign-up needs an invite and
+// whether it goes through single sign-on instead of RegisterInit
+type RegistrationModeResponse struct {
+	Mode         string `json:"mode"`
+	SingleSignOn bool   `json:"single_sign_on"`
+}
+
+// GetRegistrationMode returns the registration mode
+func (h *AuthHandler) GetRegistrationMode(c echo.Context) error {
+	return c.JSON(http.StatusOK, RegistrationModeResponse{
+		Mode:         h.registrationMode,
+		SingleSignOn: h.oidcProvider != nil,
+	})
+}
+
+var (
+	// registrationIPPolicy limits sign-ups started from one client address
+	registrationIPPolicy = store.LockoutPolicy{
+		Limit:       10,
+		Window:      time.Hour,
+		BaseLockout: time.Minute,
+		MaxLockout:  24 * time.Hour,
+	}
+	// registrationClaimPolicy limits username claims from one client address, which
+	// is where a taken username is first revealed
+	registrationClaimPolicy = store.LockoutPolicy{
+		Limit:       5,
+		Window:      time.Hour,
+		BaseLockout: time.Minute,
+		MaxLockout:  24 * time.Hour,
+	}
+)
+
 // RegisterInitRequest represents the initial registration payload
 type RegisterInitRequest struct {
-	Username string `json:"username"`
+	Username    string `json:"username"`
+	InviteToken string `json:"invite_token,omitempty"`
 }
 
 // RegisterInitResponse carries user identity back to the client
 type RegisterInitResponse struct {
-	UserID   uuid.UUID `json:"user_id"`
-	Username string    `json:"username"`
+	UserID    uuid.UUID `json:"user_id"`
+	Username  string    `json:"username"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CSRFToken string    `json:"csrf_token"`
 }
 
-// RecoveryPayload represents the UMK recovery payload encrypted with a passphrase
+// RecoveryPayload represents the UMK recovery payload encrypted with a passphrase.
+// KDF describes how the wrapping key was derived; payloads without one use models.LegacyKDF.
+// KDFUpgradeRequired and RecommendedKDF are only set in responses.
 type RecoveryPayload struct {
-	WrappedUMK string `json:"wrapped_umk"`
-	Salt       string `json:"salt"`
-	IV         string `json:"iv"`
+	WrappedUMK         string                `json:"wrapped_umk"`
+	Salt               string                `json:"salt"`
+	IV                 string                `json:"iv"`
+	KDF                *models.KDFDescriptor `json:"kdf,omitempty"`
+	Version            int                   `json:"version,omitempty"`
+	KDFUpgradeRequired bool                  `json:"kdf_upgrade_required,omitempty"`
+	RecommendedKDF     *models.KDFDescriptor `json:"recommended_kdf,omitempty"`
 }
 
-// RegisterRequest represents the final registration payload
+// RegisterRequest represents the final registration payload.
+// UMKVerifier is a base64 32-byte key the client derives from the UMK; recovery
+// changes and step-ups later prove UMK possession by MACing challenges with it.
 type RegisterRequest struct {
-	WrappedUMK string          `json:"wrapped_umk"`
-	Recovery   RecoveryPayload `json:"recovery"`
+	WrappedUMK      string             `json:"wrapped_umk"`
+	Wrap            *models.DeviceWrap `json:"wrap,omitempty"`
+	Recovery        RecoveryPayload    `json:"recovery"`
+	RecoveryAuthKey string             `json:"recovery_auth_key,omitempty"`
+	UMKVerifier     string             `json:"umk_verifier"`
 }
 
 // RegisterResponse represents the registration response
 type RegisterResponse struct {
-	UserID   uuid.UUID `json:"user_id"`
-	Username string    `json:"username"`
-	DeviceID uuid.UUID `json:"device_id"`
+	UserID    uuid.UUID `json:"user_id"`
+	Username  string    `json:"username"`
+	DeviceID  uuid.UUID `json:"device_id"`
+	CSRFToken string    `json:"csrf_token"`
 }
 
 // LoginRequest represents the login request body
@@ -64,7 +148,9 @@ type LoginRequest struct {
 	DeviceID string `json:"device_id,omitempty"`
 }
 
-// LoginResponse represents the login response
+// LoginResponse represents the login response.
+// When MFARequired is set the session is a pre-auth session and only the user
+// and CSRF token are filled in; the rest follows from LoginTOTP.
 type LoginResponse struct {
 	UserID                     uuid.UUID `json:"user_id"`
 	Username                   string    `json:"username"`
@@ -72,16 +158,29 @@ type LoginResponse struct {
 	DeviceVerified             bool      `json:"device_verified"`
 	RequiresDeviceRegistration bool      `json:"requires_device_registration"`
 	RecoveryAvailable          bool      `json:"recovery_available"`
+	RecoveryCodesRemaining     int       `json:"recovery_codes_remaining"`
+	RecoveryKDFUpgradeRequired bool      `json:"recovery_kdf_upgrade_required"`
+	MFARequired                bool      `json:"mfa_required"`
+	CSRFToken                  string    `json:"csrf_token"`
 }
 
 // SessionResponse represents the session info response
 type SessionResponse struct {
-	UserID   uuid.UUID `json:"user_id"`
-	Username string    `json:"username"`
+	UserID              uuid.UUID `json:"user_id"`
+	Username            string    `json:"username"`
+	MFARequired         bool      `json:"mfa_required"`
+	RegistrationPending bool      `json:"registration_pending"`
+	CSRFToken           string    `json:"csrf_token"`
 }
 
-// Register handles user registration and device provisioning
+// RegisterInit starts a sign-up. It does not check whether the username is free:
+// every request gets the same response and a registration session that expires
+// after store.RegistrationDuration, and the username is only claimed when Register
+// completes.
 func (h *AuthHandler) RegisterInit(c echo.Context) error {
+	start := time.Now()
+	defer padResponseTime(start)
+
 	var req RegisterInitRequest
 	if err := c.Bind(&req); err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, "invalid request")
@@ -91,30 +190,51 @@ func (h *AuthHandler) RegisterInit(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "username is required")
 	}
 
-	if _, exists := h.userStore.FindByUsername(req.Username); exists {
-		return echo.NewHTTPError(http.StatusConflict, "username already exists")
+	name, err := h.usernamePolicy.Normalize(req.Username)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if h.oidcProvider != nil {
+		return echo.NewHTTPError(http.StatusForbidden, "registration requires single sign-on")
+	}
+
+	if h.registrationMode == models.RegistrationModeClosed {
+		return echo.NewHTTPError(http.StatusForbidden, "registration is closed")
 	}
 
-	user := h.userStore.Create(req.Username)
-	session := h.sessionStore.Create(user.ID)
+	if retry, allowed := h.lockoutStore.Attempt("register:ip:"+c.RealIP(), registrationIPPolicy); !allowed {
+		setRetryAfter(c, retry)
+		return echo.NewHTTPError(http.StatusTooManyRequests, "too many registrations, try again later")
+	}
 
-	cookie := &http.Cookie{
-		Name:     middleware.SessionCookieName,
-		Value:    session.ID,
-		Expires:  session.ExpiresAt,
-		HttpOnly: true,
-		SameSite: http.SameSiteLaxMode,
-		Path:     "/",
+	// Checked after the rate limit so invite tokens cannot be guessed quickly. The
+	// use is only reserved here; the registration store commits it when the
+	// sign-up completes and releases it if the sign-up fails or is abandoned.
+	var inviteID *uuid.UUID
+	if h.registrationMode == models.RegistrationModeInvite {
+		invite, err := h.inviteStore.Reserve(req.InviteToken)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusForbidden, "a valid invite is required to register")
+		}
+		inviteID = &invite.ID
 	}
-	c.SetCookie(cookie)
+
+	registration := h.registrationStore.Begin(name, inviteID)
+	session, token := h.sessionStore.CreateRegistration(registration, c.RealIP(), c.Request().UserAgent())
+	middleware.SetSessionCookie(c, session, token)
 
 	return c.JSON(http.StatusCreated, RegisterInitResponse{
-		UserID:   user.ID,
-		Username: user.Username,
+		UserID:    registration.UserID,
+		Username:  registration.Username,
+		ExpiresAt: registration.ExpiresAt,
+		CSRFToken: session.CSRFToken,
 	})
 }
 
-// Register handles device key registration after initialization
+// Register completes a sign-up with the account's key material and first device.
+// A registration completes exactly once; the registration session is then
+// upgraded to a full session with a new cookie and CSRF token.
 func (h *AuthHandler) Register(c echo.Context) error {
 	var req RegisterRequest
 	if err := c.Bind(&req); err != nil {
@@ -129,36 +249,126 @@ func (h *AuthHandler) Register(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "recovery payload is required")
 	}
 
+	wrap, err := deviceWrapOf(req.Wrap)
+	if err != nil {
+		return err
+	}
+
+	kdf, err := recoveryKDFOf(req.Recovery)
+	if err != nil {
+		return err
+	}
+
+	if !validMACKey(req.UMKVerifier) {
+		return echo.NewHTTPError(http.StatusBadRequest, "umk_verifier is required")
+	}
+
+	if req.RecoveryAuthKey != "" && !validMACKey(req.RecoveryAuthKey) {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid recovery_auth_key")
+	}
+
 	cookie, err := c.Cookie(middleware.SessionCookieName)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusUnauthorized, "registration session not found")
 	}
 
-	session, exists := h.sessionStore.FindByID(cookie.Value)
+	session, exists := h.sessionStore.FindByToken(cookie.Value)
 	if !exists {
 		return echo.NewHTTPError(http.StatusUnauthorized, "registration session expired")
 	}
 
-	user, exists := h.userStore.FindByID(session.UserID)
-	if !exists {
-		return echo.NewHTTPError(http.StatusNotFound, "user not found")
+	if session.MFAPending {
+		return echo.NewHTTPError(http.StatusForbidden, "two-factor authentication required")
 	}
 
-	if _, ok := h.userStore.UpdateRecoveryData(user.ID, req.Recovery.WrappedUMK, req.Recovery.Salt, req.Recovery.IV); !ok {
+	var user *models.User
+	if session.RegistrationID != nil {
+		user, err = h.completeRegistration(c, *session.RegistrationID)
+	} else {
+		user, err = h.unprovisionedUser(session.UserID)
+	}
+	if err != nil {
+		return err
+	}
+
+	if session.RegistrationID != nil {
+		upgraded, token, err := h.sessionStore.CompleteRegistration(session.ID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusUnauthorized, "registration session expired")
+		}
+		middleware.SetSessionCookie(c, upgraded, token)
+		session = upgraded
+	}
+
+	if _, ok := h.userStore.UpdateRecoveryData(user.ID, req.Recovery.WrappedUMK, req.Recovery.Salt, req.Recovery.IV, kdf); !ok {
 		return echo.NewHTTPError(http.StatusInternalServerError, "failed to persist recovery data")
 	}
 
-	device := h.deviceStore.Create(user.ID, req.WrappedUMK)
+	h.userStore.SetUMKVerifier(user.ID, req.UMKVerifier)
+
+	if req.RecoveryAuthKey != "" {
+		h.userStore.SetRecoveryAuthKey(user.ID, req.RecoveryAuthKey)
+	}
+
+	device := h.deviceStore.Create(user.ID, req.WrappedUMK, wrap)
+	h.sessionStore.SetDeviceID(session.ID, device.ID)
 
 	return c.JSON(http.StatusCreated, RegisterResponse{
-		UserID:   user.ID,
-		Username: user.Username,
-		DeviceID: device.ID,
+		UserID:    user.ID,
+		Username:  user.Username,
+		DeviceID:  device.ID,
+		CSRFToken: session.CSRFToken,
+	})
+}
+
+// completeRegistration creates the account a registration was started for. Only
+// here does a client learn that a username is taken.
+func (h *AuthHandler) completeRegistration(c echo.Context, registrationID uuid.UUID) (*models.User, error) {
+	if retry, allowed := h.lockoutStore.Attempt("register-claim:ip:"+c.RealIP(), registrationClaimPolicy); !allowed {
+		setRetryAfter(c, retry)
+		return nil, echo.NewHTTPError(http.StatusTooManyRequests, "too many registrations, try again later")
+	}
+
+	var user *models.User
+	_, err := h.registrationStore.Complete(registrationID, func(registration *models.Registration) error {
+		claimed, err := h.userStore.Claim(registration.UserID, registration.Username)
+		user = claimed
+		return err
 	})
+	switch {
+	case err == nil:
+		return user, nil
+	case errors.Is(err, store.ErrRegistrationNotFound):
+		return nil, echo.NewHTTPError(http.StatusUnauthorized, "registration session expired")
+	case errors.Is(err, store.ErrRegistrationCompleted):
+		return nil, echo.NewHTTPError(http.StatusConflict, "registration already completed")
+	}
+	return nil, echo.NewHTTPError(http.StatusConflict, "username is not available")
+}
+
+// unprovisionedUser returns the user of a full session calling Register. That is
+// allowed once, for accounts created without key material such as first-time
+// single sign-on users.
+func (h *AuthHandler) unprovisionedUser(userID uuid.UUID) (*models.User, error) {
+	user, exists := h.userStore.FindByID(userID)
+	if !exists {
+		return nil, echo.NewHTTPError(http.StatusNotFound, "user not found")
+	}
+
+	if user.RecoveryWrappedUMK != "" || len(h.deviceStore.FindByUserID(user.ID)) > 0 {
+		return nil, echo.NewHTTPError(http.StatusConflict, "registration already completed")
+	}
+
+	return user, nil
 }
 
-// Login handles user login
+// Login handles user login. Unknown usernames, and accounts that sign in with single
+// sign-on, get a decoy session and a response shaped like that of an existing account
+// signing in from a new device, after the same delay.
 func (h *AuthHandler) Login(c echo.Context) error {
+	start := time.Now()
+	defer padResponseTime(start)
+
 	var req LoginRequest
 	if err := c.Bind(&req); err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, "invalid request")
@@ -168,10 +378,15 @@ func (h *AuthHandler) Login(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "username is required")
 	}
 
+	// Decoys answer with the name as given, so fold it like stored usernames
+	req.Username = username.Fold(req.Username)
+
 	// Find existing user
+	// Accounts linked to the provider cannot use Login, but saying so would reveal
+	// that they exist
 	user, exists := h.userStore.FindByUsername(req.Username)
-	if !exists {
-		return echo.NewHTTPError(http.StatusUnauthorized, "user not found")
+	if !exists || user.OIDCSubject != "" {
+		return h.decoyLogin(c, req.Username)
 	}
 
 	var device *models.Device
@@ -183,22 +398,74 @@ func (h *AuthHandler) Login(c echo.Context) error {
 		}
 	}
 
-	requiresRegistration := device == nil
+	return h.startLoginSession(c, user, device)
+}
+
+// decoyLogin answers a login that cannot succeed with a decoy session. Whether the
+// decoy has a second factor, and the state of its recovery setup, are derived from
+// the name, so every field varies across names the way it does across real accounts.
+func (h *AuthHandler) decoyLogin(c echo.Context, name string) error {
+	user := h.decoys.User(name)
+	mfaRequired := h.decoys.MFARequired(name)
+
+	session, token := h.sessionStore.CreateDecoy(user.ID, name, mfaRequired, c.RealIP(), c.Request().UserAgent())
+	middleware.SetSessionCookie(c, session, token)
+
+	if mfaRequired {
+		return c.JSON(http.StatusOK, LoginResponse{
+			UserID:      user.ID,
+			Username:    name,
+			MFARequired: true,
+			CSRFToken:   session.CSRFToken,
+		})
+	}
+
+	recoveryAvailable := user.RecoveryWrappedUMK != ""
 
-	// Create session
-	session := h.sessionStore.Create(user.ID)
+	return c.JSON(http.StatusOK, LoginResponse{
+		UserID:                     user.ID,
+		Username:                   name,
+		RequiresDeviceRegistration: true,
+		RecoveryAvailable:          recoveryAvailable,
+		RecoveryCodesRemaining:     h.decoys.RecoveryCodesRemaining(name),
+		RecoveryKDFUpgradeRequired: recoveryAvailable && models.DefaultKDFPolicy.NeedsUpgrade(user.RecoveryKDFOrLegacy()),
+		CSRFToken:                  session.CSRFToken,
+	})
+}
 
-	// Set session cookie
-	cookie := &http.Cookie{
-		Name:     middleware.SessionCookieName,
-		Value:    session.ID,
-		Expires:  session.ExpiresAt,
-		HttpOnly: true,
-		SameSite: http.SameSiteLaxMode,
-		Path:     "/",
+// startLoginSession signs user in after a first factor: every login path goes through
+// here so that users with two-factor authentication only get a pre-auth session until
+// LoginTOTP
+func (h *AuthHandler) startLoginSession(c echo.Context, user *models.User, device *models.Device) error {
+	if h.totpStore.IsEnabled(user.ID) {
+		session, token := h.sessionStore.CreatePending(user.ID, sessionDeviceID(device), c.RealIP(), c.Request().UserAgent())
+		middleware.SetSessionCookie(c, session, token)
+
+		return c.JSON(http.StatusOK, LoginResponse{
+			UserID:      user.ID,
+			Username:    user.Username,
+			MFARequired: true,
+			CSRFToken:   session.CSRFToken,
+		})
 	}
-	c.SetCookie(cookie)
 
+	session, token := h.sessionStore.Create(user.ID, sessionDeviceID(device), c.RealIP(), c.Request().UserAgent())
+	middleware.SetSessionCookie(c, session, token)
+
+	return c.JSON(http.StatusOK, h.newLoginResponse(user, device, session))
+}
+
+// sessionDeviceID returns the ID to record on a session for the device proved at login, if any
+func sessionDeviceID(device *models.Device) *uuid.UUID {
+	if device == nil {
+		return nil
+	}
+	return &device.ID
+}
+
+// newLoginResponse builds the login response for a user, the device they proved, if any,
+// and the session just created for them
+func (h *AuthHandler) newLoginResponse(user *models.User, device *models.Device, session *models.Session) LoginResponse {
 	var deviceIDPtr *string
 	if device != nil {
 		id := device.ID.String()
@@ -206,45 +473,55 @@ func (h *AuthHandler) Login(c echo.Context) error {
 	}
 
 	recoveryAvailable := user.RecoveryWrappedUMK != "" && user.RecoverySalt != "" && user.RecoveryIV != ""
+	recoveryCodesRemaining, _ := h.recoveryCodeStore.Counts(user.ID)
 
-	return c.JSON(http.StatusOK, LoginResponse{
+	return LoginResponse{
 		UserID:                     user.ID,
 		Username:                   user.Username,
 		DeviceID:                   deviceIDPtr,
 		DeviceVerified:             device != nil,
-		RequiresDeviceRegistration: requiresRegistration,
+		RequiresDeviceRegistration: device == nil,
 		RecoveryAvailable:          recoveryAvailable,
-	})
+		RecoveryCodesRemaining:     recoveryCodesRemaining,
+		RecoveryKDFUpgradeRequired: recoveryAvailable && models.DefaultKDFPolicy.NeedsUpgrade(user.RecoveryKDFOrLegacy()),
+		CSRFToken:                  session.CSRFToken,
+	}
 }
 
-// GetRecovery returns the encrypted recovery payload for the authenticated user
-func (h *AuthHandler) GetRecovery(c echo.Context) error {
+// GetSession returns the current session information
+func (h *AuthHandler) GetSession(c echo.Context) error {
 	userID, ok := c.Get(middleware.UserIDContextKey).(uuid.UUID)
 	if !ok {
 		return echo.NewHTTPError(http.StatusUnauthorized, "invalid session")
 	}
 
-	user, exists := h.userStore.FindByID(userID)
+	sessionID, _ := c.Get(middleware.SessionIDContextKey).(string)
+	session, exists := h.sessionStore.FindByID(sessionID)
 	if !exists {
-		return echo.NewHTTPError(http.StatusNotFound, "user not found")
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid session")
 	}
 
-	if user.RecoveryWrappedUMK == "" || user.RecoverySalt == "" || user.RecoveryIV == "" {
-		return echo.NewHTTPError(http.StatusNotFound, "recovery data not available")
+	if decoyUsername, ok := c.Get(middleware.DecoyUsernameContextKey).(string); ok {
+		return c.JSON(http.StatusOK, SessionResponse{
+			UserID:      userID,
+			Username:    decoyUsername,
+			MFARequired: session.MFAPending,
+			CSRFToken:   session.CSRFToken,
+		})
 	}
 
-	return c.JSON(http.StatusOK, RecoveryPayload{
-		WrappedUMK: user.RecoveryWrappedUMK,
-		Salt:       user.RecoverySalt,
-		IV:         user.RecoveryIV,
-	})
-}
+	if session.RegistrationID != nil {
+		registration, exists := h.registrationStore.Find(*session.RegistrationID)
+		if !exists {
+			return echo.NewHTTPError(http.StatusUnauthorized, "invalid session")
+		}
 
-// GetSession returns the current session information
-func (h *AuthHandler) GetSession(c echo.Context) error {
-	userID, ok := c.Get(middleware.UserIDContextKey).(uuid.UUID)
-	if !ok {
-		return echo.NewHTTPError(http.StatusUnauthorized, "invalid session")
+		return c.JSON(http.StatusOK, SessionResponse{
+			UserID:              registration.UserID,
+			Username:            registration.Username,
+			RegistrationPending: true,
+			CSRFToken:           session.CSRFToken,
+		})
 	}
 
 	user, exists := h.userStore.FindByID(userID)
@@ -253,8 +530,10 @@ func (h *AuthHandler) GetSession(c echo.Context) error {
 	}
 
 	return c.JSON(http.StatusOK, SessionResponse{
-		UserID:   user.ID,
-		Username: user.Username,
+		UserID:      user.ID,
+		Username:    user.Username,
+		MFARequired: session.MFAPending,
+		CSRFToken:   session.CSRFToken,
 	})
 }
 
@@ -262,19 +541,10 @@ func (h *AuthHandler) GetSession(c echo.Context) error {
 func (h *AuthHandler) Logout(c echo.Context) error {
 	cookie, err := c.Cookie(middleware.SessionCookieName)
 	if err == nil {
-		h.sessionStore.Delete(cookie.Value)
-	}
-
-	// Clear cookie
-	c.SetCookie(&http.Cookie{
-		Name:     middleware.SessionCookieName,
-		Value:    "",
-		Expires:  time.Unix(0, 0),
-		HttpOnly: true,
-		SameSite: http.SameSiteLaxMode,
-		Path:     "/",
-		MaxAge:   -1,
-	})
+		h.sessionStore.DeleteByToken(cookie.Value)
+	}
+
+	middleware.ClearSessionCookie(c)
 
 	return c.NoContent(http.StatusOK)
 }
@@ -0,0 +1,61 @@
+package handlers_test
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/handlers"
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/middleware"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+func TestDecoyLoginIsStable(t *testing.T) {
+	f := newAuthFixture(t)
+
+	var first, second handlers.LoginResponse
+	decodeJSON(t, call(t, f.handler.Login, handlers.LoginRequest{Username: "nobody"}), &first)
+	decodeJSON(t, call(t, f.handler.Login, handlers.LoginRequest{Username: "nobody"}), &second)
+
+	first.CSRFToken, second.CSRFToken = "", ""
+	if first != second {
+		t.Errorf("login = %+v, then %+v", first, second)
+	}
+}
+
+func TestDecoysVaryLikeRealAccounts(t *testing.T) {
+	decoys, err := handlers.NewDecoyGenerator(bytes.Repeat([]byte("k"), 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mfa, codes, legacyKDF bool
+	for i := range 200 {
+		name := fmt.Sprintf("nobody%d", i)
+		mfa = mfa || decoys.MFARequired(name)
+		codes = codes || decoys.RecoveryCodesRemaining(name) > 0
+		legacyKDF = legacyKDF || (decoys.RecoveryAvailable(name) && decoys.User(name).RecoveryKDF == nil)
+	}
+
+	if !mfa || !codes || !legacyKDF {
+		t.Errorf("seen mfa = %t, recovery codes = %t, legacy kdf = %t; want all", mfa, codes, legacyKDF)
+	}
+}
+
+func TestLoginTOTPRejectsDecoy(t *testing.T) {
+	f := newAuthFixture(t)
+
+	session, _ := f.sessionStore.CreateDecoy(uuid.New(), "nobody", true, "", "")
+	asDecoy := func(c echo.Context) {
+		c.Set(middleware.UserIDContextKey, session.UserID)
+		c.Set(middleware.SessionIDContextKey, session.ID)
+		c.Set(middleware.DecoyUsernameContextKey, "nobody")
+	}
+
+	rec := call(t, f.handler.LoginTOTP, handlers.TOTPCodeRequest{Code: "123456"}, asDecoy)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
@@ -1,14 +1,27 @@
 package handlers
 
 import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
 	"net/http"
+	"slices"
+	"strconv"
+	"time"
 
 	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/models"
 	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/store"
+	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 )
 
-// DebugHandler handles debug endpoints
+const (
+	defaultDebugPageLimit = 20
+	maxDebugPageLimit     = 100
+)
+
+// DebugHandler serves a redacted view of the stores for development. It is only
+// registered in dev mode, behind middleware.AdminMiddleware.
 type DebugHandler struct {
 	userStore    *store.UserStore
 	sessionStore *store.SessionStore
@@ -26,25 +39,224 @@ func NewDebugHandler(userStore *store.UserStore, sessionStore *store.SessionStor
 	}
 }
 
-// DebugResponse represents the debug information response
+// DebugUser describes a user without its recovery material; RecoveryFingerprint
+// tells payloads apart without revealing them
+type DebugUser struct {
+	ID                  uuid.UUID `json:"id"`
+	Username            string    `json:"username"`
+	SSO                 bool      `json:"sso"`
+	RecoveryVersion     int       `json:"recovery_version,omitempty"`
+	RecoveryFingerprint string    `json:"recovery_fingerprint,omitempty"`
+	RecoveryUpdatedAt   time.Time `json:"recovery_updated_at,omitzero"`
+}
+
+// DebugSession describes a session by a fingerprint of its ID, which would
+// otherwise be enough to revoke it
+type DebugSession struct {
+	IDFingerprint   string     `json:"id_fingerprint"`
+	UserID          uuid.UUID  `json:"user_id"`
+	DeviceID        *uuid.UUID `json:"device_id,omitempty"`
+	MFAPending      bool       `json:"mfa_pending,omitempty"`
+	Registration    bool       `json:"registration,omitempty"`
+	Decoy           bool       `json:"decoy,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	LastSeenAt      time.Time  `json:"last_seen_at"`
+	ExpiresAt       time.Time  `json:"expires_at"`
+	IdleExpiresAt   time.Time  `json:"idle_expires_at"`
+	AuthenticatedAt time.Time  `json:"authenticated_at"`
+}
+
+// DebugDevice describes a device with its wrap metadata but not its wrapped UMK
+type DebugDevice struct {
+	ID                    uuid.UUID         `json:"id"`
+	UserID                uuid.UUID         `json:"user_id"`
+	Wrap                  models.DeviceWrap `json:"wrap"`
+	WrappedUMKFingerprint string            `json:"wrapped_umk_fingerprint"`
+	CreatedAt             time.Time         `json:"created_at"`
+}
+
+// DebugMessage describes a message by its size only
+type DebugMessage struct {
+	ID            uuid.UUID `json:"id"`
+	UserID        uuid.UUID `json:"user_id"`
+	ContentLength int       `json:"content_length"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// DebugCounts holds the number of matching records before pagination
+type DebugCounts struct {
+	Users    int `json:"users"`
+	Sessions int `json:"sessions"`
+	Devices  int `json:"devices"`
+	Messages int `json:"messages"`
+}
+
+// DebugResponse is one page of each record kind. Offset and Limit apply to every
+// list; HasMore is set while any of them continues past this page.
 type DebugResponse struct {
-	Users    []*models.User    `json:"users"`
-	Sessions []*models.Session `json:"sessions"`
-	Devices  []*models.Device  `json:"devices"`
-	Messages []*models.Message `json:"messages"`
+	Offset   int            `json:"offset"`
+	Limit    int            `json:"limit"`
+	HasMore  bool           `json:"has_more"`
+	Counts   DebugCounts    `json:"counts"`
+	Users    []DebugUser    `json:"users"`
+	Sessions []DebugSession `json:"sessions"`
+	Devices  []DebugDevice  `json:"devices"`
+	Messages []DebugMessage `json:"messages"`
 }
 
-// GetDebugInfo returns all users, sessions, devices, and messages for debugging
+// GetDebugInfo returns a page of users, sessions, devices and messages, optionally
+// only those of the user given by the user_id query parameter. Secrets are replaced
+// by fingerprints.
 func (h *DebugHandler) GetDebugInfo(c echo.Context) error {
-	users := h.userStore.GetAll()
-	sessions := h.sessionStore.GetAll()
-	devices := h.deviceStore.GetAll()
-	messages := h.messageStore.GetAll()
-
-	return c.JSON(http.StatusOK, DebugResponse{
-		Users:    users,
-		Sessions: sessions,
-		Devices:  devices,
-		Messages: messages,
+	var userID *uuid.UUID
+	if param := c.QueryParam("user_id"); param != "" {
+		parsed, err := uuid.Parse(param)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid user_id parameter")
+		}
+		userID = &parsed
+	}
+
+	offset, err := intQueryParam(c, "offset", 0)
+	if err != nil || offset < 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid offset parameter")
+	}
+
+	limit, err := intQueryParam(c, "limit", defaultDebugPageLimit)
+	if err != nil || limit < 1 || limit > maxDebugPageLimit {
+		return echo.NewHTTPError(http.StatusBadRequest, "limit must be between 1 and 100")
+	}
+
+	belongs := func(owner uuid.UUID) bool {
+		return userID == nil || owner == *userID
+	}
+
+	var users []*models.User
+	for _, user := range h.userStore.GetAll() {
+		if belongs(user.ID) {
+			users = append(users, user)
+		}
+	}
+	slices.SortFunc(users, func(a, b *models.User) int {
+		return cmp.Or(cmp.Compare(a.Username, b.Username), cmp.Compare(a.ID.String(), b.ID.String()))
+	})
+
+	var sessions []*models.Session
+	for _, session := range h.sessionStore.GetAll() {
+		if belongs(session.UserID) {
+			sessions = append(sessions, session)
+		}
+	}
+	slices.SortFunc(sessions, func(a, b *models.Session) int {
+		return cmp.Or(b.CreatedAt.Compare(a.CreatedAt), cmp.Compare(a.ID, b.ID))
 	})
+
+	var devices []*models.Device
+	for _, device := range h.deviceStore.GetAll() {
+		if belongs(device.UserID) {
+			devices = append(devices, device)
+		}
+	}
+	slices.SortFunc(devices, func(a, b *models.Device) int {
+		return cmp.Or(b.CreatedAt.Compare(a.CreatedAt), cmp.Compare(a.ID.String(), b.ID.String()))
+	})
+
+	var messages []*models.Message
+	for _, message := range h.messageStore.GetAll() {
+		if belongs(message.UserID) {
+			messages = append(messages, message)
+		}
+	}
+	slices.SortFunc(messages, func(a, b *models.Message) int {
+		return cmp.Or(b.CreatedAt.Compare(a.CreatedAt), cmp.Compare(a.ID.String(), b.ID.String()))
+	})
+
+	response := DebugResponse{
+		Offset: offset,
+		Limit:  limit,
+		Counts: DebugCounts{
+			Users:    len(users),
+			Sessions: len(sessions),
+			Devices:  len(devices),
+			Messages: len(messages),
+		},
+		Users:    []DebugUser{},
+		Sessions: []DebugSession{},
+		Devices:  []DebugDevice{},
+		Messages: []DebugMessage{},
+	}
+	response.HasMore = offset+limit < max(len(users), len(sessions), len(devices), len(messages))
+
+	for _, user := range debugPage(users, offset, limit) {
+		debugUser := DebugUser{
+			ID:                user.ID,
+			Username:          user.Username,
+			SSO:               user.OIDCSubject != "",
+			RecoveryVersion:   user.RecoveryVersion,
+			RecoveryUpdatedAt: user.RecoveryUpdatedAt,
+		}
+		if user.RecoveryWrappedUMK != "" {
+			debugUser.RecoveryFingerprint = fingerprint(user.RecoveryWrappedUMK)
+		}
+		response.Users = append(response.Users, debugUser)
+	}
+
+	for _, session := range debugPage(sessions, offset, limit) {
+		response.Sessions = append(response.Sessions, DebugSession{
+			IDFingerprint:   fingerprint(session.ID),
+			UserID:          session.UserID,
+			DeviceID:        session.DeviceID,
+			MFAPending:      session.MFAPending,
+			Registration:    session.RegistrationID != nil,
+			Decoy:           session.DecoyUsername != "",
+			CreatedAt:       session.CreatedAt,
+			LastSeenAt:      session.LastSeenAt,
+			ExpiresAt:       session.ExpiresAt,
+			IdleExpiresAt:   session.IdleExpiresAt,
+			AuthenticatedAt: session.AuthenticatedAt,
+		})
+	}
+
+	for _, device := range debugPage(devices, offset, limit) {
+		response.Devices = append(response.Devices, DebugDevice{
+			ID:                    device.ID,
+			UserID:                device.UserID,
+			Wrap:                  device.Wrap,
+			WrappedUMKFingerprint: fingerprint(device.WrappedUMK),
+			CreatedAt:             device.CreatedAt,
+		})
+	}
+
+	for _, message := range debugPage(messages, offset, limit) {
+		response.Messages = append(response.Messages, DebugMessage{
+			ID:            message.ID,
+			UserID:        message.UserID,
+			ContentLength: len(message.EncryptedContent),
+			CreatedAt:     message.CreatedAt,
+		})
+	}
+
+	return c.JSON(http.StatusOK, response)
+}
+
+// debugPage returns items[offset:offset+limit], clamped to the slice
+func debugPage[T any](items []T, offset, limit int) []T {
+	start := min(offset, len(items))
+	end := min(start+limit, len(items))
+	return items[start:end]
+}
+
+// fingerprint identifies a secret by a short SHA-256 prefix so equal values can be
+// matched up without the value itself being shown
+func fingerprint(secret string) string {
+	digest := sha256.Sum256([]byte(secret))
+	return "sha256:" + hex.EncodeToString(digest[:8])
+}
+
+func intQueryParam(c echo.Context, name string, fallback int) (int, error) {
+	param := c.QueryParam(name)
+	if param == "" {
+		return fallback, nil
+	}
+	return strconv.Atoi(param)
 }
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"crypto/hkdf"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/models"
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/webauthn"
+	"github.com/google/uuid"
+)
+
+const (
+	// authResponseFloor pads login and registration responses so that unknown and
+	// existing accounts take the same time to answer
+	authResponseFloor = 150 * time.Millisecond
+
+	// Sizes of the recovery payload the client produces: an AES-GCM wrapped
+	// 32-byte UMK with its tag, a PBKDF2 salt and a GCM nonce
+	decoyWrappedUMKLength = 32 + 16
+	decoySaltLength       = 16
+	decoyIVLength         = 12
+
+	// decoyCredentialIDLength is the length of the credential IDs platform
+	// authenticators commonly issue
+	decoyCredentialIDLength = 16
+)
+
+// DecoyGenerator derives stand-in data for accounts that do not exist, so that
+// responses for unknown usernames look like those of real accounts. Everything is
+// derived from the username under a server secret: asking twice gives the same
+// answer, and nobody without the secret can tell decoys from real payloads.
+type DecoyGenerator struct {
+	secret []byte
+}
+
+// NewDecoyGenerator creates a DecoyGenerator keyed by secret, which must stay the same
+// across restarts or decoys would change where real accounts do not. It fails if
+// HKDF rejects the secret, as it does for short secrets in FIPS 140-only mode.
+func NewDecoyGenerator(secret []byte) (*DecoyGenerator, error) {
+	if _, err := hkdf.Key(sha256.New, secret, nil, "cse-sync decoy check", 1); err != nil {
+		return nil, fmt.Errorf("decoy secret: %w", err)
+	}
+	return &DecoyGenerator{secret: secret}, nil
+}
+
+// derive expands the secret for one purpose and username. hkdf.Key only fails for a
+// secret it rejects, which NewDecoyGenerator rules out, or for more output than the
+// few bytes asked for here, so the error is not checked.
+func (g *DecoyGenerator) derive(purpose, username string, length int) []byte {
+	key, _ := hkdf.Key(sha256.New, g.secret, nil, "cse-sync decoy "+purpose+"\x00"+username, length)
+	return key
+}
+
+// UserID returns the user ID presented for a nonexistent account
+func (g *DecoyGenerator) UserID(username string) uuid.UUID {
+	id, _ := uuid.FromBytes(g.derive("user-id", username, 16))
+	id[6] = id[6]&0x0f | 0x40
+	id[8] = id[8]&0x3f | 0x80
+	return id
+}
+
+// RecoveryAvailable reports whether the decoy account has a recovery payload.
+// Most do, as real accounts do once registration is finished; about one in
+// sixteen does not, like accounts whose sign-up was abandoned.
+func (g *DecoyGenerator) RecoveryAvailable(username string) bool {
+	return g.derive("recovery-available", username, 1)[0] >= 16
+}
+
+// CredentialDescriptor returns the passkey offered for a nonexistent account, or for
+// an account without passkeys, shaped like one kept by a platform authenticator
+func (g *DecoyGenerator) CredentialDescriptor(username string) webauthn.CredentialDescriptor {
+	return webauthn.CredentialDescriptor{
+		Type:       "public-key",
+		ID:         webauthn.EncodeBase64URL(g.derive("passkey-credential-id", username, decoyCredentialIDLength)),
+		Transports: []string{"hybrid", "internal"},
+	}
+}
+
+// MFARequired reports whether the decoy account signs in with a second factor,
+// as about one account in eight does
+func (g *DecoyGenerator) MFARequired(username string) bool {
+	return g.derive("mfa-required", username, 1)[0] < 32
+}
+
+// RecoveryCodesRemaining returns how many unused recovery codes the decoy account
+// has. Half the accounts with a recovery payload never set codes up; the others
+// have from one to a full set left.
+func (g *DecoyGenerator) RecoveryCodesRemaining(username string) int {
+	if !g.RecoveryAvailable(username) {
+		return 0
+	}
+
+	b := g.derive("recovery-codes-remaining", username, 2)
+	if b[0] < 128 {
+		return 0
+	}
+	return 1 + int(b[1])%maxRecoveryCodes
+}
+
+// User builds the unstored user a decoy session stands for, including the recovery
+// payload, which decrypts under no passphrase
+func (g *DecoyGenerator) User(username string) *models.User {
+	user := &models.User{
+		ID:       g.UserID(username),
+		Username: username,
+	}
+
+	if g.RecoveryAvailable(username) {
+		user.RecoveryWrappedUMK = base64.StdEncoding.EncodeToString(g.derive("recovery-wrapped-umk", username, decoyWrappedUMKLength))
+		user.RecoverySalt = base64.StdEncoding.EncodeToString(g.derive("recovery-salt", username, decoySaltLength))
+		user.RecoveryIV = base64.StdEncoding.EncodeToString(g.derive("recovery-iv", username, decoyIVLength))
+		user.RecoveryVersion = 1
+
+		// About one in eight still has a payload from before KDF descriptors
+		if g.derive("recovery-kdf-legacy", username, 1)[0] >= 32 {
+			kdf := models.DefaultKDFPolicy.Recommended
+			user.RecoveryKDF = &kdf
+		}
+	}
+
+	return user
+}
+
+// padResponseTime sleeps until at least authResponseFloor has passed since start
+func padResponseTime(start time.Time) {
+	time.Sleep(authResponseFloor - time.Since(start))
+}
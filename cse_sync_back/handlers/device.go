@@ -1,10 +1,12 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"time"
 
 	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/middleware"
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/models"
 	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/store"
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
@@ -12,13 +14,15 @@ import (
 
 // DeviceHandler handles device-related endpoints
 type DeviceHandler struct {
-	deviceStore *store.DeviceStore
+	deviceStore  *store.DeviceStore
+	sessionStore *store.SessionStore
 }
 
 // NewDeviceHandler creates a new DeviceHandler instance
-func NewDeviceHandler(deviceStore *store.DeviceStore) *DeviceHandler {
+func NewDeviceHandler(deviceStore *store.DeviceStore, sessionStore *store.SessionStore) *DeviceHandler {
 	return &DeviceHandler{
-		deviceStore: deviceStore,
+		deviceStore:  deviceStore,
+		sessionStore: sessionStore,
 	}
 }
 
@@ -47,8 +51,11 @@ func (h *DeviceHandler) GetDevice(c echo.Context) error {
 	return c.JSON(http.StatusOK, device)
 }
 
+// DeviceRegisterRequest carries the UMK wrapped under the device's local KEK.
+// Wrap may be omitted by older clients, in which case models.LegacyDeviceWrap is assumed.
 type DeviceRegisterRequest struct {
-	WrappedUMK string `json:"wrapped_umk"`
+	WrappedUMK string             `json:"wrapped_umk"`
+	Wrap       *models.DeviceWrap `json:"wrap,omitempty"`
 }
 
 type DeviceRegisterResponse struct {
@@ -71,10 +78,121 @@ func (h *DeviceHandler) RegisterDevice(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "wrapped_umk is required")
 	}
 
-	device := h.deviceStore.Create(userID, req.WrappedUMK)
+	wrap, err := deviceWrapOf(req.Wrap)
+	if err != nil {
+		return err
+	}
+
+	device := h.deviceStore.Create(userID, req.WrappedUMK, wrap)
+
+	if sessionID, ok := c.Get(middleware.SessionIDContextKey).(string); ok {
+		h.sessionStore.SetDeviceID(sessionID, device.ID)
+	}
 
 	return c.JSON(http.StatusCreated, DeviceRegisterResponse{
 		DeviceID:  device.ID,
 		CreatedAt: device.CreatedAt,
 	})
 }
+
+// DeviceRewrapRequest replaces the wrapped UMK after the device rotated its local KEK
+type DeviceRewrapRequest struct {
+	WrappedUMK string            `json:"wrapped_umk"`
+	Wrap       models.DeviceWrap `json:"wrap"`
+}
+
+// UpdateWrappedUMK stores a UMK re-wrapped under a new local KEK without re-registering the device
+func (h *DeviceHandler) UpdateWrappedUMK(c echo.Context) error {
+	userID, ok := c.Get(middleware.UserIDContextKey).(uuid.UUID)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid session")
+	}
+
+	deviceID, err := uuid.Parse(c.Param("deviceID"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid device id")
+	}
+
+	var req DeviceRewrapRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request")
+	}
+
+	if req.WrappedUMK == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "wrapped_umk is required")
+	}
+
+	wrap, err := deviceWrapOf(&req.Wrap)
+	if err != nil {
+		return err
+	}
+
+	device, exists := h.deviceStore.FindByID(deviceID)
+	if !exists {
+		return echo.NewHTTPError(http.StatusNotFound, "device not found")
+	}
+
+	if device.UserID != userID {
+		return echo.NewHTTPError(http.StatusForbidden, "device does not belong to session user")
+	}
+
+	updated, err := h.deviceStore.UpdateWrappedUMK(device.ID, req.WrappedUMK, wrap)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrDeviceNotFound):
+			return echo.NewHTTPError(http.StatusNotFound, "device not found")
+		case errors.Is(err, store.ErrDeviceKeyEpochStale):
+			return echo.NewHTTPError(http.StatusConflict, "key_epoch must be greater than the current epoch")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to update wrapped umk")
+	}
+
+	return c.JSON(http.StatusOK, updated)
+}
+
+// DeviceRevokeResponse reports how many sessions of the revoked device were signed out
+type DeviceRevokeResponse struct {
+	RevokedSessions int `json:"revoked_sessions"`
+}
+
+// RevokeDevice deletes one of the user's devices, discarding its wrapped UMK, and
+// signs out the sessions linked to it
+func (h *DeviceHandler) RevokeDevice(c echo.Context) error {
+	userID, ok := c.Get(middleware.UserIDContextKey).(uuid.UUID)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid session")
+	}
+
+	deviceID, err := uuid.Parse(c.Param("deviceID"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid device id")
+	}
+
+	device, exists := h.deviceStore.FindByID(deviceID)
+	if !exists {
+		return echo.NewHTTPError(http.StatusNotFound, "device not found")
+	}
+
+	if device.UserID != userID {
+		return echo.NewHTTPError(http.StatusForbidden, "device does not belong to session user")
+	}
+
+	h.deviceStore.Delete(device.ID)
+
+	return c.JSON(http.StatusOK, DeviceRevokeResponse{
+		RevokedSessions: h.sessionStore.DeleteByDevice(userID, device.ID),
+	})
+}
+
+// deviceWrapOf validates submitted wrap metadata, defaulting to the legacy format when absent
+func deviceWrapOf(wrap *models.DeviceWrap) (models.DeviceWrap, error) {
+	if wrap == nil {
+		return models.LegacyDeviceWrap, nil
+	}
+
+	if err := wrap.Validate(); err != nil {
+		return models.DeviceWrap{}, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	return *wrap, nil
+}
@@ -0,0 +1,285 @@
+package handlers
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"time"
+
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/middleware"
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/models"
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/store"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+const confirmationCodeDigits = 6
+
+// EnrollmentHandler handles approval of new devices by existing devices
+type EnrollmentHandler struct {
+	enrollmentStore *store.EnrollmentStore
+	deviceStore     *store.DeviceStore
+	sessionStore    *store.SessionStore
+}
+
+// NewEnrollmentHandler creates a new EnrollmentHandler
+func NewEnrollmentHandler(enrollmentStore *store.EnrollmentStore, deviceStore *store.DeviceStore, sessionStore *store.SessionStore) *EnrollmentHandler {
+	return &EnrollmentHandler{
+		enrollmentStore: enrollmentStore,
+		deviceStore:     deviceStore,
+		sessionStore:    sessionStore,
+	}
+}
+
+// EnrollmentRequest represents a new device asking to be enrolled
+type EnrollmentRequest struct {
+	EphemeralPublicKey string `json:"ephemeral_public_key"`
+	DeviceLabel        string `json:"device_label,omitempty"`
+}
+
+// EnrollmentResponse is returned to the new device after it requests enrollment
+type EnrollmentResponse struct {
+	EnrollmentID     uuid.UUID `json:"enrollment_id"`
+	ConfirmationCode string    `json:"confirmation_code"`
+	ExpiresAt        time.Time `json:"expires_at"`
+}
+
+// EnrollmentApproveRequest carries the UMK sealed to the new device's ephemeral key.
+// The approving device is the one the approving session is bound to.
+type EnrollmentApproveRequest struct {
+	ConfirmationCode string `json:"confirmation_code"`
+	SealedUMK        string `json:"sealed_umk"`
+}
+
+// EnrollmentCompleteRequest carries the UMK wrapped under the new device's local KEK
+type EnrollmentCompleteRequest struct {
+	WrappedUMK string             `json:"wrapped_umk"`
+	Wrap       *models.DeviceWrap `json:"wrap,omitempty"`
+}
+
+// RequestEnrollment creates a pending enrollment for the calling device
+func (h *EnrollmentHandler) RequestEnrollment(c echo.Context) error {
+	userID, ok := c.Get(middleware.UserIDContextKey).(uuid.UUID)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid session")
+	}
+
+	sessionID, ok := c.Get(middleware.SessionIDContextKey).(string)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid session")
+	}
+
+	var req EnrollmentRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request")
+	}
+
+	publicKey, err := base64.StdEncoding.DecodeString(req.EphemeralPublicKey)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid ephemeral public key")
+	}
+
+	if _, err := ecdh.X25519().NewPublicKey(publicKey); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "ephemeral public key must be an X25519 key")
+	}
+
+	code, err := generateNumericCode(confirmationCodeDigits)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to generate confirmation code")
+	}
+
+	enrollment := h.enrollmentStore.Create(userID, sessionID, req.EphemeralPublicKey, code, req.DeviceLabel)
+
+	return c.JSON(http.StatusCreated, EnrollmentResponse{
+		EnrollmentID:     enrollment.ID,
+		ConfirmationCode: code,
+		ExpiresAt:        enrollment.ExpiresAt,
+	})
+}
+
+// ListEnrollments returns the pending enrollments existing devices can approve
+func (h *EnrollmentHandler) ListEnrollments(c echo.Context) error {
+	userID, ok := c.Get(middleware.UserIDContextKey).(uuid.UUID)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid session")
+	}
+
+	return c.JSON(http.StatusOK, h.enrollmentStore.FindPendingByUserID(userID))
+}
+
+// GetEnrollment lets the requesting device poll for approval and the sealed UMK
+func (h *EnrollmentHandler) GetEnrollment(c echo.Context) error {
+	enrollment, err := h.requesterEnrollment(c)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, enrollment)
+}
+
+// ApproveEnrollment verifies the confirmation code and stores the sealed UMK
+func (h *EnrollmentHandler) ApproveEnrollment(c echo.Context) error {
+	userID, ok := c.Get(middleware.UserIDContextKey).(uuid.UUID)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid session")
+	}
+
+	sessionID, _ := c.Get(middleware.SessionIDContextKey).(string)
+
+	enrollmentID, err := uuid.Parse(c.Param("enrollmentID"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid enrollment id")
+	}
+
+	var req EnrollmentApproveRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request")
+	}
+
+	if req.ConfirmationCode == "" || req.SealedUMK == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "confirmation_code and sealed_umk are required")
+	}
+
+	session, exists := h.sessionStore.FindByID(sessionID)
+	if !exists || session.DeviceID == nil {
+		return echo.NewHTTPError(http.StatusForbidden, "approval requires a session on an existing device of this user")
+	}
+
+	device, exists := h.deviceStore.FindByID(*session.DeviceID)
+	if !exists || device.UserID != userID {
+		return echo.NewHTTPError(http.StatusForbidden, "approval requires a session on an existing device of this user")
+	}
+
+	enrollment, exists := h.enrollmentStore.FindByID(enrollmentID)
+	if !exists || enrollment.UserID != userID {
+		return echo.NewHTTPError(http.StatusNotFound, "enrollment not found")
+	}
+
+	if enrollment.SessionID == sessionID {
+		return echo.NewHTTPError(http.StatusForbidden, "enrollment must be approved from another device")
+	}
+
+	approved, err := h.enrollmentStore.Approve(enrollmentID, req.ConfirmationCode, device.ID, req.SealedUMK)
+	if err != nil {
+		return enrollmentError(err)
+	}
+
+	return c.JSON(http.StatusOK, approved)
+}
+
+// RejectEnrollment declines a pending enrollment
+func (h *EnrollmentHandler) RejectEnrollment(c echo.Context) error {
+	userID, ok := c.Get(middleware.UserIDContextKey).(uuid.UUID)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid session")
+	}
+
+	enrollmentID, err := uuid.Parse(c.Param("enrollmentID"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid enrollment id")
+	}
+
+	enrollment, exists := h.enrollmentStore.FindByID(enrollmentID)
+	if !exists || enrollment.UserID != userID {
+		return echo.NewHTTPError(http.StatusNotFound, "enrollment not found")
+	}
+
+	if err := h.enrollmentStore.Reject(enrollmentID); err != nil {
+		return enrollmentError(err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// CompleteEnrollment creates the device once the new device has wrapped the UMK locally
+func (h *EnrollmentHandler) CompleteEnrollment(c echo.Context) error {
+	enrollment, err := h.requesterEnrollment(c)
+	if err != nil {
+		return err
+	}
+
+	var req EnrollmentCompleteRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request")
+	}
+
+	if req.WrappedUMK == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "wrapped_umk is required")
+	}
+
+	wrap, err := deviceWrapOf(req.Wrap)
+	if err != nil {
+		return err
+	}
+
+	if enrollment.Status != models.EnrollmentStatusApproved {
+		return enrollmentError(store.ErrEnrollmentNotApproved)
+	}
+
+	device := h.deviceStore.Create(enrollment.UserID, req.WrappedUMK, wrap)
+	if err := h.enrollmentStore.Complete(enrollment.ID, device.ID); err != nil {
+		h.deviceStore.Delete(device.ID)
+		return enrollmentError(err)
+	}
+
+	h.sessionStore.SetDeviceID(enrollment.SessionID, device.ID)
+
+	return c.JSON(http.StatusCreated, DeviceRegisterResponse{
+		DeviceID:  device.ID,
+		CreatedAt: device.CreatedAt,
+	})
+}
+
+// requesterEnrollment loads an enrollment that was requested by the calling session
+func (h *EnrollmentHandler) requesterEnrollment(c echo.Context) (*models.Enrollment, error) {
+	userID, ok := c.Get(middleware.UserIDContextKey).(uuid.UUID)
+	if !ok {
+		return nil, echo.NewHTTPError(http.StatusUnauthorized, "invalid session")
+	}
+
+	sessionID, _ := c.Get(middleware.SessionIDContextKey).(string)
+
+	enrollmentID, err := uuid.Parse(c.Param("enrollmentID"))
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "invalid enrollment id")
+	}
+
+	enrollment, exists := h.enrollmentStore.FindByID(enrollmentID)
+	if !exists || enrollment.UserID != userID {
+		return nil, echo.NewHTTPError(http.StatusNotFound, "enrollment not found")
+	}
+
+	if enrollment.SessionID != sessionID {
+		return nil, echo.NewHTTPError(http.StatusForbidden, "enrollment belongs to another session")
+	}
+
+	return enrollment, nil
+}
+
+func enrollmentError(err error) error {
+	switch {
+	case errors.Is(err, store.ErrEnrollmentNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, "enrollment not found")
+	case errors.Is(err, store.ErrConfirmationCodeMismatch):
+		return echo.NewHTTPError(http.StatusForbidden, "confirmation code mismatch")
+	case errors.Is(err, store.ErrTooManyAttempts):
+		return echo.NewHTTPError(http.StatusForbidden, "too many failed attempts; enrollment rejected")
+	case errors.Is(err, store.ErrEnrollmentNotPending), errors.Is(err, store.ErrEnrollmentNotApproved):
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	}
+	return echo.NewHTTPError(http.StatusInternalServerError, "enrollment failed")
+}
+
+// generateNumericCode returns a uniformly random decimal code of the given length
+func generateNumericCode(digits int) (string, error) {
+	limit := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(digits)), nil)
+	n, err := rand.Int(rand.Reader, limit)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", digits, n), nil
+}
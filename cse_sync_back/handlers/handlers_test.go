@@ -0,0 +1,108 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/handlers"
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/middleware"
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/store"
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/username"
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/webauthn/webauthntest"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// authFixture is an AuthHandler over empty in-memory stores
+type authFixture struct {
+	handler           *handlers.AuthHandler
+	userStore         *store.UserStore
+	sessionStore      *store.SessionStore
+	deviceStore       *store.DeviceStore
+	credentialStore   *store.CredentialStore
+	recoveryCodeStore *store.RecoveryCodeStore
+	inviteStore       *store.InviteStore
+}
+
+func newAuthFixture(t *testing.T) *authFixture {
+	t.Helper()
+
+	decoys, err := handlers.NewDecoyGenerator(bytes.Repeat([]byte("k"), 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := &authFixture{
+		userStore:         store.NewUserStore(),
+		sessionStore:      store.NewSessionStore(),
+		deviceStore:       store.NewDeviceStore(),
+		credentialStore:   store.NewCredentialStore(),
+		recoveryCodeStore: store.NewRecoveryCodeStore(),
+		inviteStore:       store.NewInviteStore(),
+	}
+	f.handler = handlers.NewAuthHandler(
+		f.userStore, f.sessionStore, store.NewRegistrationStore(f.inviteStore), f.deviceStore, f.credentialStore, f.recoveryCodeStore,
+		store.NewTOTPStore(), store.NewLockoutStore(), store.NewChallengeStore(),
+		decoys, username.DefaultPolicy, webauthntest.RelyingParty(),
+	)
+
+	return f
+}
+
+// callOption sets up the request context a handler is called with
+type callOption func(echo.Context)
+
+// asUser calls the handler as if the session middleware had authenticated userID
+func asUser(userID uuid.UUID) callOption {
+	return func(c echo.Context) {
+		c.Set(middleware.UserIDContextKey, userID)
+	}
+}
+
+// withCookie sends cookie with the request
+func withCookie(cookie *http.Cookie) callOption {
+	return func(c echo.Context) {
+		c.Request().AddCookie(cookie)
+	}
+}
+
+// call runs handler on a JSON request and turns a returned echo.HTTPError into the
+// status it would be served with
+func call(t *testing.T, handler echo.HandlerFunc, body any, opts ...callOption) *httptest.ResponseRecorder {
+	t.Helper()
+
+	raw, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(raw))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	if err := handler(c); err != nil {
+		var httpErr *echo.HTTPError
+		if !errors.As(err, &httpErr) {
+			t.Fatalf("handler returned %v", err)
+		}
+		rec.Code = httpErr.Code
+	}
+
+	return rec
+}
+
+func decodeJSON(t *testing.T, rec *httptest.ResponseRecorder, v any) {
+	t.Helper()
+
+	if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+		t.Fatalf("decode %q: %v", rec.Body.String(), err)
+	}
+}
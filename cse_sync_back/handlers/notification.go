@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/middleware"
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/store"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// NotificationHandler handles notification endpoints
+type NotificationHandler struct {
+	notificationStore *store.NotificationStore
+}
+
+// NewNotificationHandler creates a new NotificationHandler
+func NewNotificationHandler(notificationStore *store.NotificationStore) *NotificationHandler {
+	return &NotificationHandler{
+		notificationStore: notificationStore,
+	}
+}
+
+// GetNotifications returns the authenticated user's notifications, newest first
+func (h *NotificationHandler) GetNotifications(c echo.Context) error {
+	userID, ok := c.Get(middleware.UserIDContextKey).(uuid.UUID)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid session")
+	}
+
+	return c.JSON(http.StatusOK, h.notificationStore.FindByUserID(userID))
+}
+
+// MarkNotificationRead marks one of the authenticated user's notifications as read
+func (h *NotificationHandler) MarkNotificationRead(c echo.Context) error {
+	userID, ok := c.Get(middleware.UserIDContextKey).(uuid.UUID)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid session")
+	}
+
+	notificationID, err := uuid.Parse(c.Param("notificationID"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid notification id")
+	}
+
+	if !h.notificationStore.MarkRead(notificationID, userID) {
+		return echo.NewHTTPError(http.StatusNotFound, "notification not found")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
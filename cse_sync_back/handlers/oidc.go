@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/models"
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/oidc"
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/store"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// OIDCStateCookieName binds a pending authorization request to the browser that started it
+	OIDCStateCookieName = "oidc_state"
+	oidcStateCookiePath = "/api/oidc"
+
+	maxOIDCUsernameAttempts = 5
+)
+
+// OIDCBeginResponse tells the client where to send the user to sign in
+type OIDCBeginResponse struct {
+	AuthorizationURL string `json:"authorization_url"`
+}
+
+// OIDCFinishRequest carries the provider's redirect parameters and, like LoginRequest,
+// the device the client holds a wrapped UMK for. InviteToken is only read when the
+// sign-in creates an account and registration is invite-only.
+type OIDCFinishRequest struct {
+	Code        string `json:"code"`
+	State       string `json:"state"`
+	DeviceID    string `json:"device_id,omitempty"`
+	InviteToken string `json:"invite_token,omitempty"`
+}
+
+// EnableOIDC turns on single sign-on. Once enabled, new accounts can only be created
+// through the provider and accounts linked to it can no longer use Login.
+func (h *AuthHandler) EnableOIDC(provider *oidc.Provider, oidcLoginStore *store.OIDCLoginStore) {
+	h.oidcProvider = provider
+	h.oidcLoginStore = oidcLoginStore
+}
+
+// OIDCBegin starts an authorization code flow with PKCE
+func (h *AuthHandler) OIDCBegin(c echo.Context) error {
+	login := h.oidcLoginStore.Begin(oidc.NewCodeVerifier())
+
+	c.SetCookie(&http.Cookie{
+		Name:     OIDCStateCookieName,
+		Value:    login.State,
+		Expires:  login.ExpiresAt,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+		Path:     oidcStateCookiePath,
+	})
+
+	return c.JSON(http.StatusOK, OIDCBeginResponse{
+		AuthorizationURL: h.oidcProvider.AuthCodeURL(login.State, login.Nonce, login.CodeVerifier),
+	})
+}
+
+// OIDCFinish redeems the authorization code, maps the provider subject to a user,
+// creating one on first sign-in, and creates a session like Login does
+func (h *AuthHandler) OIDCFinish(c echo.Context) error {
+	var req OIDCFinishRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request")
+	}
+
+	if req.Code == "" || req.State == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "code and state are required")
+	}
+
+	cookie, err := c.Cookie(OIDCStateCookieName)
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(req.State)) != 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, "sign-in was not started from this browser")
+	}
+
+	c.SetCookie(&http.Cookie{
+		Name:     OIDCStateCookieName,
+		Value:    "",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+		Path:     oidcStateCookiePath,
+		MaxAge:   -1,
+	})
+
+	login, exists := h.oidcLoginStore.Consume(req.State)
+	if !exists {
+		return echo.NewHTTPError(http.StatusBadRequest, "sign-in request not found or expired")
+	}
+
+	ctx := c.Request().Context()
+
+	token, err := h.oidcProvider.Exchange(ctx, req.Code, login.CodeVerifier)
+	if err != nil {
+		c.Logger().Warn(err)
+		return echo.NewHTTPError(http.StatusUnauthorized, "failed to redeem authorization code")
+	}
+
+	idToken, err := h.oidcProvider.VerifyIDToken(ctx, token.IDToken, login.Nonce)
+	if err != nil {
+		c.Logger().Warn(err)
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid id token")
+	}
+
+	user, exists := h.userStore.FindByOIDCSubject(idToken.Issuer, idToken.Subject)
+	if !exists {
+		user, err = h.createOIDCUser(idToken, req.InviteToken)
+		if err != nil {
+			return err
+		}
+	}
+
+	var device *models.Device
+	if req.DeviceID != "" {
+		if deviceID, err := uuid.Parse(req.DeviceID); err == nil {
+			if foundDevice, ok := h.deviceStore.FindByID(deviceID); ok && foundDevice.UserID == user.ID {
+				device = foundDevice
+			}
+		}
+	}
+
+	return h.startLoginSession(c, user, device)
+}
+
+// createOIDCUser registers the user behind a first-time provider sign-in, subject to
+// the registration mode like RegisterInit. The username comes from preferred_username
+// or the email local part, falling back to sso-user when the username policy rejects
+// it, with a numeric suffix on clashes.
+func (h *AuthHandler) createOIDCUser(idToken *oidc.IDToken, inviteToken string) (*models.User, error) {
+	switch h.registrationMode {
+	case models.RegistrationModeClosed:
+		return nil, echo.NewHTTPError(http.StatusForbidden, "registration is closed")
+	case models.RegistrationModeInvite:
+		invite, err := h.inviteStore.Reserve(inviteToken)
+		if err != nil {
+			return nil, echo.NewHTTPError(http.StatusForbidden, "a valid invite is required to register")
+		}
+
+		user, err := h.createOIDCUserWithUsername(idToken)
+		if err != nil {
+			h.inviteStore.Release(invite.ID)
+			return nil, err
+		}
+		h.inviteStore.Commit(invite.ID)
+		return user, nil
+	}
+
+	return h.createOIDCUserWithUsername(idToken)
+}
+
+func (h *AuthHandler) createOIDCUserWithUsername(idToken *oidc.IDToken) (*models.User, error) {
+	base := idToken.PreferredUsername
+	if base == "" && idToken.EmailVerified {
+		base, _, _ = strings.Cut(idToken.Email, "@")
+	}
+	if normalized, err := h.usernamePolicy.Normalize(base); err == nil {
+		base = normalized
+	} else {
+		base = "sso-user"
+	}
+
+	username := base
+	for attempt := range maxOIDCUsernameAttempts {
+		if attempt > 0 {
+			username = fmt.Sprintf("%s-%d", base, attempt+1)
+		}
+
+		user, err := h.userStore.CreateOIDCUser(username, idToken.Issuer, idToken.Subject)
+		if err == nil {
+			return user, nil
+		}
+		if !errors.Is(err, store.ErrUsernameTaken) {
+			return nil, echo.NewHTTPError(http.StatusInternalServerError, "failed to create user")
+		}
+	}
+
+	return nil, echo.NewHTTPError(http.StatusConflict, "could not choose a free username")
+}
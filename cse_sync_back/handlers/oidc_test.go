@@ -0,0 +1,227 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/handlers"
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/models"
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/oidc"
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/oidc/oidctest"
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/store"
+)
+
+const testClientID = "cse-sync"
+
+// oidcFixture is an AuthHandler with single sign-on through a test provider
+type oidcFixture struct {
+	*authFixture
+	idp *oidctest.Server
+}
+
+func newOIDCFixture(t *testing.T) *oidcFixture {
+	t.Helper()
+
+	idp := oidctest.NewServer(t, testClientID)
+	provider, err := oidc.Discover(context.Background(), oidc.Config{
+		Issuer:      idp.Issuer(),
+		ClientID:    testClientID,
+		RedirectURL: "http://localhost:5173/oidc/callback",
+		HTTPClient:  idp.Client(),
+	})
+	if err != nil {
+		t.Fatalf("Discover: %v", err)
+	}
+
+	f := &oidcFixture{authFixture: newAuthFixture(t), idp: idp}
+	f.handler.EnableOIDC(provider, store.NewOIDCLoginStore())
+
+	return f
+}
+
+// pendingSignIn is a sign-in the provider has redirected back from
+type pendingSignIn struct {
+	cookie *http.Cookie
+	code   string
+	state  string
+}
+
+// begin starts a sign-in and has the user sign in at the provider with claims
+func (f *oidcFixture) begin(t *testing.T, claims map[string]any) pendingSignIn {
+	t.Helper()
+
+	rec := call(t, f.handler.OIDCBegin, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("OIDCBegin status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	var begin handlers.OIDCBeginResponse
+	decodeJSON(t, rec, &begin)
+
+	var cookie *http.Cookie
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == handlers.OIDCStateCookieName {
+			cookie = c
+		}
+	}
+	if cookie == nil {
+		t.Fatal("OIDCBegin set no state cookie")
+	}
+
+	code, state := f.idp.Authorize(t, begin.AuthorizationURL, claims)
+	return pendingSignIn{cookie: cookie, code: code, state: state}
+}
+
+func (f *oidcFixture) finish(t *testing.T, signIn pendingSignIn, req handlers.OIDCFinishRequest) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req.Code = signIn.code
+	req.State = signIn.state
+	return call(t, f.handler.OIDCFinish, req, withCookie(signIn.cookie))
+}
+
+// signIn runs a whole sign-in and decodes the login response
+func (f *oidcFixture) signIn(t *testing.T, claims map[string]any, req handlers.OIDCFinishRequest) handlers.LoginResponse {
+	t.Helper()
+
+	rec := f.finish(t, f.begin(t, claims), req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("OIDCFinish status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+
+	var login handlers.LoginResponse
+	decodeJSON(t, rec, &login)
+	return login
+}
+
+func TestOIDCFinishMapsSubjectsToUsers(t *testing.T) {
+	f := newOIDCFixture(t)
+
+	first := f.signIn(t, map[string]any{"sub": "subject-1", "preferred_username": "alice"}, handlers.OIDCFinishRequest{})
+	if first.Username != "alice" {
+		t.Errorf("username = %q, want %q", first.Username, "alice")
+	}
+
+	user, exists := f.userStore.FindByOIDCSubject(f.idp.Issuer(), "subject-1")
+	if !exists || user.ID != first.UserID {
+		t.Fatalf("subject-1 maps to %v, want user %s", user, first.UserID)
+	}
+
+	again := f.signIn(t, map[string]any{"sub": "subject-1", "preferred_username": "renamed"}, handlers.OIDCFinishRequest{})
+	if again.UserID != first.UserID || again.Username != "alice" {
+		t.Errorf("second sign-in = %s %q, want the existing user %s %q", again.UserID, again.Username, first.UserID, "alice")
+	}
+
+	other := f.signIn(t, map[string]any{"sub": "subject-2", "preferred_username": "alice"}, handlers.OIDCFinishRequest{})
+	if other.UserID == first.UserID {
+		t.Error("another subject signed in as the first user")
+	}
+	if other.Username != "alice-2" {
+		t.Errorf("username of clashing subject = %q, want %q", other.Username, "alice-2")
+	}
+}
+
+func TestOIDCFinishReportsDeviceAndRecovery(t *testing.T) {
+	f := newOIDCFixture(t)
+	claims := map[string]any{"sub": "subject-1", "preferred_username": "alice"}
+
+	first := f.signIn(t, claims, handlers.OIDCFinishRequest{})
+	if !first.RequiresDeviceRegistration || first.RecoveryAvailable || first.DeviceID != nil {
+		t.Errorf("first sign-in = %+v, want device registration required and no recovery", first)
+	}
+
+	device := f.deviceStore.Create(first.UserID, "wrapped-umk", models.LegacyDeviceWrap)
+	if _, ok := f.userStore.UpdateRecoveryData(first.UserID, "wrapped", "salt", "iv", models.DefaultKDFPolicy.Recommended); !ok {
+		t.Fatal("UpdateRecoveryData failed")
+	}
+
+	known := f.signIn(t, claims, handlers.OIDCFinishRequest{DeviceID: device.ID.String()})
+	if known.RequiresDeviceRegistration || !known.DeviceVerified || known.DeviceID == nil || *known.DeviceID != device.ID.String() {
+		t.Errorf("sign-in from the registered device = %+v, want device %s verified", known, device.ID)
+	}
+	if !known.RecoveryAvailable {
+		t.Error("recovery_available = false after recovery data was stored")
+	}
+
+	stranger := f.userStore.Create("mallory")
+	foreign := f.deviceStore.Create(stranger.ID, "wrapped-umk", models.LegacyDeviceWrap)
+	borrowed := f.signIn(t, claims, handlers.OIDCFinishRequest{DeviceID: foreign.ID.String()})
+	if !borrowed.RequiresDeviceRegistration || borrowed.DeviceID != nil {
+		t.Errorf("sign-in with another user's device = %+v, want device registration required", borrowed)
+	}
+}
+
+func TestOIDCFinishRejectsStateMismatch(t *testing.T) {
+	f := newOIDCFixture(t)
+	claims := map[string]any{"sub": "subject-1"}
+
+	first := f.begin(t, claims)
+	second := f.begin(t, claims)
+
+	crossed := pendingSignIn{cookie: first.cookie, code: second.code, state: second.state}
+	if rec := f.finish(t, crossed, handlers.OIDCFinishRequest{}); rec.Code != http.StatusBadRequest {
+		t.Errorf("state from another browser: status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+
+	if rec := f.finish(t, first, handlers.OIDCFinishRequest{}); rec.Code != http.StatusOK {
+		t.Fatalf("OIDCFinish status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if rec := f.finish(t, first, handlers.OIDCFinishRequest{}); rec.Code != http.StatusBadRequest {
+		t.Errorf("replayed state: status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestOIDCFinishRejectsInvalidIDTokens(t *testing.T) {
+	f := newOIDCFixture(t)
+
+	tests := map[string]map[string]any{
+		"nonce of another sign-in": {"nonce": "another nonce"},
+		"another audience":         {"aud": "another-client"},
+		"another issuer":           {"iss": "https://evil.example"},
+		"expired":                  {"exp": time.Now().Add(-time.Hour).Unix()},
+	}
+
+	for name, overrides := range tests {
+		t.Run(name, func(t *testing.T) {
+			claims := map[string]any{"sub": "subject-1"}
+			for claim, value := range overrides {
+				claims[claim] = value
+			}
+
+			if rec := f.finish(t, f.begin(t, claims), handlers.OIDCFinishRequest{}); rec.Code != http.StatusUnauthorized {
+				t.Errorf("status = %d, want %d", rec.Code, http.StatusUnauthorized)
+			}
+			if _, exists := f.userStore.FindByOIDCSubject(f.idp.Issuer(), "subject-1"); exists {
+				t.Error("a user was created for a rejected id token")
+			}
+		})
+	}
+}
+
+func TestOIDCFinishAppliesRegistrationMode(t *testing.T) {
+	f := newOIDCFixture(t)
+
+	existing := f.signIn(t, map[string]any{"sub": "subject-1"}, handlers.OIDCFinishRequest{})
+
+	f.handler.SetRegistrationMode(models.RegistrationModeClosed, f.inviteStore)
+	if rec := f.finish(t, f.begin(t, map[string]any{"sub": "subject-2"}), handlers.OIDCFinishRequest{}); rec.Code != http.StatusForbidden {
+		t.Errorf("new subject while closed: status = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+	if again := f.signIn(t, map[string]any{"sub": "subject-1"}, handlers.OIDCFinishRequest{}); again.UserID != existing.UserID {
+		t.Errorf("existing subject while closed signed in as %s, want %s", again.UserID, existing.UserID)
+	}
+
+	f.handler.SetRegistrationMode(models.RegistrationModeInvite, f.inviteStore)
+	_, token := f.inviteStore.Create("", 1, time.Hour)
+
+	if rec := f.finish(t, f.begin(t, map[string]any{"sub": "subject-2"}), handlers.OIDCFinishRequest{}); rec.Code != http.StatusForbidden {
+		t.Errorf("new subject without invite: status = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+	f.signIn(t, map[string]any{"sub": "subject-2"}, handlers.OIDCFinishRequest{InviteToken: token})
+	if rec := f.finish(t, f.begin(t, map[string]any{"sub": "subject-3"}), handlers.OIDCFinishRequest{InviteToken: token}); rec.Code != http.StatusForbidden {
+		t.Errorf("new subject with a used-up invite: status = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+}
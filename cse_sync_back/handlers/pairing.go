@@ -0,0 +1,282 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/middleware"
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/models"
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/store"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	PairingTokenHeader = "X-Pairing-Token"
+
+	pairingCodeDigits     = 8
+	pairingCodeRetries    = 5
+	pairingMaxPayloadSize = 64 * 1024
+)
+
+// PairingHandler handles short-code device pairing
+type PairingHandler struct {
+	pairingStore *store.PairingStore
+	pairingURL   string
+}
+
+// NewPairingHandler creates a new PairingHandler. pairingURL is the frontend page
+// the QR code points to; the code is appended as a query parameter.
+func NewPairingHandler(pairingStore *store.PairingStore, pairingURL string) *PairingHandler {
+	return &PairingHandler{
+		pairingStore: pairingStore,
+		pairingURL:   pairingURL,
+	}
+}
+
+// PairingCreateResponse is returned to the device that starts pairing
+type PairingCreateResponse struct {
+	PairingID uuid.UUID `json:"pairing_id"`
+	Code      string    `json:"code"`
+	URI       string    `json:"uri"`
+	RedeemBy  time.Time `json:"redeem_by"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// PairingRedeemRequest represents a new device entering or scanning a code
+type PairingRedeemRequest struct {
+	Code string `json:"code"`
+}
+
+// PairingRedeemResponse hands the new device the token it uses for the exchange
+type PairingRedeemResponse struct {
+	PairingID uuid.UUID `json:"pairing_id"`
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// PairingMessageRequest carries an opaque encrypted payload
+type PairingMessageRequest struct {
+	Payload string `json:"payload"`
+}
+
+// CreatePairing starts a pairing session for the authenticated device
+func (h *PairingHandler) CreatePairing(c echo.Context) error {
+	userID, ok := c.Get(middleware.UserIDContextKey).(uuid.UUID)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid session")
+	}
+
+	sessionID, ok := c.Get(middleware.SessionIDContextKey).(string)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid session")
+	}
+
+	var pairing *models.PairingSession
+	for range pairingCodeRetries {
+		code, err := generateNumericCode(pairingCodeDigits)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to generate pairing code")
+		}
+
+		pairing, err = h.pairingStore.Create(userID, sessionID, code)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, store.ErrPairingCodeInUse) {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to create pairing session")
+		}
+	}
+
+	if pairing == nil {
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "no pairing code available, try again")
+	}
+
+	return c.JSON(http.StatusCreated, PairingCreateResponse{
+		PairingID: pairing.ID,
+		Code:      pairing.Code,
+		URI:       h.pairingURL + "?code=" + url.QueryEscape(pairing.Code),
+		RedeemBy:  pairing.RedeemBy,
+		ExpiresAt: pairing.ExpiresAt,
+	})
+}
+
+// RedeemPairing lets a new device claim a pairing session by its code
+func (h *PairingHandler) RedeemPairing(c echo.Context) error {
+	var req PairingRedeemRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request")
+	}
+
+	if req.Code == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "code is required")
+	}
+
+	token := rand.Text()
+
+	pairing, err := h.pairingStore.Redeem(req.Code, token, c.RealIP())
+	if err != nil {
+		if errors.Is(err, store.ErrPairingRedeemThrottled) {
+			return echo.NewHTTPError(http.StatusTooManyRequests, "too many failed attempts, try again later")
+		}
+		return echo.NewHTTPError(http.StatusNotFound, "invalid or expired pairing code")
+	}
+
+	return c.JSON(http.StatusOK, PairingRedeemResponse{
+		PairingID: pairing.ID,
+		Token:     token,
+		ExpiresAt: pairing.ExpiresAt,
+	})
+}
+
+// GetPairing reports the status of a pairing session to its initiator
+func (h *PairingHandler) GetPairing(c echo.Context) error {
+	pairing, err := h.initiatorPairing(c)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, pairing)
+}
+
+// DeletePairing lets the initiator cancel a pairing session
+func (h *PairingHandler) DeletePairing(c echo.Context) error {
+	pairing, err := h.initiatorPairing(c)
+	if err != nil {
+		return err
+	}
+
+	h.pairingStore.Delete(pairing.ID)
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// InitiatorSendMessage relays a payload from the initiating device
+func (h *PairingHandler) InitiatorSendMessage(c echo.Context) error {
+	pairing, err := h.initiatorPairing(c)
+	if err != nil {
+		return err
+	}
+
+	return h.sendMessage(c, pairing, models.PairingSenderInitiator)
+}
+
+// InitiatorGetMessages returns payloads the new device sent to the initiator
+func (h *PairingHandler) InitiatorGetMessages(c echo.Context) error {
+	pairing, err := h.initiatorPairing(c)
+	if err != nil {
+		return err
+	}
+
+	return h.getMessages(c, pairing, models.PairingSenderInitiator)
+}
+
+// PeerSendMessage relays a payload from the new device
+func (h *PairingHandler) PeerSendMessage(c echo.Context) error {
+	pairing, err := h.peerPairing(c)
+	if err != nil {
+		return err
+	}
+
+	return h.sendMessage(c, pairing, models.PairingSenderPeer)
+}
+
+// PeerGetMessages returns payloads the initiator sent to the new device
+func (h *PairingHandler) PeerGetMessages(c echo.Context) error {
+	pairing, err := h.peerPairing(c)
+	if err != nil {
+		return err
+	}
+
+	return h.getMessages(c, pairing, models.PairingSenderPeer)
+}
+
+func (h *PairingHandler) sendMessage(c echo.Context, pairing *models.PairingSession, sender string) error {
+	var req PairingMessageRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request")
+	}
+
+	if req.Payload == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "payload is required")
+	}
+
+	if len(req.Payload) > pairingMaxPayloadSize {
+		return echo.NewHTTPError(http.StatusRequestEntityTooLarge, "payload too large")
+	}
+
+	message, err := h.pairingStore.AppendMessage(pairing.ID, sender, req.Payload)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrPairingNotRedeemed):
+			return echo.NewHTTPError(http.StatusConflict, "pairing code has not been redeemed yet")
+		case errors.Is(err, store.ErrPairingMailboxFull):
+			return echo.NewHTTPError(http.StatusConflict, "pairing message limit reached")
+		}
+		return echo.NewHTTPError(http.StatusNotFound, "pairing session not found")
+	}
+
+	return c.JSON(http.StatusCreated, message)
+}
+
+func (h *PairingHandler) getMessages(c echo.Context, pairing *models.PairingSession, recipient string) error {
+	after := 0
+	if afterParam := c.QueryParam("after"); afterParam != "" {
+		parsed, err := strconv.Atoi(afterParam)
+		if err != nil || parsed < 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid after parameter")
+		}
+		after = parsed
+	}
+
+	messages, err := h.pairingStore.MessagesFor(pairing.ID, recipient, after)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "pairing session not found")
+	}
+
+	return c.JSON(http.StatusOK, messages)
+}
+
+func (h *PairingHandler) initiatorPairing(c echo.Context) (*models.PairingSession, error) {
+	userID, ok := c.Get(middleware.UserIDContextKey).(uuid.UUID)
+	if !ok {
+		return nil, echo.NewHTTPError(http.StatusUnauthorized, "invalid session")
+	}
+
+	sessionID, _ := c.Get(middleware.SessionIDContextKey).(string)
+
+	pairingID, err := uuid.Parse(c.Param("pairingID"))
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "invalid pairing id")
+	}
+
+	pairing, exists := h.pairingStore.FindForInitiator(pairingID, userID, sessionID)
+	if !exists {
+		return nil, echo.NewHTTPError(http.StatusNotFound, "pairing session not found")
+	}
+
+	return pairing, nil
+}
+
+func (h *PairingHandler) peerPairing(c echo.Context) (*models.PairingSession, error) {
+	pairingID, err := uuid.Parse(c.Param("pairingID"))
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "invalid pairing id")
+	}
+
+	token := c.Request().Header.Get(PairingTokenHeader)
+	if token == "" {
+		return nil, echo.NewHTTPError(http.StatusUnauthorized, "pairing token required")
+	}
+
+	pairing, exists := h.pairingStore.FindForPeer(pairingID, token)
+	if !exists {
+		return nil, echo.NewHTTPError(http.StatusNotFound, "pairing session not found")
+	}
+
+	return pairing, nil
+}
@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/middleware"
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/models"
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/store"
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/username"
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/webauthn"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// PasskeyRegisterBeginRequest selects the device the new passkey is linked to
+type PasskeyRegisterBeginRequest struct {
+	DeviceID string `json:"device_id"`
+}
+
+// PasskeyRegisterResponse describes a newly registered passkey
+type PasskeyRegisterResponse struct {
+	CredentialID string    `json:"credential_id"`
+	DeviceID     uuid.UUID `json:"device_id"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// PasskeyLoginBeginRequest optionally names the user; without it a discoverable credential is expected
+type PasskeyLoginBeginRequest struct {
+	Username string `json:"username,omitempty"`
+}
+
+// PasskeyRegisterBegin starts a WebAuthn registration ceremony for the session user
+func (h *AuthHandler) PasskeyRegisterBegin(c echo.Context) error {
+	userID, ok := c.Get(middleware.UserIDContextKey).(uuid.UUID)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid session")
+	}
+
+	var req PasskeyRegisterBeginRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request")
+	}
+
+	deviceID, err := uuid.Parse(req.DeviceID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid device id")
+	}
+
+	device, exists := h.deviceStore.FindByID(deviceID)
+	if !exists {
+		return echo.NewHTTPError(http.StatusNotFound, "device not found")
+	}
+
+	if device.UserID != userID {
+		return echo.NewHTTPError(http.StatusForbidden, "device does not belong to session user")
+	}
+
+	user, exists := h.userStore.FindByID(userID)
+	if !exists {
+		return echo.NewHTTPError(http.StatusNotFound, "user not found")
+	}
+
+	challenge := webauthn.NewChallenge()
+
+	h.credentialStore.BeginCeremony(models.PasskeyCeremonyRegistration, challenge, user.ID, device.ID)
+
+	options := h.relyingParty.CreationOptions(challenge, webauthn.UserEntity{
+		ID:          webauthn.EncodeBase64URL(user.ID[:]),
+		Name:        user.Username,
+		DisplayName: user.Username,
+	}, credentialDescriptors(h.credentialStore.FindByUserID(user.ID)))
+
+	return c.JSON(http.StatusOK, options)
+}
+
+// PasskeyRegisterFinish verifies the attestation and stores the new credential
+func (h *AuthHandler) PasskeyRegisterFinish(c echo.Context) error {
+	userID, ok := c.Get(middleware.UserIDContextKey).(uuid.UUID)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid session")
+	}
+
+	var req webauthn.AttestationResponse
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request")
+	}
+
+	challenge, err := webauthn.ChallengeFromClientData(req.Response.ClientDataJSON)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	ceremony, exists := h.credentialStore.ConsumeCeremony(models.PasskeyCeremonyRegistration, challenge)
+	if !exists || ceremony.UserID != userID {
+		return echo.NewHTTPError(http.StatusBadRequest, "registration ceremony not found or expired")
+	}
+
+	device, exists := h.deviceStore.FindByID(ceremony.DeviceID)
+	if !exists || device.UserID != userID {
+		return echo.NewHTTPError(http.StatusNotFound, "device not found")
+	}
+
+	authData, err := h.relyingParty.VerifyRegistration(&req, ceremony.Challenge)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	credential := &models.Credential{
+		ID:         webauthn.EncodeBase64URL(authData.CredentialID),
+		UserID:     userID,
+		DeviceID:   device.ID,
+		PublicKey:  authData.PublicKey,
+		SignCount:  authData.SignCount,
+		AAGUID:     authData.AAGUID,
+		Transports: req.Response.Transports,
+	}
+
+	if err := h.credentialStore.Create(credential); err != nil {
+		if errors.Is(err, store.ErrCredentialExists) {
+			return echo.NewHTTPError(http.StatusConflict, "credential already registered")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to persist credential")
+	}
+
+	return c.JSON(http.StatusCreated, PasskeyRegisterResponse{
+		CredentialID: credential.ID,
+		DeviceID:     credential.DeviceID,
+		CreatedAt:    credential.CreatedAt,
+	})
+}
+
+// PasskeyLoginBegin starts a WebAuthn authentication ceremony
+func (h *AuthHandler) PasskeyLoginBegin(c echo.Context) error {
+	start := time.Now()
+	defer padResponseTime(start)
+
+	var req PasskeyLoginBeginRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request")
+	}
+
+	var userID uuid.UUID
+	var allow []webauthn.CredentialDescriptor
+	if req.Username != "" {
+		name := username.Fold(req.Username)
+		if user, exists := h.userStore.FindByUsername(name); exists {
+			userID = user.ID
+			allow = credentialDescriptors(h.credentialStore.FindByUserID(user.ID))
+		}
+		// Unknown usernames, and accounts without passkeys, are offered a decoy
+		// credential that no authenticator holds, so the options look like any other
+		if len(allow) == 0 {
+			if userID == uuid.Nil {
+				userID = h.decoys.UserID(name)
+			}
+			allow = []webauthn.CredentialDescriptor{h.decoys.CredentialDescriptor(name)}
+		}
+	}
+
+	challenge := webauthn.NewChallenge()
+
+	h.credentialStore.BeginCeremony(models.PasskeyCeremonyLogin, challenge, userID, uuid.Nil)
+
+	return c.JSON(http.StatusOK, h.relyingParty.RequestOptions(challenge, allow))
+}
+
+// PasskeyLoginFinish verifies the assertion and creates a session like Login does
+func (h *AuthHandler) PasskeyLoginFinish(c echo.Context) error {
+	var req webauthn.AssertionResponse
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request")
+	}
+
+	challenge, err := webauthn.ChallengeFromClientData(req.Response.ClientDataJSON)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	ceremony, exists := h.credentialStore.ConsumeCeremony(models.PasskeyCeremonyLogin, challenge)
+	if !exists {
+		return echo.NewHTTPError(http.StatusBadRequest, "login ceremony not found or expired")
+	}
+
+	rawID, err := webauthn.DecodeBase64URL(req.RawID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid credential id")
+	}
+
+	credential, exists := h.credentialStore.FindByID(webauthn.EncodeBase64URL(rawID))
+	if !exists {
+		return echo.NewHTTPError(http.StatusUnauthorized, "unknown credential")
+	}
+
+	if ceremony.UserID != uuid.Nil && ceremony.UserID != credential.UserID {
+		return echo.NewHTTPError(http.StatusUnauthorized, "credential does not belong to user")
+	}
+
+	if req.Response.UserHandle != "" {
+		userHandle, err := webauthn.DecodeBase64URL(req.Response.UserHandle)
+		if err != nil || !bytes.Equal(userHandle, credential.UserID[:]) {
+			return echo.NewHTTPError(http.StatusUnauthorized, "user handle mismatch")
+		}
+	} else if ceremony.UserID == uuid.Nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "user handle is required")
+	}
+
+	authData, err := h.relyingParty.VerifyAssertion(&req, ceremony.Challenge, credential.PublicKey)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+
+	if err := h.credentialStore.UpdateSignCount(credential.ID, authData.SignCount); err != nil {
+		if errors.Is(err, store.ErrSignCountRegression) {
+			return echo.NewHTTPError(http.StatusUnauthorized, "credential sign count regressed; authenticator may be cloned")
+		}
+		return echo.NewHTTPError(http.StatusUnauthorized, "unknown credential")
+	}
+
+	user, exists := h.userStore.FindByID(credential.UserID)
+	if !exists {
+		return echo.NewHTTPError(http.StatusUnauthorized, "user not found")
+	}
+
+	var device *models.Device
+	if foundDevice, ok := h.deviceStore.FindByID(credential.DeviceID); ok && foundDevice.UserID == user.ID {
+		device = foundDevice
+	}
+
+	return h.startLoginSession(c, user, device)
+}
+
+func credentialDescriptors(credentials []*models.Credential) []webauthn.CredentialDescriptor {
+	descriptors := make([]webauthn.CredentialDescriptor, 0, len(credentials))
+	for _, credential := range credentials {
+		descriptors = append(descriptors, webauthn.CredentialDescriptor{
+			Type:       "public-key",
+			ID:         credential.ID,
+			Transports: credential.Transports,
+		})
+	}
+	return descriptors
+}
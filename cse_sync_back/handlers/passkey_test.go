@@ -0,0 +1,187 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/handlers"
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/models"
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/webauthn"
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/webauthn/webauthntest"
+)
+
+// passkeyFixture is an AuthHandler with one user, their device and a passkey
+// registered through the handlers
+type passkeyFixture struct {
+	*authFixture
+	user          *models.User
+	device        *models.Device
+	authenticator *webauthntest.Authenticator
+}
+
+func newPasskeyFixture(t *testing.T) *passkeyFixture {
+	t.Helper()
+
+	f := &passkeyFixture{
+		authFixture:   newAuthFixture(t),
+		authenticator: webauthntest.NewAuthenticator(t),
+	}
+	f.user = f.userStore.Create("alice")
+	f.device = f.deviceStore.Create(f.user.ID, "wrapped-umk", models.LegacyDeviceWrap)
+	f.authenticator.UserHandle = f.user.ID[:]
+
+	rec := call(t, f.handler.PasskeyRegisterBegin, handlers.PasskeyRegisterBeginRequest{DeviceID: f.device.ID.String()}, asUser(f.user.ID))
+	var options webauthn.CreationOptions
+	decodeJSON(t, rec, &options)
+
+	rec = call(t, f.handler.PasskeyRegisterFinish, f.authenticator.Attest(options.Challenge, webauthntest.Ceremony{}), asUser(f.user.ID))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("PasskeyRegisterFinish status = %d, want %d", rec.Code, http.StatusCreated)
+	}
+
+	return f
+}
+
+// loginChallenge starts a passkey login for the fixture's user
+func (f *passkeyFixture) loginChallenge(t *testing.T) string {
+	t.Helper()
+
+	rec := call(t, f.handler.PasskeyLoginBegin, handlers.PasskeyLoginBeginRequest{Username: f.user.Username})
+	var options webauthn.RequestOptions
+	decodeJSON(t, rec, &options)
+	return options.Challenge
+}
+
+func (f *passkeyFixture) passkeyLogin(t *testing.T, tamper func(*webauthn.AssertionResponse)) *httptest.ResponseRecorder {
+	t.Helper()
+
+	resp := f.authenticator.Assert(t, f.loginChallenge(t), webauthntest.Ceremony{})
+	if tamper != nil {
+		tamper(resp)
+	}
+	return call(t, f.handler.PasskeyLoginFinish, resp)
+}
+
+func TestPasskeyRegisterRejectsForeignDevice(t *testing.T) {
+	f := newPasskeyFixture(t)
+
+	stranger := f.userStore.Create("mallory")
+	rec := call(t, f.handler.PasskeyRegisterBegin, handlers.PasskeyRegisterBeginRequest{DeviceID: f.device.ID.String()}, asUser(stranger.ID))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+}
+
+func TestPasskeyLogin(t *testing.T) {
+	f := newPasskeyFixture(t)
+
+	f.authenticator.SignCount = 1
+	rec := f.passkeyLogin(t, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("PasskeyLoginFinish status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	var login handlers.LoginResponse
+	decodeJSON(t, rec, &login)
+	if login.UserID != f.user.ID || login.DeviceID == nil || *login.DeviceID != f.device.ID.String() {
+		t.Errorf("login = %+v, want user %s on device %s", login, f.user.ID, f.device.ID)
+	}
+}
+
+func TestPasskeyLoginRejectsSignCountRegression(t *testing.T) {
+	f := newPasskeyFixture(t)
+
+	f.authenticator.SignCount = 5
+	if rec := f.passkeyLogin(t, nil); rec.Code != http.StatusOK {
+		t.Fatalf("first login status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	for _, signCount := range []uint32{5, 4} {
+		f.authenticator.SignCount = signCount
+		if rec := f.passkeyLogin(t, nil); rec.Code != http.StatusUnauthorized {
+			t.Errorf("login with sign count %d: status = %d, want %d", signCount, rec.Code, http.StatusUnauthorized)
+		}
+	}
+}
+
+func TestPasskeyLoginRejectsUnknownCredential(t *testing.T) {
+	f := newPasskeyFixture(t)
+
+	rec := f.passkeyLogin(t, func(resp *webauthn.AssertionResponse) {
+		resp.RawID = webauthn.EncodeBase64URL([]byte("unregistered credential"))
+	})
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestPasskeyLoginRejectsWrongOrigin(t *testing.T) {
+	f := newPasskeyFixture(t)
+
+	resp := f.authenticator.Assert(t, f.loginChallenge(t), webauthntest.Ceremony{Origin: "https://evil.example"})
+	if rec := call(t, f.handler.PasskeyLoginFinish, resp); rec.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestPasskeyLoginMatchesLoginResponse(t *testing.T) {
+	f := newPasskeyFixture(t)
+
+	f.authenticator.SignCount = 1
+	passkey := f.passkeyLogin(t, nil)
+	password := call(t, f.handler.Login, handlers.LoginRequest{
+		Username: f.user.Username,
+		DeviceID: f.device.ID.String(),
+	})
+
+	if passkey.Code != password.Code {
+		t.Fatalf("status = %d, Login gave %d", passkey.Code, password.Code)
+	}
+
+	var fromPasskey, fromLogin map[string]any
+	decodeJSON(t, passkey, &fromPasskey)
+	decodeJSON(t, password, &fromLogin)
+
+	// Each login gets its own CSRF token; everything else describes the same account
+	delete(fromPasskey, "csrf_token")
+	delete(fromLogin, "csrf_token")
+
+	passkeyJSON, _ := json.Marshal(fromPasskey)
+	loginJSON, _ := json.Marshal(fromLogin)
+	if !bytes.Equal(passkeyJSON, loginJSON) {
+		t.Errorf("PasskeyLoginFinish = %s, Login = %s", passkeyJSON, loginJSON)
+	}
+}
+
+func TestPasskeyLoginBeginOffersDecoyCredential(t *testing.T) {
+	f := newPasskeyFixture(t)
+	f.userStore.Create("bob")
+
+	for _, name := range []string{"bob", "nobody"} {
+		rec := call(t, f.handler.PasskeyLoginBegin, handlers.PasskeyLoginBeginRequest{Username: name})
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d, want %d", name, rec.Code, http.StatusOK)
+		}
+
+		var options webauthn.RequestOptions
+		decodeJSON(t, rec, &options)
+		if len(options.AllowCredentials) != 1 {
+			t.Fatalf("%s: allowCredentials = %+v, want one credential", name, options.AllowCredentials)
+		}
+
+		var again webauthn.RequestOptions
+		decodeJSON(t, call(t, f.handler.PasskeyLoginBegin, handlers.PasskeyLoginBeginRequest{Username: name}), &again)
+		if again.AllowCredentials[0].ID != options.AllowCredentials[0].ID {
+			t.Errorf("%s: decoy credential changed between requests", name)
+		}
+
+		// No authenticator holds the decoy, so this one's assertion is refused
+		resp := f.authenticator.Assert(t, options.Challenge, webauthntest.Ceremony{})
+		if rec := call(t, f.handler.PasskeyLoginFinish, resp); rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s: PasskeyLoginFinish status = %d, want %d", name, rec.Code, http.StatusUnauthorized)
+		}
+	}
+}
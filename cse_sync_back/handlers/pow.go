@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/store"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// PoWAlgorithm names the hash clients must use to solve a challenge
+const PoWAlgorithm = "sha256"
+
+// PoWHandler hands out proof-of-work challenges for middleware.ProofOfWorkMiddleware
+type PoWHandler struct {
+	powStore *store.PoWStore
+}
+
+// NewPoWHandler creates a new PoWHandler
+func NewPoWHandler(powStore *store.PoWStore) *PoWHandler {
+	return &PoWHandler{
+		powStore: powStore,
+	}
+}
+
+// PoWChallengeResponse describes a puzzle: find a nonce such that
+// SHA-256(seed + ":" + nonce) starts with difficulty zero bits
+type PoWChallengeResponse struct {
+	ID         uuid.UUID `json:"id"`
+	Algorithm  string    `json:"algorithm"`
+	Seed       string    `json:"seed"`
+	Difficulty int       `json:"difficulty"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// CreateChallenge issues a challenge whose difficulty depends on how many the
+// caller's address requested recently
+func (h *PoWHandler) CreateChallenge(c echo.Context) error {
+	challenge := h.powStore.Issue(c.RealIP())
+
+	return c.JSON(http.StatusCreated, PoWChallengeResponse{
+		ID:         challenge.ID,
+		Algorithm:  PoWAlgorithm,
+		Seed:       challenge.Seed,
+		Difficulty: challenge.Difficulty,
+		ExpiresAt:  challenge.ExpiresAt,
+	})
+}
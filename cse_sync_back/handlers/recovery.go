@@ -0,0 +1,442 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/middleware"
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/models"
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/store"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// RecoveryRollbackWindow is how long a replaced recovery payload can be restored
+	RecoveryRollbackWindow = 24 * time.Hour
+
+	macKeyLength = 32
+)
+
+var (
+	// recoveryUserPolicy limits how often one account's recovery payload is released
+	recoveryUserPolicy = store.LockoutPolicy{
+		Limit:       5,
+		Window:      time.Hour,
+		BaseLockout: time.Minute,
+		MaxLockout:  24 * time.Hour,
+	}
+	// recoveryIPPolicy limits recovery fetches from one client address across accounts
+	recoveryIPPolicy = store.LockoutPolicy{
+		Limit:       20,
+		Window:      time.Hour,
+		BaseLockout: time.Minute,
+		MaxLockout:  24 * time.Hour,
+	}
+)
+
+// RecoveryHandler handles UMK recovery through the passphrase payload and recovery codes
+type RecoveryHandler struct {
+	userStore         *store.UserStore
+	challengeStore    *store.ChallengeStore
+	lockoutStore      *store.LockoutStore
+	auditStore        *store.AuditStore
+	recoveryCodeStore *store.RecoveryCodeStore
+	decoys            *DecoyGenerator
+}
+
+// NewRecoveryHandler creates a new RecoveryHandler
+func NewRecoveryHandler(userStore *store.UserStore, challengeStore *store.ChallengeStore, lockoutStore *store.LockoutStore, auditStore *store.AuditStore, recoveryCodeStore *store.RecoveryCodeStore, decoys *DecoyGenerator) *RecoveryHandler {
+	return &RecoveryHandler{
+		userStore:         userStore,
+		challengeStore:    challengeStore,
+		lockoutStore:      lockoutStore,
+		auditStore:        auditStore,
+		recoveryCodeStore: recoveryCodeStore,
+		decoys:            decoys,
+	}
+}
+
+// RecoveryChallengeResponse carries a challenge the client MACs with its UMK verifier
+type RecoveryChallengeResponse struct {
+	ChallengeID uuid.UUID `json:"challenge_id"`
+	Challenge   string    `json:"challenge"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// KDFPolicyResponse describes the server's passphrase KDF policy
+type KDFPolicyResponse struct {
+	Recommended             models.KDFDescriptor `json:"recommended"`
+	MinimumPBKDF2Iterations int                  `json:"minimum_pbkdf2_iterations"`
+	MinimumArgon2Iterations int                  `json:"minimum_argon2_iterations"`
+	MinimumArgon2MemoryKiB  int                  `json:"minimum_argon2_memory_kib"`
+}
+
+// RecoveryProof proves possession of the current UMK.
+// Proof is base64(HMAC-SHA256(umk_verifier, challenge || user_id)).
+type RecoveryProof struct {
+	ChallengeID string `json:"challenge_id"`
+	Proof       string `json:"proof"`
+}
+
+// RecoveryUnlockChallengeResponse carries a challenge answered with the passphrase-derived auth key
+type RecoveryUnlockChallengeResponse struct {
+	ChallengeID uuid.UUID            `json:"challenge_id"`
+	Challenge   string               `json:"challenge"`
+	Salt        string               `json:"salt"`
+	KDF         models.KDFDescriptor `json:"kdf"`
+	ExpiresAt   time.Time            `json:"expires_at"`
+}
+
+// RecoveryUnlockRequest answers an unlock challenge.
+// Proof is base64(HMAC-SHA256(recovery_auth_key, challenge || user_id)).
+type RecoveryUnlockRequest struct {
+	ChallengeID string `json:"challenge_id"`
+	Proof       string `json:"proof"`
+}
+
+// RotateRecoveryRequest replaces the passphrase recovery payload.
+// RecoveryAuthKey must be derived from the new passphrase; leaving it empty turns challenge mode off.
+type RotateRecoveryRequest struct {
+	RecoveryProof
+	ExpectedVersion int             `json:"expected_version"`
+	Recovery        RecoveryPayload `json:"recovery"`
+	RecoveryAuthKey string          `json:"recovery_auth_key,omitempty"`
+}
+
+// RollbackRecoveryRequest restores the previous recovery payload
+type RollbackRecoveryRequest struct {
+	RecoveryProof
+}
+
+// GetRecovery returns the encrypted recovery payload for the authenticated user.
+// Fetches are rate limited per user and per IP, and every attempt is audited.
+func (h *RecoveryHandler) GetRecovery(c echo.Context) error {
+	user, err := h.beginRecoveryFetch(c)
+	if err != nil {
+		return err
+	}
+
+	if user.RecoveryAuthKey != "" {
+		h.auditRecoveryFetch(c, user.ID, models.AuditOutcomeDenied, "challenge required")
+		return echo.NewHTTPError(http.StatusForbidden, "recovery challenge required")
+	}
+
+	h.auditRecoveryFetch(c, user.ID, models.AuditOutcomeSuccess, "")
+
+	return c.JSON(http.StatusOK, recoveryPayloadOf(user))
+}
+
+// CreateUnlockChallenge issues the challenge that releases the payload in challenge mode
+func (h *RecoveryHandler) CreateUnlockChallenge(c echo.Context) error {
+	userID, ok := c.Get(middleware.UserIDContextKey).(uuid.UUID)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid session")
+	}
+
+	user, exists := h.sessionUser(c, userID)
+	if !exists {
+		return echo.NewHTTPError(http.StatusNotFound, "user not found")
+	}
+
+	if user.RecoveryAuthKey == "" {
+		return echo.NewHTTPError(http.StatusConflict, "recovery challenge is not enabled")
+	}
+
+	challenge := h.challengeStore.Issue(user.ID, models.ChallengePurposeRecoveryUnlock)
+
+	return c.JSON(http.StatusCreated, RecoveryUnlockChallengeResponse{
+		ChallengeID: challenge.ID,
+		Challenge:   base64.StdEncoding.EncodeToString(challenge.Value),
+		Salt:        user.RecoverySalt,
+		KDF:         user.RecoveryKDFOrLegacy(),
+		ExpiresAt:   challenge.ExpiresAt,
+	})
+}
+
+// UnlockRecovery releases the recovery payload to a client that proves knowledge of the passphrase.
+// Wrong proofs lock the user and the client address out with exponential backoff.
+func (h *RecoveryHandler) UnlockRecovery(c echo.Context) error {
+	var req RecoveryUnlockRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request")
+	}
+
+	challengeID, err := uuid.Parse(req.ChallengeID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid challenge id")
+	}
+
+	user, err := h.beginRecoveryFetch(c)
+	if err != nil {
+		return err
+	}
+
+	if user.RecoveryAuthKey == "" {
+		return echo.NewHTTPError(http.StatusConflict, "recovery challenge is not enabled")
+	}
+
+	challenge, exists := h.challengeStore.Consume(challengeID, user.ID, models.ChallengePurposeRecoveryUnlock)
+	if !exists {
+		h.auditRecoveryFetch(c, user.ID, models.AuditOutcomeDenied, "challenge not found or expired")
+		return echo.NewHTTPError(http.StatusBadRequest, "challenge not found or expired")
+	}
+
+	if !verifyChallengeMAC(user.RecoveryAuthKey, challenge.Value, user.ID, req.Proof) {
+		h.lockoutStore.Fail(recoveryUserKey(user.ID), recoveryUserPolicy)
+		h.lockoutStore.Fail(recoveryIPKey(c), recoveryIPPolicy)
+		h.auditRecoveryFetch(c, user.ID, models.AuditOutcomeFailure, "invalid challenge proof")
+		return echo.NewHTTPError(http.StatusForbidden, "invalid proof")
+	}
+
+	h.auditRecoveryFetch(c, user.ID, models.AuditOutcomeSuccess, "challenge solved")
+
+	return c.JSON(http.StatusOK, recoveryPayloadOf(user))
+}
+
+// GetRecoveryAudit lists recovery fetch attempts for the authenticated user
+func (h *RecoveryHandler) GetRecoveryAudit(c echo.Context) error {
+	userID, ok := c.Get(middleware.UserIDContextKey).(uuid.UUID)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid session")
+	}
+
+	return c.JSON(http.StatusOK, h.auditStore.FindByUserID(userID, models.AuditActionRecoveryFetch))
+}
+
+// beginRecoveryFetch loads the session user and applies the per-user and per-IP limits
+func (h *RecoveryHandler) beginRecoveryFetch(c echo.Context) (*models.User, error) {
+	userID, ok := c.Get(middleware.UserIDContextKey).(uuid.UUID)
+	if !ok {
+		return nil, echo.NewHTTPError(http.StatusUnauthorized, "invalid session")
+	}
+
+	user, exists := h.sessionUser(c, userID)
+	if !exists {
+		return nil, echo.NewHTTPError(http.StatusNotFound, "user not found")
+	}
+
+	userRetry, userAllowed := h.lockoutStore.Attempt(recoveryUserKey(user.ID), recoveryUserPolicy)
+	ipRetry, ipAllowed := h.lockoutStore.Attempt(recoveryIPKey(c), recoveryIPPolicy)
+	if !userAllowed || !ipAllowed {
+		h.auditRecoveryFetch(c, user.ID, models.AuditOutcomeDenied, "rate limited")
+		setRetryAfter(c, max(userRetry, ipRetry))
+		return nil, echo.NewHTTPError(http.StatusTooManyRequests, "too many recovery requests, try again later")
+	}
+
+	if user.RecoveryWrappedUMK == "" || user.RecoverySalt == "" || user.RecoveryIV == "" {
+		return nil, echo.NewHTTPError(http.StatusNotFound, "recovery data not available")
+	}
+
+	return user, nil
+}
+
+// sessionUser returns the session user, or the decoy user of a decoy session so
+// that it receives a payload like any account signing in from a new device
+func (h *RecoveryHandler) sessionUser(c echo.Context, userID uuid.UUID) (*models.User, bool) {
+	if decoyUsername, ok := c.Get(middleware.DecoyUsernameContextKey).(string); ok {
+		return h.decoys.User(decoyUsername), true
+	}
+	return h.userStore.FindByID(userID)
+}
+
+func (h *RecoveryHandler) auditRecoveryFetch(c echo.Context, userID uuid.UUID, outcome, detail string) {
+	h.auditStore.Record(userID, models.AuditActionRecoveryFetch, outcome, detail, c.RealIP(), c.Request().UserAgent())
+}
+
+func recoveryUserKey(userID uuid.UUID) string {
+	return "recovery:user:" + userID.String()
+}
+
+func recoveryIPKey(c echo.Context) string {
+	return "recovery:ip:" + c.RealIP()
+}
+
+// setRetryAfter sets the Retry-After header in whole seconds, rounding up
+func setRetryAfter(c echo.Context, retry time.Duration) {
+	seconds := int((retry + time.Second - 1) / time.Second)
+	c.Response().Header().Set(echo.HeaderRetryAfter, strconv.Itoa(max(seconds, 1)))
+}
+
+// CreateRecoveryChallenge issues a challenge for rotating or rolling back the recovery payload
+func (h *RecoveryHandler) CreateRecoveryChallenge(c echo.Context) error {
+	userID, ok := c.Get(middleware.UserIDContextKey).(uuid.UUID)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid session")
+	}
+
+	challenge := h.challengeStore.Issue(userID, models.ChallengePurposeRecoveryRotation)
+
+	return c.JSON(http.StatusCreated, RecoveryChallengeResponse{
+		ChallengeID: challenge.ID,
+		Challenge:   base64.StdEncoding.EncodeToString(challenge.Value),
+		ExpiresAt:   challenge.ExpiresAt,
+	})
+}
+
+// RotateRecovery replaces the recovery payload after checking session freshness and UMK possession
+func (h *RecoveryHandler) RotateRecovery(c echo.Context) error {
+	var req RotateRecoveryRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request")
+	}
+
+	if req.Recovery.WrappedUMK == "" || req.Recovery.Salt == "" || req.Recovery.IV == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "recovery payload is required")
+	}
+
+	kdf, err := recoveryKDFOf(req.Recovery)
+	if err != nil {
+		return err
+	}
+
+	if req.RecoveryAuthKey != "" && !validMACKey(req.RecoveryAuthKey) {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid recovery_auth_key")
+	}
+
+	user, err := h.verifyRecoveryProof(c, req.RecoveryProof)
+	if err != nil {
+		return err
+	}
+
+	updated, err := h.userStore.RotateRecoveryData(user.ID, req.ExpectedVersion, req.Recovery.WrappedUMK, req.Recovery.Salt, req.Recovery.IV, req.RecoveryAuthKey, kdf)
+	if err != nil {
+		if errors.Is(err, store.ErrRecoveryVersionConflict) {
+			return echo.NewHTTPError(http.StatusConflict, "recovery payload version mismatch")
+		}
+		return echo.NewHTTPError(http.StatusNotFound, "user not found")
+	}
+
+	return c.JSON(http.StatusOK, recoveryPayloadOf(updated))
+}
+
+// RollbackRecovery restores the payload replaced by the last rotation within the rollback window
+func (h *RecoveryHandler) RollbackRecovery(c echo.Context) error {
+	var req RollbackRecoveryRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request")
+	}
+
+	user, err := h.verifyRecoveryProof(c, req.RecoveryProof)
+	if err != nil {
+		return err
+	}
+
+	updated, err := h.userStore.RollbackRecoveryData(user.ID, RecoveryRollbackWindow)
+	if err != nil {
+		if errors.Is(err, store.ErrNoRecoveryRollback) {
+			return echo.NewHTTPError(http.StatusConflict, "no recovery payload to roll back to")
+		}
+		return echo.NewHTTPError(http.StatusNotFound, "user not found")
+	}
+
+	return c.JSON(http.StatusOK, recoveryPayloadOf(updated))
+}
+
+// verifyRecoveryProof requires a valid MAC over a rotation challenge keyed by the verifier
+// registered at sign-up. Accounts without one cannot pass it. Routes using it also sit
+// behind RecentAuthMiddleware.
+func (h *RecoveryHandler) verifyRecoveryProof(c echo.Context, proof RecoveryProof) (*models.User, error) {
+	userID, ok := c.Get(middleware.UserIDContextKey).(uuid.UUID)
+	if !ok {
+		return nil, echo.NewHTTPError(http.StatusUnauthorized, "invalid session")
+	}
+
+	user, exists := h.userStore.FindByID(userID)
+	if !exists {
+		return nil, echo.NewHTTPError(http.StatusNotFound, "user not found")
+	}
+
+	if user.UMKVerifier == "" {
+		return nil, echo.NewHTTPError(http.StatusConflict, "this account has no umk verifier")
+	}
+
+	challengeID, err := uuid.Parse(proof.ChallengeID)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "invalid challenge id")
+	}
+
+	challenge, exists := h.challengeStore.Consume(challengeID, user.ID, models.ChallengePurposeRecoveryRotation)
+	if !exists {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "challenge not found or expired")
+	}
+
+	if !verifyChallengeMAC(user.UMKVerifier, challenge.Value, user.ID, proof.Proof) {
+		return nil, echo.NewHTTPError(http.StatusForbidden, "invalid proof")
+	}
+
+	return user, nil
+}
+
+// GetKDFPolicy returns the parameters clients should wrap new recovery payloads with
+func (h *RecoveryHandler) GetKDFPolicy(c echo.Context) error {
+	return c.JSON(http.StatusOK, KDFPolicyResponse{
+		Recommended:             models.DefaultKDFPolicy.Recommended,
+		MinimumPBKDF2Iterations: models.DefaultKDFPolicy.Minimum.PBKDF2Iterations,
+		MinimumArgon2Iterations: models.DefaultKDFPolicy.Minimum.Argon2Iterations,
+		MinimumArgon2MemoryKiB:  models.DefaultKDFPolicy.Minimum.Argon2MemoryKiB,
+	})
+}
+
+func recoveryPayloadOf(user *models.User) RecoveryPayload {
+	kdf := user.RecoveryKDFOrLegacy()
+	payload := RecoveryPayload{
+		WrappedUMK: user.RecoveryWrappedUMK,
+		Salt:       user.RecoverySalt,
+		IV:         user.RecoveryIV,
+		KDF:        &kdf,
+		Version:    user.RecoveryVersion,
+	}
+
+	if models.DefaultKDFPolicy.NeedsUpgrade(kdf) {
+		recommended := models.DefaultKDFPolicy.Recommended
+		payload.KDFUpgradeRequired = true
+		payload.RecommendedKDF = &recommended
+	}
+
+	return payload
+}
+
+// recoveryKDFOf validates the KDF descriptor of a submitted recovery payload against the policy
+func recoveryKDFOf(payload RecoveryPayload) (models.KDFDescriptor, error) {
+	kdf := models.LegacyKDF
+	if payload.KDF != nil {
+		kdf = *payload.KDF
+	}
+
+	if err := models.DefaultKDFPolicy.Validate(kdf); err != nil {
+		return kdf, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	return kdf, nil
+}
+
+// validMACKey checks the shape of a client-derived MAC key such as the UMK verifier
+func validMACKey(verifier string) bool {
+	key, err := base64.StdEncoding.DecodeString(verifier)
+	return err == nil && len(key) == macKeyLength
+}
+
+// verifyChallengeMAC checks proof == HMAC-SHA256(key, challenge || user_id)
+func verifyChallengeMAC(encodedKey string, challenge []byte, userID uuid.UUID, proof string) bool {
+	key, err := base64.StdEncoding.DecodeString(encodedKey)
+	if err != nil {
+		return false
+	}
+
+	given, err := base64.StdEncoding.DecodeString(proof)
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write(challenge)
+	mac.Write([]byte(userID.String()))
+
+	return hmac.Equal(mac.Sum(nil), given)
+}
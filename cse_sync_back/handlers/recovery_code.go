@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/middleware"
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/models"
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/store"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+const maxRecoveryCodes = 16
+
+// recoveryCodeLookupPolicy limits guessing of code identifiers for one account
+var recoveryCodeLookupPolicy = store.LockoutPolicy{
+	Limit:       10,
+	Window:      time.Hour,
+	BaseLockout: time.Minute,
+	MaxLockout:  24 * time.Hour,
+}
+
+// RecoveryCodeSlotRequest is one recovery code slot prepared by the client.
+// CodeID is an identifier the client derives from the code, never the code itself.
+type RecoveryCodeSlotRequest struct {
+	CodeID     string `json:"code_id"`
+	WrappedUMK string `json:"wrapped_umk"`
+	Salt       string `json:"salt"`
+	IV         string `json:"iv"`
+}
+
+// RegenerateRecoveryCodesRequest replaces the whole set of recovery codes
+type RegenerateRecoveryCodesRequest struct {
+	RecoveryProof
+	Codes []RecoveryCodeSlotRequest `json:"codes"`
+}
+
+// RecoveryCodeLookupRequest identifies a recovery code slot
+type RecoveryCodeLookupRequest struct {
+	CodeID string `json:"code_id"`
+}
+
+// RecoveryCodesStatusResponse reports how many recovery codes are left
+type RecoveryCodesStatusResponse struct {
+	Remaining int `json:"remaining"`
+	Total     int `json:"total"`
+}
+
+// GetRecoveryCodesStatus returns the remaining recovery code count
+func (h *RecoveryHandler) GetRecoveryCodesStatus(c echo.Context) error {
+	userID, ok := c.Get(middleware.UserIDContextKey).(uuid.UUID)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid session")
+	}
+
+	remaining, total := h.recoveryCodeStore.Counts(userID)
+
+	return c.JSON(http.StatusOK, RecoveryCodesStatusResponse{
+		Remaining: remaining,
+		Total:     total,
+	})
+}
+
+// RegenerateRecoveryCodes replaces all recovery code slots, invalidating every earlier code
+func (h *RecoveryHandler) RegenerateRecoveryCodes(c echo.Context) error {
+	var req RegenerateRecoveryCodesRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request")
+	}
+
+	if len(req.Codes) == 0 || len(req.Codes) > maxRecoveryCodes {
+		return echo.NewHTTPError(http.StatusBadRequest, "between 1 and 16 recovery codes are required")
+	}
+
+	inputs := make([]store.RecoveryCodeInput, 0, len(req.Codes))
+	seen := make(map[string]bool)
+	for _, code := range req.Codes {
+		if code.CodeID == "" || code.WrappedUMK == "" || code.Salt == "" || code.IV == "" {
+			return echo.NewHTTPError(http.StatusBadRequest, "each recovery code needs code_id, wrapped_umk, salt and iv")
+		}
+		if seen[code.CodeID] {
+			return echo.NewHTTPError(http.StatusBadRequest, "recovery code ids must be unique")
+		}
+		seen[code.CodeID] = true
+
+		inputs = append(inputs, store.RecoveryCodeInput{
+			CodeID:     code.CodeID,
+			WrappedUMK: code.WrappedUMK,
+			Salt:       code.Salt,
+			IV:         code.IV,
+		})
+	}
+
+	user, err := h.verifyRecoveryProof(c, req.RecoveryProof)
+	if err != nil {
+		return err
+	}
+
+	slots := h.recoveryCodeStore.Replace(user.ID, inputs)
+	h.auditStore.Record(user.ID, models.AuditActionRecoveryCodesRotate, models.AuditOutcomeSuccess, "", c.RealIP(), c.Request().UserAgent())
+
+	return c.JSON(http.StatusOK, RecoveryCodesStatusResponse{
+		Remaining: len(slots),
+		Total:     len(slots),
+	})
+}
+
+// LookupRecoveryCode returns the UMK wrapped under one recovery code.
+// The slot stays usable until the client burns it after a successful unwrap.
+func (h *RecoveryHandler) LookupRecoveryCode(c echo.Context) error {
+	userID, ok := c.Get(middleware.UserIDContextKey).(uuid.UUID)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid session")
+	}
+
+	var req RecoveryCodeLookupRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request")
+	}
+
+	if req.CodeID == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "code_id is required")
+	}
+
+	lockoutKey := "recovery-code:user:" + userID.String()
+	if retry, allowed := h.lockoutStore.Attempt(lockoutKey, recoveryCodeLookupPolicy); !allowed {
+		h.auditStore.Record(userID, models.AuditActionRecoveryCodeUse, models.AuditOutcomeDenied, "rate limited", c.RealIP(), c.Request().UserAgent())
+		setRetryAfter(c, retry)
+		return echo.NewHTTPError(http.StatusTooManyRequests, "too many recovery code attempts, try again later")
+	}
+
+	slot, exists := h.recoveryCodeStore.FindUnused(userID, req.CodeID)
+	if !exists {
+		h.lockoutStore.Fail(lockoutKey, recoveryCodeLookupPolicy)
+		h.auditStore.Record(userID, models.AuditActionRecoveryCodeUse, models.AuditOutcomeFailure, "unknown or used code", c.RealIP(), c.Request().UserAgent())
+		return echo.NewHTTPError(http.StatusNotFound, "recovery code not found or already used")
+	}
+
+	return c.JSON(http.StatusOK, RecoveryPayload{
+		WrappedUMK: slot.WrappedUMK,
+		Salt:       slot.Salt,
+		IV:         slot.IV,
+	})
+}
+
+// BurnRecoveryCode marks a recovery code as used
+func (h *RecoveryHandler) BurnRecoveryCode(c echo.Context) error {
+	userID, ok := c.Get(middleware.UserIDContextKey).(uuid.UUID)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid session")
+	}
+
+	var req RecoveryCodeLookupRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request")
+	}
+
+	if !h.recoveryCodeStore.Burn(userID, req.CodeID) {
+		return echo.NewHTTPError(http.StatusNotFound, "recovery code not found or already used")
+	}
+
+	h.auditStore.Record(userID, models.AuditActionRecoveryCodeUse, models.AuditOutcomeSuccess, "", c.RealIP(), c.Request().UserAgent())
+
+	remaining, total := h.recoveryCodeStore.Counts(userID)
+
+	return c.JSON(http.StatusOK, RecoveryCodesStatusResponse{
+		Remaining: remaining,
+		Total:     total,
+	})
+}
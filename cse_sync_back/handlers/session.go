@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/middleware"
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/store"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// SessionHandler handles listing and revoking the authenticated user's sessions
+type SessionHandler struct {
+	sessionStore *store.SessionStore
+}
+
+// NewSessionHandler creates a new SessionHandler
+func NewSessionHandler(sessionStore *store.SessionStore) *SessionHandler {
+	return &SessionHandler{
+		sessionStore: sessionStore,
+	}
+}
+
+// ActiveSession describes a signed-in session. ID is the stable session ID,
+// never the cookie token, so listing sessions cannot leak credentials.
+type ActiveSession struct {
+	ID         string     `json:"id"`
+	DeviceID   *uuid.UUID `json:"device_id,omitempty"`
+	IPAddress  string     `json:"ip_address"`
+	UserAgent  string     `json:"user_agent"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	Current    bool       `json:"current"`
+}
+
+// RevokeOtherSessionsResponse reports how many sessions were signed out
+type RevokeOtherSessionsResponse struct {
+	Revoked int `json:"revoked"`
+}
+
+// ListSessions returns the authenticated user's sessions, most recently used first
+func (h *SessionHandler) ListSessions(c echo.Context) error {
+	userID, ok := c.Get(middleware.UserIDContextKey).(uuid.UUID)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid session")
+	}
+
+	currentID, _ := c.Get(middleware.SessionIDContextKey).(string)
+
+	sessions := h.sessionStore.FindByUserID(userID)
+	active := make([]ActiveSession, 0, len(sessions))
+	for _, session := range sessions {
+		active = append(active, ActiveSession{
+			ID:         session.ID,
+			DeviceID:   session.DeviceID,
+			IPAddress:  session.IPAddress,
+			UserAgent:  session.UserAgent,
+			CreatedAt:  session.CreatedAt,
+			LastSeenAt: session.LastSeenAt,
+			ExpiresAt:  session.ExpiresAt,
+			Current:    session.ID == currentID,
+		})
+	}
+
+	slices.SortFunc(active, func(a, b ActiveSession) int {
+		return b.LastSeenAt.Compare(a.LastSeenAt)
+	})
+
+	return c.JSON(http.StatusOK, active)
+}
+
+// RevokeSession signs out one of the authenticated user's sessions
+func (h *SessionHandler) RevokeSession(c echo.Context) error {
+	userID, ok := c.Get(middleware.UserIDContextKey).(uuid.UUID)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid session")
+	}
+
+	currentID, _ := c.Get(middleware.SessionIDContextKey).(string)
+	sessionID := c.Param("sessionID")
+
+	if err := h.sessionStore.Delete(userID, sessionID); err != nil {
+		if errors.Is(err, store.ErrSessionNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "session not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to revoke session")
+	}
+
+	if sessionID == currentID {
+		middleware.ClearSessionCookie(c)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// RevokeOtherSessions signs out every session of the authenticated user except the current one
+func (h *SessionHandler) RevokeOtherSessions(c echo.Context) error {
+	userID, ok := c.Get(middleware.UserIDContextKey).(uuid.UUID)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid session")
+	}
+
+	currentID, ok := c.Get(middleware.SessionIDContextKey).(string)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid session")
+	}
+
+	return c.JSON(http.StatusOK, RevokeOtherSessionsResponse{
+		Revoked: h.sessionStore.DeleteOthers(userID, currentID),
+	})
+}
@@ -0,0 +1,396 @@
+package handlers
+
+import (
+	"crypto/ecdh"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/middleware"
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/models"
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/store"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	socialRecoveryMinThreshold = 2
+	socialRecoveryMaxGuardians = 10
+)
+
+// SocialRecoveryHandler handles guardian-based recovery of the recovery key
+type SocialRecoveryHandler struct {
+	socialRecoveryStore *store.SocialRecoveryStore
+	userStore           *store.UserStore
+	notificationStore   *store.NotificationStore
+}
+
+// NewSocialRecoveryHandler creates a new SocialRecoveryHandler
+func NewSocialRecoveryHandler(socialRecoveryStore *store.SocialRecoveryStore, userStore *store.UserStore, notificationStore *store.NotificationStore) *SocialRecoveryHandler {
+	return &SocialRecoveryHandler{
+		socialRecoveryStore: socialRecoveryStore,
+		userStore:           userStore,
+		notificationStore:   notificationStore,
+	}
+}
+
+// GuardianShareRequest is one share the client encrypted to a guardian
+type GuardianShareRequest struct {
+	GuardianUsername string `json:"guardian_username"`
+	Index            int    `json:"index"`
+	EncryptedShare   string `json:"encrypted_share"`
+}
+
+// SocialRecoverySetupRequest stores the client-split shares with threshold K
+type SocialRecoverySetupRequest struct {
+	Threshold int                    `json:"threshold"`
+	Shares    []GuardianShareRequest `json:"shares"`
+}
+
+// GuardianSummary describes a guardian without exposing their share
+type GuardianSummary struct {
+	GuardianID uuid.UUID `json:"guardian_id"`
+	Username   string    `json:"username"`
+	Index      int       `json:"index"`
+}
+
+// SocialRecoverySetupResponse summarizes a social recovery configuration
+type SocialRecoverySetupResponse struct {
+	Threshold int               `json:"threshold"`
+	Guardians []GuardianSummary `json:"guardians"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+// SocialRecoveryRequestCreate opens a recovery request from a new device
+type SocialRecoveryRequestCreate struct {
+	EphemeralPublicKey string `json:"ephemeral_public_key"`
+}
+
+// GuardianRequestView is what a guardian sees for a pending request
+type GuardianRequestView struct {
+	RequestID          uuid.UUID `json:"request_id"`
+	OwnerID            uuid.UUID `json:"owner_id"`
+	OwnerUsername      string    `json:"owner_username"`
+	EphemeralPublicKey string    `json:"ephemeral_public_key"`
+	ShareIndex         int       `json:"share_index"`
+	EncryptedShare     string    `json:"encrypted_share"`
+	CreatedAt          time.Time `json:"created_at"`
+	ExpiresAt          time.Time `json:"expires_at"`
+}
+
+// GuardianApproveRequest carries the guardian's share re-encrypted to the requester's ephemeral key
+type GuardianApproveRequest struct {
+	ReleasedShare string `json:"released_share"`
+}
+
+// SetupSocialRecovery stores encrypted shares for the authenticated user's guardians.
+// A guardian set that cannot be used is rejected as a whole, without saying which
+// guardian was the problem. Whether the set was accepted still tells that its
+// usernames exist, so the route sits behind the same rate limit and proof of work
+// as registration.
+func (h *SocialRecoveryHandler) SetupSocialRecovery(c echo.Context) error {
+	userID, ok := c.Get(middleware.UserIDContextKey).(uuid.UUID)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid session")
+	}
+
+	var req SocialRecoverySetupRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request")
+	}
+
+	if len(req.Shares) > socialRecoveryMaxGuardians {
+		return echo.NewHTTPError(http.StatusBadRequest, "too many guardians")
+	}
+
+	if req.Threshold < socialRecoveryMinThreshold || req.Threshold > len(req.Shares) {
+		return echo.NewHTTPError(http.StatusBadRequest, "threshold must be at least 2 and at most the number of shares")
+	}
+
+	shares := make([]*models.GuardianShare, 0, len(req.Shares))
+	seenGuardians := make(map[uuid.UUID]bool)
+	seenIndexes := make(map[int]bool)
+	for _, shareReq := range req.Shares {
+		if shareReq.EncryptedShare == "" || shareReq.Index < 1 || shareReq.Index > 255 {
+			return echo.NewHTTPError(http.StatusBadRequest, "each share needs an index between 1 and 255 and encrypted_share")
+		}
+
+		if seenIndexes[shareReq.Index] {
+			return echo.NewHTTPError(http.StatusBadRequest, "share indexes must be unique")
+		}
+		seenIndexes[shareReq.Index] = true
+
+		guardian, exists := h.userStore.FindByUsername(shareReq.GuardianUsername)
+		if !exists || guardian.ID == userID || seenGuardians[guardian.ID] {
+			return echo.NewHTTPError(http.StatusBadRequest, "guardians must be distinct existing accounts other than your own")
+		}
+		seenGuardians[guardian.ID] = true
+
+		shares = append(shares, &models.GuardianShare{
+			GuardianID:     guardian.ID,
+			Index:          shareReq.Index,
+			EncryptedShare: shareReq.EncryptedShare,
+		})
+	}
+
+	config := h.socialRecoveryStore.SaveConfig(userID, req.Threshold, shares)
+
+	return c.JSON(http.StatusOK, h.setupResponse(config))
+}
+
+// GetSocialRecovery returns the authenticated user's guardians and threshold
+func (h *SocialRecoveryHandler) GetSocialRecovery(c echo.Context) error {
+	userID, ok := c.Get(middleware.UserIDContextKey).(uuid.UUID)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid session")
+	}
+
+	config, exists := h.socialRecoveryStore.FindConfig(userID)
+	if !exists {
+		return echo.NewHTTPError(http.StatusNotFound, "social recovery is not configured")
+	}
+
+	return c.JSON(http.StatusOK, h.setupResponse(config))
+}
+
+// DeleteSocialRecovery removes the authenticated user's guardian shares
+func (h *SocialRecoveryHandler) DeleteSocialRecovery(c echo.Context) error {
+	userID, ok := c.Get(middleware.UserIDContextKey).(uuid.UUID)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid session")
+	}
+
+	if !h.socialRecoveryStore.DeleteConfig(userID) {
+		return echo.NewHTTPError(http.StatusNotFound, "social recovery is not configured")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// CreateRecoveryRequest asks the user's guardians to release their shares to this device
+func (h *SocialRecoveryHandler) CreateRecoveryRequest(c echo.Context) error {
+	userID, ok := c.Get(middleware.UserIDContextKey).(uuid.UUID)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid session")
+	}
+
+	sessionID, ok := c.Get(middleware.SessionIDContextKey).(string)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid session")
+	}
+
+	var req SocialRecoveryRequestCreate
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request")
+	}
+
+	publicKey, err := base64.StdEncoding.DecodeString(req.EphemeralPublicKey)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid ephemeral public key")
+	}
+
+	if _, err := ecdh.X25519().NewPublicKey(publicKey); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "ephemeral public key must be an X25519 key")
+	}
+
+	user, exists := h.userStore.FindByID(userID)
+	if !exists {
+		return echo.NewHTTPError(http.StatusNotFound, "user not found")
+	}
+
+	request, err := h.socialRecoveryStore.CreateRequest(userID, sessionID, req.EphemeralPublicKey)
+	if err != nil {
+		return socialRecoveryError(err)
+	}
+
+	data := map[string]string{"request_id": request.ID.String(), "owner_username": user.Username}
+	for _, share := range request.Shares {
+		h.notificationStore.Create(share.GuardianID, models.NotificationSocialRecoveryRequested,
+			user.Username+" asked you to help recover their account", data)
+	}
+	h.notificationStore.Create(userID, models.NotificationSocialRecoveryRequested,
+		"A social recovery was requested for your account. Cancel it if this was not you.", data)
+
+	return c.JSON(http.StatusCreated, request)
+}
+
+// GetRecoveryRequest lets the requesting device poll its request.
+// Released shares are only included once the threshold has been reached.
+func (h *SocialRecoveryHandler) GetRecoveryRequest(c echo.Context) error {
+	userID, ok := c.Get(middleware.UserIDContextKey).(uuid.UUID)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid session")
+	}
+
+	sessionID, _ := c.Get(middleware.SessionIDContextKey).(string)
+
+	requestID, err := uuid.Parse(c.Param("requestID"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request id")
+	}
+
+	request, exists := h.socialRecoveryStore.FindRequest(requestID)
+	if !exists || request.UserID != userID {
+		return echo.NewHTTPError(http.StatusNotFound, "recovery request not found")
+	}
+
+	if request.SessionID != sessionID {
+		return echo.NewHTTPError(http.StatusForbidden, "recovery request belongs to another session")
+	}
+
+	if request.Status != models.SocialRecoveryStatusReleased {
+		for i, approval := range request.Approvals {
+			redacted := *approval
+			redacted.ReleasedShare = ""
+			request.Approvals[i] = &redacted
+		}
+	}
+
+	return c.JSON(http.StatusOK, request)
+}
+
+// CancelRecoveryRequest cancels a pending request from any of the owner's sessions
+func (h *SocialRecoveryHandler) CancelRecoveryRequest(c echo.Context) error {
+	userID, ok := c.Get(middleware.UserIDContextKey).(uuid.UUID)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid session")
+	}
+
+	requestID, err := uuid.Parse(c.Param("requestID"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request id")
+	}
+
+	if err := h.socialRecoveryStore.Cancel(requestID, userID); err != nil {
+		return socialRecoveryError(err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// ListGuardianRequests returns pending requests in which the authenticated user is a guardian
+func (h *SocialRecoveryHandler) ListGuardianRequests(c echo.Context) error {
+	guardianID, ok := c.Get(middleware.UserIDContextKey).(uuid.UUID)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid session")
+	}
+
+	views := make([]GuardianRequestView, 0)
+	for _, request := range h.socialRecoveryStore.FindPendingForGuardian(guardianID) {
+		share, _ := request.ShareFor(guardianID)
+
+		ownerUsername := ""
+		if owner, exists := h.userStore.FindByID(request.UserID); exists {
+			ownerUsername = owner.Username
+		}
+
+		views = append(views, GuardianRequestView{
+			RequestID:          request.ID,
+			OwnerID:            request.UserID,
+			OwnerUsername:      ownerUsername,
+			EphemeralPublicKey: request.EphemeralPublicKey,
+			ShareIndex:         share.Index,
+			EncryptedShare:     share.EncryptedShare,
+			CreatedAt:          request.CreatedAt,
+			ExpiresAt:          request.ExpiresAt,
+		})
+	}
+
+	return c.JSON(http.StatusOK, views)
+}
+
+// ApproveRecoveryRequest releases the guardian's share to the requesting device
+func (h *SocialRecoveryHandler) ApproveRecoveryRequest(c echo.Context) error {
+	guardianID, ok := c.Get(middleware.UserIDContextKey).(uuid.UUID)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid session")
+	}
+
+	requestID, err := uuid.Parse(c.Param("requestID"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request id")
+	}
+
+	var req GuardianApproveRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request")
+	}
+
+	if req.ReleasedShare == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "released_share is required")
+	}
+
+	request, err := h.socialRecoveryStore.Approve(requestID, guardianID, req.ReleasedShare)
+	if err != nil {
+		return socialRecoveryError(err)
+	}
+
+	data := map[string]string{"request_id": request.ID.String()}
+	if guardian, exists := h.userStore.FindByID(guardianID); exists {
+		data["guardian_username"] = guardian.Username
+		h.notificationStore.Create(request.UserID, models.NotificationSocialRecoveryApproved,
+			guardian.Username+" approved your recovery request", data)
+	}
+	if request.Status == models.SocialRecoveryStatusReleased {
+		h.notificationStore.Create(request.UserID, models.NotificationSocialRecoveryReleased,
+			"Enough guardians approved; the shares were released to the requesting device", data)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// RejectRecoveryRequest declines to release the guardian's share
+func (h *SocialRecoveryHandler) RejectRecoveryRequest(c echo.Context) error {
+	guardianID, ok := c.Get(middleware.UserIDContextKey).(uuid.UUID)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid session")
+	}
+
+	requestID, err := uuid.Parse(c.Param("requestID"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request id")
+	}
+
+	request, err := h.socialRecoveryStore.Reject(requestID, guardianID)
+	if err != nil {
+		return socialRecoveryError(err)
+	}
+
+	if request.Status == models.SocialRecoveryStatusRejected {
+		h.notificationStore.Create(request.UserID, models.NotificationSocialRecoveryRejected,
+			"Your recovery request can no longer reach the guardian threshold",
+			map[string]string{"request_id": request.ID.String()})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (h *SocialRecoveryHandler) setupResponse(config *models.SocialRecoveryConfig) SocialRecoverySetupResponse {
+	guardians := make([]GuardianSummary, 0, len(config.Shares))
+	for _, share := range config.Shares {
+		summary := GuardianSummary{GuardianID: share.GuardianID, Index: share.Index}
+		if guardian, exists := h.userStore.FindByID(share.GuardianID); exists {
+			summary.Username = guardian.Username
+		}
+		guardians = append(guardians, summary)
+	}
+
+	return SocialRecoverySetupResponse{
+		Threshold: config.Threshold,
+		Guardians: guardians,
+		CreatedAt: config.CreatedAt,
+	}
+}
+
+func socialRecoveryError(err error) error {
+	switch {
+	case errors.Is(err, store.ErrSocialRecoveryNotConfigured):
+		return echo.NewHTTPError(http.StatusNotFound, "social recovery is not configured")
+	case errors.Is(err, store.ErrSocialRecoveryNotFound), errors.Is(err, store.ErrNotGuardian):
+		return echo.NewHTTPError(http.StatusNotFound, "recovery request not found")
+	case errors.Is(err, store.ErrSocialRecoveryNotPending), errors.Is(err, store.ErrGuardianAlreadyResponded):
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	}
+	return echo.NewHTTPError(http.StatusInternalServerError, "social recovery failed")
+}
@@ -0,0 +1,271 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/middleware"
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/models"
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/store"
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/webauthn"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// StepUpMaxAge is how recently a session must have authenticated to call high-risk routes
+const StepUpMaxAge = 5 * time.Minute
+
+// Step-up methods. StepUpMethodUMK proves possession of the unlocked UMK by
+// MACing a challenge with the UMK verifier, which any of the user's devices can do.
+// Every account registers a verifier, so it is the factor a username-only account
+// steps up with.
+const (
+	StepUpMethodTOTP    = "totp"
+	StepUpMethodPasskey = "passkey"
+	StepUpMethodUMK     = "umk"
+)
+
+// stepUpPolicy limits step-up attempts of one account; TOTP codes fall under totpVerifyPolicy
+var stepUpPolicy = store.LockoutPolicy{
+	Limit:       10,
+	Window:      15 * time.Minute,
+	BaseLockout: time.Minute,
+	MaxLockout:  24 * time.Hour,
+}
+
+// StepUpStatusResponse tells the client when the session last authenticated and how it can step up
+type StepUpStatusResponse struct {
+	AuthenticatedAt time.Time `json:"authenticated_at"`
+	MaxAgeSeconds   int       `json:"max_age_seconds"`
+	Methods         []string  `json:"methods"`
+}
+
+// StepUpBeginRequest selects the method a step-up challenge is issued for
+type StepUpBeginRequest struct {
+	Method string `json:"method"`
+}
+
+// StepUpBeginResponse carries the challenge of a step-up: WebAuthn request options
+// for passkeys, or a challenge to MAC with the UMK verifier
+type StepUpBeginResponse struct {
+	Method      string                   `json:"method"`
+	PublicKey   *webauthn.RequestOptions `json:"public_key,omitempty"`
+	ChallengeID *uuid.UUID               `json:"challenge_id,omitempty"`
+	Challenge   string                   `json:"challenge,omitempty"`
+	ExpiresAt   *time.Time               `json:"expires_at,omitempty"`
+}
+
+// StepUpRequest proves a login factor. Code is used by totp, Assertion by passkey,
+// and ChallengeID with Proof = base64(HMAC-SHA256(umk_verifier, challenge || user_id)) by umk.
+type StepUpRequest struct {
+	Method      string                      `json:"method"`
+	Code        string                      `json:"code,omitempty"`
+	Assertion   *webauthn.AssertionResponse `json:"assertion,omitempty"`
+	ChallengeID string                      `json:"challenge_id,omitempty"`
+	Proof       string                      `json:"proof,omitempty"`
+}
+
+// StepUpResponse reports the refreshed authentication time
+type StepUpResponse struct {
+	AuthenticatedAt time.Time `json:"authenticated_at"`
+}
+
+// GetStepUp returns the session's authentication time and the step-up methods available to the user
+func (h *AuthHandler) GetStepUp(c echo.Context) error {
+	user, session, err := h.stepUpContext(c)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, StepUpStatusResponse{
+		AuthenticatedAt: session.AuthenticatedAt,
+		MaxAgeSeconds:   int(StepUpMaxAge / time.Second),
+		Methods:         h.stepUpMethods(user),
+	})
+}
+
+// BeginStepUp issues the challenge for a passkey or UMK step-up; TOTP needs none
+func (h *AuthHandler) BeginStepUp(c echo.Context) error {
+	user, _, err := h.stepUpContext(c)
+	if err != nil {
+		return err
+	}
+
+	var req StepUpBeginRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request")
+	}
+
+	if !slices.Contains(h.stepUpMethods(user), req.Method) {
+		return echo.NewHTTPError(http.StatusBadRequest, "step-up method not available")
+	}
+
+	switch req.Method {
+	case StepUpMethodPasskey:
+		challenge := webauthn.NewChallenge()
+
+		h.credentialStore.BeginCeremony(models.PasskeyCeremonyStepUp, challenge, user.ID, uuid.Nil)
+		options := h.relyingParty.RequestOptions(challenge, credentialDescriptors(h.credentialStore.FindByUserID(user.ID)))
+
+		return c.JSON(http.StatusOK, StepUpBeginResponse{
+			Method:    req.Method,
+			PublicKey: &options,
+		})
+
+	case StepUpMethodUMK:
+		challenge := h.challengeStore.Issue(user.ID, models.ChallengePurposeStepUp)
+
+		return c.JSON(http.StatusOK, StepUpBeginResponse{
+			Method:      req.Method,
+			ChallengeID: &challenge.ID,
+			Challenge:   base64.StdEncoding.EncodeToString(challenge.Value),
+			ExpiresAt:   &challenge.ExpiresAt,
+		})
+	}
+
+	return echo.NewHTTPError(http.StatusBadRequest, "step-up method needs no challenge")
+}
+
+// StepUp verifies a login factor and refreshes the session's authentication time
+func (h *AuthHandler) StepUp(c echo.Context) error {
+	user, session, err := h.stepUpContext(c)
+	if err != nil {
+		return err
+	}
+
+	var req StepUpRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request")
+	}
+
+	if !slices.Contains(h.stepUpMethods(user), req.Method) {
+		return echo.NewHTTPError(http.StatusBadRequest, "step-up method not available")
+	}
+
+	if req.Method == StepUpMethodTOTP {
+		if err := h.verifyTOTP(c, user.ID, req.Code); err != nil {
+			return err
+		}
+	} else {
+		lockoutKey := "step-up:user:" + user.ID.String()
+		if retry, allowed := h.lockoutStore.Attempt(lockoutKey, stepUpPolicy); !allowed {
+			setRetryAfter(c, retry)
+			return echo.NewHTTPError(http.StatusTooManyRequests, "too many step-up attempts, try again later")
+		}
+
+		if req.Method == StepUpMethodPasskey {
+			err = h.verifyStepUpPasskey(user, req.Assertion)
+		} else {
+			err = h.verifyStepUpUMK(user, req.ChallengeID, req.Proof)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	session, err = h.sessionStore.StepUp(session.ID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid or expired session")
+	}
+
+	return c.JSON(http.StatusOK, StepUpResponse{AuthenticatedAt: session.AuthenticatedAt})
+}
+
+// stepUpContext loads the session user and session; access tokens cannot step up
+func (h *AuthHandler) stepUpContext(c echo.Context) (*models.User, *models.Session, error) {
+	sessionID, ok := c.Get(middleware.SessionIDContextKey).(string)
+	if !ok {
+		return nil, nil, echo.NewHTTPError(http.StatusUnauthorized, "invalid session")
+	}
+
+	session, exists := h.sessionStore.FindByID(sessionID)
+	if !exists {
+		return nil, nil, echo.NewHTTPError(http.StatusUnauthorized, "invalid session")
+	}
+
+	user, exists := h.userStore.FindByID(session.UserID)
+	if !exists {
+		return nil, nil, echo.NewHTTPError(http.StatusNotFound, "user not found")
+	}
+
+	return user, session, nil
+}
+
+// stepUpMethods lists the factors a user has set up, strongest first. UMK is left
+// out only for accounts that never completed registration and so have no verifier.
+func (h *AuthHandler) stepUpMethods(user *models.User) []string {
+	methods := []string{}
+	if len(h.credentialStore.FindByUserID(user.ID)) > 0 {
+		methods = append(methods, StepUpMethodPasskey)
+	}
+	if h.totpStore.IsEnabled(user.ID) {
+		methods = append(methods, StepUpMethodTOTP)
+	}
+	if user.UMKVerifier != "" {
+		methods = append(methods, StepUpMethodUMK)
+	}
+	return methods
+}
+
+// verifyStepUpPasskey checks an assertion made by one of the user's own passkeys
+func (h *AuthHandler) verifyStepUpPasskey(user *models.User, assertion *webauthn.AssertionResponse) error {
+	if assertion == nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "assertion is required")
+	}
+
+	challenge, err := webauthn.ChallengeFromClientData(assertion.Response.ClientDataJSON)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	ceremony, exists := h.credentialStore.ConsumeCeremony(models.PasskeyCeremonyStepUp, challenge)
+	if !exists || ceremony.UserID != user.ID {
+		return echo.NewHTTPError(http.StatusBadRequest, "step-up ceremony not found or expired")
+	}
+
+	rawID, err := webauthn.DecodeBase64URL(assertion.RawID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid credential id")
+	}
+
+	credential, exists := h.credentialStore.FindByID(webauthn.EncodeBase64URL(rawID))
+	if !exists || credential.UserID != user.ID {
+		return echo.NewHTTPError(http.StatusUnauthorized, "unknown credential")
+	}
+
+	authData, err := h.relyingParty.VerifyAssertion(assertion, ceremony.Challenge, credential.PublicKey)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+
+	if err := h.credentialStore.UpdateSignCount(credential.ID, authData.SignCount); err != nil {
+		if errors.Is(err, store.ErrSignCountRegression) {
+			return echo.NewHTTPError(http.StatusUnauthorized, "credential sign count regressed; authenticator may be cloned")
+		}
+		return echo.NewHTTPError(http.StatusUnauthorized, "unknown credential")
+	}
+
+	return nil
+}
+
+// verifyStepUpUMK checks a MAC over a step-up challenge keyed with the user's UMK verifier
+func (h *AuthHandler) verifyStepUpUMK(user *models.User, challengeID, proof string) error {
+	id, err := uuid.Parse(challengeID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid challenge id")
+	}
+
+	challenge, exists := h.challengeStore.Consume(id, user.ID, models.ChallengePurposeStepUp)
+	if !exists {
+		return echo.NewHTTPError(http.StatusBadRequest, "challenge not found or expired")
+	}
+
+	if !verifyChallengeMAC(user.UMKVerifier, challenge.Value, user.ID, proof) {
+		return echo.NewHTTPError(http.StatusForbidden, "invalid proof")
+	}
+
+	return nil
+}
@@ -0,0 +1,268 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/middleware"
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/models"
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/store"
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/totp"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	totpBackupCodeCount  = 10
+	totpBackupCodeLength = 10
+)
+
+// totpVerifyPolicy limits guessing of one account's TOTP and backup codes. Every
+// attempt counts, so a mistyped code does not lock the user out straight away.
+var totpVerifyPolicy = store.LockoutPolicy{
+	Limit:       5,
+	Window:      15 * time.Minute,
+	BaseLockout: time.Minute,
+	MaxLockout:  24 * time.Hour,
+}
+
+// TOTPCodeRequest carries a code from the authenticator app or a backup code
+type TOTPCodeRequest struct {
+	Code string `json:"code"`
+}
+
+// TOTPStatusResponse describes the session user's two-factor setup
+type TOTPStatusResponse struct {
+	Enabled              bool       `json:"enabled"`
+	Pending              bool       `json:"pending"`
+	ConfirmedAt          *time.Time `json:"confirmed_at,omitempty"`
+	BackupCodesRemaining int        `json:"backup_codes_remaining"`
+}
+
+// TOTPEnrollResponse carries the new shared secret; the client shows OTPAuthURI as a QR code
+type TOTPEnrollResponse struct {
+	Secret     string    `json:"secret"`
+	OTPAuthURI string    `json:"otpauth_uri"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// TOTPBackupCodesResponse carries freshly issued backup codes; they are never shown again
+type TOTPBackupCodesResponse struct {
+	BackupCodes []string `json:"backup_codes"`
+}
+
+// GetTOTP returns whether two-factor authentication is enabled for the session user
+func (h *AuthHandler) GetTOTP(c echo.Context) error {
+	userID, ok := c.Get(middleware.UserIDContextKey).(uuid.UUID)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid session")
+	}
+
+	enrollment, exists := h.totpStore.Find(userID)
+	if !exists {
+		return c.JSON(http.StatusOK, TOTPStatusResponse{})
+	}
+
+	return c.JSON(http.StatusOK, TOTPStatusResponse{
+		Enabled:              enrollment.IsConfirmed(),
+		Pending:              !enrollment.IsConfirmed(),
+		ConfirmedAt:          enrollment.ConfirmedAt,
+		BackupCodesRemaining: enrollment.BackupCodesRemaining(),
+	})
+}
+
+// EnrollTOTP generates a shared secret for the session user. Two-factor
+// authentication is not enforced until the secret is confirmed with ConfirmTOTP.
+func (h *AuthHandler) EnrollTOTP(c echo.Context) error {
+	userID, ok := c.Get(middleware.UserIDContextKey).(uuid.UUID)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid session")
+	}
+
+	user, exists := h.userStore.FindByID(userID)
+	if !exists {
+		return echo.NewHTTPError(http.StatusNotFound, "user not found")
+	}
+
+	enrollment, err := h.totpStore.Begin(user.ID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusConflict, "two-factor authentication is already enabled")
+	}
+
+	return c.JSON(http.StatusOK, TOTPEnrollResponse{
+		Secret:     enrollment.Secret,
+		OTPAuthURI: totp.KeyURI(h.relyingParty.Name, user.Username, enrollment.Secret),
+		ExpiresAt:  enrollment.CreatedAt.Add(store.TOTPEnrollmentDuration),
+	})
+}
+
+// ConfirmTOTP enables two-factor authentication once the user enters a code from
+// the enrolled authenticator, and issues the backup codes
+func (h *AuthHandler) ConfirmTOTP(c echo.Context) error {
+	userID, ok := c.Get(middleware.UserIDContextKey).(uuid.UUID)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid session")
+	}
+
+	var req TOTPCodeRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request")
+	}
+
+	lockoutKey := totpLockoutKey(userID)
+	if retry, allowed := h.lockoutStore.Attempt(lockoutKey, totpVerifyPolicy); !allowed {
+		setRetryAfter(c, retry)
+		return echo.NewHTTPError(http.StatusTooManyRequests, "too many two-factor attempts, try again later")
+	}
+
+	backupCodes := newTOTPBackupCodes()
+	if err := h.totpStore.Confirm(userID, req.Code, backupCodes); err != nil {
+		switch {
+		case errors.Is(err, store.ErrTOTPAlreadyEnabled):
+			return echo.NewHTTPError(http.StatusConflict, "two-factor authentication is already enabled")
+		case errors.Is(err, store.ErrTOTPNotPending):
+			return echo.NewHTTPError(http.StatusNotFound, "no pending two-factor enrollment")
+		}
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid two-factor code")
+	}
+
+	return c.JSON(http.StatusOK, TOTPBackupCodesResponse{BackupCodes: backupCodes})
+}
+
+// DisableTOTP turns two-factor authentication off; it takes a current code so a
+// hijacked session alone cannot remove the second factor
+func (h *AuthHandler) DisableTOTP(c echo.Context) error {
+	userID, ok := c.Get(middleware.UserIDContextKey).(uuid.UUID)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid session")
+	}
+
+	var req TOTPCodeRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request")
+	}
+
+	if err := h.verifyTOTP(c, userID, req.Code); err != nil {
+		return err
+	}
+
+	h.totpStore.Disable(userID)
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// RegenerateTOTPBackupCodes replaces the backup codes after a valid code is entered
+func (h *AuthHandler) RegenerateTOTPBackupCodes(c echo.Context) error {
+	userID, ok := c.Get(middleware.UserIDContextKey).(uuid.UUID)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid session")
+	}
+
+	var req TOTPCodeRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request")
+	}
+
+	if err := h.verifyTOTP(c, userID, req.Code); err != nil {
+		return err
+	}
+
+	backupCodes := newTOTPBackupCodes()
+	if err := h.totpStore.ReplaceBackupCodes(userID, backupCodes); err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "two-factor authentication is not enabled")
+	}
+
+	return c.JSON(http.StatusOK, TOTPBackupCodesResponse{BackupCodes: backupCodes})
+}
+
+// LoginTOTP completes a login that stopped at the second factor. The pre-auth
+// session is upgraded in place and gets a new cookie and CSRF token.
+func (h *AuthHandler) LoginTOTP(c echo.Context) error {
+	userID, ok := c.Get(middleware.UserIDContextKey).(uuid.UUID)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid session")
+	}
+
+	var req TOTPCodeRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request")
+	}
+
+	sessionID, _ := c.Get(middleware.SessionIDContextKey).(string)
+	session, exists := h.sessionStore.FindByID(sessionID)
+	if !exists {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid session")
+	}
+
+	if !session.MFAPending {
+		return echo.NewHTTPError(http.StatusConflict, "session is already fully authenticated")
+	}
+
+	// A decoy's second factor never verifies, but counts toward the lockout like a
+	// wrong code would
+	if session.DecoyUsername != "" {
+		if retry, allowed := h.lockoutStore.Attempt(totpLockoutKey(userID), totpVerifyPolicy); !allowed {
+			setRetryAfter(c, retry)
+			return echo.NewHTTPError(http.StatusTooManyRequests, "too many two-factor attempts, try again later")
+		}
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid two-factor code")
+	}
+
+	if err := h.verifyTOTP(c, userID, req.Code); err != nil {
+		return err
+	}
+
+	session, token, err := h.sessionStore.CompleteMFA(session.ID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid or expired session")
+	}
+	middleware.SetSessionCookie(c, session, token)
+
+	user, exists := h.userStore.FindByID(userID)
+	if !exists {
+		return echo.NewHTTPError(http.StatusNotFound, "user not found")
+	}
+
+	var device *models.Device
+	if session.DeviceID != nil {
+		if foundDevice, ok := h.deviceStore.FindByID(*session.DeviceID); ok && foundDevice.UserID == user.ID {
+			device = foundDevice
+		}
+	}
+
+	return c.JSON(http.StatusOK, h.newLoginResponse(user, device, session))
+}
+
+// verifyTOTP checks a TOTP or backup code for userID under totpVerifyPolicy
+func (h *AuthHandler) verifyTOTP(c echo.Context, userID uuid.UUID, code string) error {
+	lockoutKey := totpLockoutKey(userID)
+	if retry, allowed := h.lockoutStore.Attempt(lockoutKey, totpVerifyPolicy); !allowed {
+		setRetryAfter(c, retry)
+		return echo.NewHTTPError(http.StatusTooManyRequests, "too many two-factor attempts, try again later")
+	}
+
+	if _, err := h.totpStore.Verify(userID, code); err != nil {
+		if errors.Is(err, store.ErrTOTPNotEnabled) {
+			return echo.NewHTTPError(http.StatusNotFound, "two-factor authentication is not enabled")
+		}
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid two-factor code")
+	}
+
+	return nil
+}
+
+func totpLockoutKey(userID uuid.UUID) string {
+	return "totp:user:" + userID.String()
+}
+
+// newTOTPBackupCodes returns a set of random backup codes formatted as XXXXX-XXXXX
+func newTOTPBackupCodes() []string {
+	codes := make([]string, totpBackupCodeCount)
+	for i := range codes {
+		code := rand.Text()[:totpBackupCodeLength]
+		codes[i] = code[:totpBackupCodeLength/2] + "-" + code[totpBackupCodeLength/2:]
+	}
+	return codes
+}
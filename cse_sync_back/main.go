@@ -1,57 +1,267 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
+	"log"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/handlers"
 	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/middleware"
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/models"
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/oidc"
 	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/store"
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/username"
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/webauthn"
 	"github.com/labstack/echo/v4"
 	echoMiddleware "github.com/labstack/echo/v4/middleware"
 )
 
+var allowedOrigins = []string{"http://localhost:5173"}
+
+const minAdminTokenLength = 32
+
+var (
+	// authRateLimitPolicy covers the anonymous sign-up and sign-in routes, and
+	// guardian setup, which also tells whether usernames exist
+	authRateLimitPolicy = store.RateLimitPolicy{Name: "auth", Burst: 30, Interval: 4 * time.Second}
+	// recoveryRateLimitPolicy covers routes that hand out recovery material
+	recoveryRateLimitPolicy = store.RateLimitPolicy{Name: "recovery", Burst: 5, Interval: time.Minute}
+	// messageRateLimitPolicy covers message writes and the anonymous peer reads
+	messageRateLimitPolicy = store.RateLimitPolicy{Name: "messages", Burst: 60, Interval: time.Second}
+)
+
 func main() {
 	// Initialize stores
 	userStore := store.NewUserStore()
 	sessionStore := store.NewSessionStore()
 	deviceStore := store.NewDeviceStore()
 	messageStore := store.NewMessageStore()
+	credentialStore := store.NewCredentialStore()
+	enrollmentStore := store.NewEnrollmentStore()
+	pairingStore := store.NewPairingStore()
+	challengeStore := store.NewChallengeStore()
+	lockoutStore := store.NewLockoutStore()
+	auditStore := store.NewAuditStore()
+	socialRecoveryStore := store.NewSocialRecoveryStore()
+	notificationStore := store.NewNotificationStore()
+	recoveryCodeStore := store.NewRecoveryCodeStore()
+	accessTokenStore := store.NewAccessTokenStore()
+	oidcLoginStore := store.NewOIDCLoginStore()
+	totpStore := store.NewTOTPStore()
+	inviteStore := store.NewInviteStore()
+	registrationStore := store.NewRegistrationStore(inviteStore)
+	powStore := store.NewPoWStore()
+	rateLimiter := store.NewMemoryRateLimiter()
+	accountDeletionStore := store.NewAccountDeletionStore(store.NewAccountPurger(
+		userStore, sessionStore, deviceStore, messageStore, credentialStore, accessTokenStore, recoveryCodeStore,
+		totpStore, enrollmentStore, socialRecoveryStore, notificationStore, auditStore,
+	), auditStore)
+
+	// WebAuthn relying party for passkeys
+	relyingParty := &webauthn.RelyingParty{
+		ID:      "localhost",
+		Name:    "CSE Sync",
+		Origins: allowedOrigins,
+		Timeout: store.PasskeyCeremonyDuration,
+	}
+
+	usernamePolicy := configureUsernamePolicy()
+
+	// Decoys for nonexistent accounts must not change across restarts
+	decoys, err := handlers.NewDecoyGenerator(decoySecret())
+	if err != nil {
+		log.Fatalf("invalid DECOY_SECRET: %v", err)
+	}
 
 	// Initialize handlers
-	authHandler := handlers.NewAuthHandler(userStore, sessionStore, deviceStore)
+	authHandler := handlers.NewAuthHandler(userStore, sessionStore, registrationStore, deviceStore, credentialStore, recoveryCodeStore, totpStore, lockoutStore, challengeStore, decoys, usernamePolicy, relyingParty)
 	messageHandler := handlers.NewMessageHandler(userStore, messageStore)
-	deviceHandler := handlers.NewDeviceHandler(deviceStore)
+	deviceHandler := handlers.NewDeviceHandler(deviceStore, sessionStore)
+	enrollmentHandler := handlers.NewEnrollmentHandler(enrollmentStore, deviceStore, sessionStore)
+	pairingHandler := handlers.NewPairingHandler(pairingStore, allowedOrigins[0]+"/pair")
+	recoveryHandler := handlers.NewRecoveryHandler(userStore, challengeStore, lockoutStore, auditStore, recoveryCodeStore, decoys)
+	socialRecoveryHandler := handlers.NewSocialRecoveryHandler(socialRecoveryStore, userStore, notificationStore)
+	notificationHandler := handlers.NewNotificationHandler(notificationStore)
+	sessionHandler := handlers.NewSessionHandler(sessionStore)
+	accessTokenHandler := handlers.NewAccessTokenHandler(accessTokenStore)
+	accountHandler := handlers.NewAccountHandler(userStore, accountDeletionStore, usernamePolicy)
+	adminHandler := handlers.NewAdminHandler(inviteStore)
+	powHandler := handlers.NewPoWHandler(powStore)
 	debugHandler := handlers.NewDebugHandler(userStore, sessionStore, deviceStore, messageStore)
 
+	authHandler.SetRegistrationMode(registrationMode(), inviteStore)
+
+	// Single sign-on is enabled when an issuer is configured
+	oidcProvider := discoverOIDCProvider()
+	if oidcProvider != nil {
+		authHandler.EnableOIDC(oidcProvider, oidcLoginStore)
+	}
+
 	// Create Echo instance
 	e := echo.New()
+	// Per-IP limits rely on c.RealIP, which must not trust client-supplied headers
+	e.IPExtractor = configureIPExtractor()
 
 	// Middleware
 	e.Use(echoMiddleware.Logger())
 	e.Use(echoMiddleware.Recover())
 	e.Use(echoMiddleware.CORSWithConfig(echoMiddleware.CORSConfig{
-		AllowOrigins:     []string{"http://localhost:5173"},
+		AllowOrigins:     allowedOrigins,
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Content-Type", "Authorization"},
+		AllowHeaders:     []string{"Content-Type", "Authorization", handlers.PairingTokenHeader, middleware.CSRFTokenHeader, middleware.PoWChallengeHeader, middleware.PoWNonceHeader},
+		ExposeHeaders:    []string{echo.HeaderRetryAfter, middleware.RateLimitLimitHeader, middleware.RateLimitRemainingHeader, middleware.RateLimitResetHeader},
 		AllowCredentials: true,
 	}))
+	e.Use(middleware.OriginMiddleware(allowedOrigins))
+
+	// Anonymous entry points, and guardian setup, cost the client a solved
+	// proof-of-work challenge
+	requirePoW := middleware.ProofOfWorkMiddleware(powStore)
+
+	// Token-bucket rate limits; per-user keys only apply behind SessionMiddleware
+	authRateLimit := middleware.RateLimitMiddleware(rateLimiter, authRateLimitPolicy, middleware.RateLimitByIP)
+	recoveryRateLimit := middleware.RateLimitMiddleware(rateLimiter, recoveryRateLimitPolicy, middleware.RateLimitByIPAndUser)
+	messageRateLimit := middleware.RateLimitMiddleware(rateLimiter, messageRateLimitPolicy, middleware.RateLimitByUser)
 
 	// Public routes
-	e.POST("/api/register/init", authHandler.RegisterInit)
-	e.POST("/api/register", authHandler.Register)
-	e.POST("/api/login", authHandler.Login)
-	e.GET("/api/debug", debugHandler.GetDebugInfo)
+	e.POST("/api/pow/challenge", powHandler.CreateChallenge, authRateLimit)
+	e.GET("/api/register/mode", authHandler.GetRegistrationMode)
+	e.POST("/api/register/init", authHandler.RegisterInit, authRateLimit, requirePoW)
+	e.POST("/api/register", authHandler.Register, authRateLimit, middleware.CSRFMiddleware(sessionStore))
+	e.POST("/api/login", authHandler.Login, authRateLimit, requirePoW)
+	e.GET("/api/recovery/kdf-policy", recoveryHandler.GetKDFPolicy)
+	e.POST("/api/passkeys/login/begin", authHandler.PasskeyLoginBegin, authRateLimit)
+	e.POST("/api/passkeys/login/finish", authHandler.PasskeyLoginFinish, authRateLimit)
+	e.POST("/api/pairings/redeem", pairingHandler.RedeemPairing, authRateLimit)
+	e.POST("/api/pairings/:pairingID/peer/messages", pairingHandler.PeerSendMessage, messageRateLimit)
+	e.GET("/api/pairings/:pairingID/peer/messages", pairingHandler.PeerGetMessages, messageRateLimit)
+	if oidcProvider != nil {
+		e.POST("/api/oidc/begin", authHandler.OIDCBegin, authRateLimit)
+		e.POST("/api/oidc/finish", authHandler.OIDCFinish, authRateLimit)
+	}
+
+	// Routes callable with a personal access token and the scope each requires
+	accessTokenScopes := middleware.RouteScopes{
+		"GET /api/messages":          models.ScopeMessagesRead,
+		"POST /api/messages":         models.ScopeMessagesWrite,
+		"GET /api/devices/:deviceID": models.ScopeDevicesRead,
+	}
+
+	// Routes a pre-auth session may call before its second factor is verified
+	preAuthRoutes := []string{
+		"GET /api/session",
+		"POST /api/logout",
+		"POST /api/login/totp",
+	}
+
+	// Routes a registration session may call before its sign-up completes
+	registrationRoutes := []string{
+		"GET /api/session",
+		"POST /api/logout",
+	}
+
+	// Routes a decoy session may call; they answer with decoy data
+	decoyRoutes := []string{
+		"GET /api/session",
+		"POST /api/logout",
+		"GET /api/recovery",
+		"POST /api/recovery/unlock/challenge",
+		"POST /api/login/totp",
+	}
+
+	// High-risk routes need a login factor proved within StepUpMaxAge
+	requireRecentAuth := middleware.RecentAuthMiddleware(handlers.StepUpMaxAge)
+
+	// Operator API, enabled when an admin token is configured
+	if adminToken := configureAdminToken(); adminToken != "" {
+		admin := e.Group("/api/admin", middleware.AdminMiddleware(adminToken))
+		admin.POST("/invites", adminHandler.CreateInvite)
+		admin.GET("/invites", adminHandler.ListInvites)
+		admin.DELETE("/invites/:inviteID", adminHandler.RevokeInvite)
+
+		// The store dump is only for local development
+		if devMode() {
+			admin.GET("/debug", debugHandler.GetDebugInfo)
+		}
+	} else if devMode() {
+		log.Println("ADMIN_TOKEN is not set; the debug endpoint is disabled")
+	}
 
 	// Protected routes
 	protected := e.Group("/api")
-	protected.Use(middleware.SessionMiddleware(sessionStore, userStore))
+	protected.Use(middleware.SessionMiddleware(sessionStore, accessTokenStore, userStore, accessTokenScopes))
+	protected.Use(middleware.MFAMiddleware(preAuthRoutes))
+	protected.Use(middleware.RegistrationMiddleware(registrationRoutes))
+	protected.Use(middleware.DecoyMiddleware(decoyRoutes))
+	protected.Use(middleware.CSRFMiddleware(sessionStore))
 	protected.GET("/session", authHandler.GetSession)
+	protected.GET("/session/step-up", authHandler.GetStepUp)
+	protected.POST("/session/step-up/begin", authHandler.BeginStepUp)
+	protected.POST("/session/step-up", authHandler.StepUp)
 	protected.POST("/logout", authHandler.Logout)
-	protected.POST("/messages", messageHandler.SendMessage)
+	protected.POST("/login/totp", authHandler.LoginTOTP)
+	protected.DELETE("/account", accountHandler.DeleteAccount, requireRecentAuth)
+	protected.PUT("/account/username", accountHandler.ChangeUsername, requireRecentAuth)
+	protected.GET("/account/deletion", accountHandler.GetAccountDeletion)
+	protected.POST("/account/deletion/cancel", accountHandler.CancelAccountDeletion)
+	protected.GET("/totp", authHandler.GetTOTP)
+	protected.POST("/totp/enroll", authHandler.EnrollTOTP)
+	protected.POST("/totp/confirm", authHandler.ConfirmTOTP)
+	protected.POST("/totp/disable", authHandler.DisableTOTP)
+	protected.POST("/totp/backup-codes", authHandler.RegenerateTOTPBackupCodes)
+	protected.GET("/sessions", sessionHandler.ListSessions)
+	protected.POST("/sessions/revoke-others", sessionHandler.RevokeOtherSessions)
+	protected.DELETE("/sessions/:sessionID", sessionHandler.RevokeSession)
+	protected.GET("/access-tokens", accessTokenHandler.ListAccessTokens)
+	protected.POST("/access-tokens", accessTokenHandler.CreateAccessToken, requireRecentAuth)
+	protected.DELETE("/access-tokens/:tokenID", accessTokenHandler.RevokeAccessToken)
+	protected.POST("/messages", messageHandler.SendMessage, messageRateLimit)
 	protected.GET("/messages", messageHandler.GetMessages)
-	protected.GET("/recovery", authHandler.GetRecovery)
-	protected.POST("/devices", deviceHandler.RegisterDevice)
+	protected.GET("/recovery", recoveryHandler.GetRecovery, recoveryRateLimit, requireRecentAuth)
+	protected.PUT("/recovery", recoveryHandler.RotateRecovery, requireRecentAuth)
+	protected.POST("/recovery/challenge", recoveryHandler.CreateRecoveryChallenge)
+	protected.POST("/recovery/rollback", recoveryHandler.RollbackRecovery, requireRecentAuth)
+	protected.POST("/recovery/unlock/challenge", recoveryHandler.CreateUnlockChallenge)
+	protected.POST("/recovery/unlock", recoveryHandler.UnlockRecovery, recoveryRateLimit, requireRecentAuth)
+	protected.GET("/recovery/audit", recoveryHandler.GetRecoveryAudit)
+	protected.GET("/recovery/codes", recoveryHandler.GetRecoveryCodesStatus)
+	protected.PUT("/recovery/codes", recoveryHandler.RegenerateRecoveryCodes, requireRecentAuth)
+	protected.POST("/recovery/codes/lookup", recoveryHandler.LookupRecoveryCode, recoveryRateLimit, requireRecentAuth)
+	protected.POST("/recovery/codes/burn", recoveryHandler.BurnRecoveryCode)
+	protected.PUT("/social-recovery", socialRecoveryHandler.SetupSocialRecovery, authRateLimit, requirePoW, requireRecentAuth)
+	protected.GET("/social-recovery", socialRecoveryHandler.GetSocialRecovery)
+	protected.DELETE("/social-recovery", socialRecoveryHandler.DeleteSocialRecovery, requireRecentAuth)
+	protected.POST("/social-recovery/requests", socialRecoveryHandler.CreateRecoveryRequest)
+	protected.GET("/social-recovery/requests/:requestID", socialRecoveryHandler.GetRecoveryRequest)
+	protected.DELETE("/social-recovery/requests/:requestID", socialRecoveryHandler.CancelRecoveryRequest)
+	protected.POST("/social-recovery/requests/:requestID/approve", socialRecoveryHandler.ApproveRecoveryRequest)
+	protected.POST("/social-recovery/requests/:requestID/reject", socialRecoveryHandler.RejectRecoveryRequest)
+	protected.GET("/social-recovery/guardian/requests", socialRecoveryHandler.ListGuardianRequests)
+	protected.GET("/notifications", notificationHandler.GetNotifications)
+	protected.POST("/notifications/:notificationID/read", notificationHandler.MarkNotificationRead)
+	protected.POST("/devices", deviceHandler.RegisterDevice, requireRecentAuth)
 	protected.GET("/devices/:deviceID", deviceHandler.GetDevice)
+	protected.DELETE("/devices/:deviceID", deviceHandler.RevokeDevice, requireRecentAuth)
+	protected.PUT("/devices/:deviceID/wrapped-umk", deviceHandler.UpdateWrappedUMK)
+	protected.POST("/passkeys/register/begin", authHandler.PasskeyRegisterBegin, requireRecentAuth)
+	protected.POST("/passkeys/register/finish", authHandler.PasskeyRegisterFinish, requireRecentAuth)
+	protected.POST("/enrollments", enrollmentHandler.RequestEnrollment)
+	protected.GET("/enrollments", enrollmentHandler.ListEnrollments)
+	protected.GET("/enrollments/:enrollmentID", enrollmentHandler.GetEnrollment)
+	protected.POST("/enrollments/:enrollmentID/approve", enrollmentHandler.ApproveEnrollment, requireRecentAuth)
+	protected.POST("/enrollments/:enrollmentID/reject", enrollmentHandler.RejectEnrollment)
+	protected.POST("/enrollments/:enrollmentID/complete", enrollmentHandler.CompleteEnrollment)
+	protected.POST("/pairings", pairingHandler.CreatePairing)
+	protected.GET("/pairings/:pairingID", pairingHandler.GetPairing)
+	protected.DELETE("/pairings/:pairingID", pairingHandler.DeletePairing)
+	protected.POST("/pairings/:pairingID/messages", pairingHandler.InitiatorSendMessage)
+	protected.GET("/pairings/:pairingID/messages", pairingHandler.InitiatorGetMessages)
 
 	// Start cleanup goroutine
 	go func() {
@@ -59,9 +269,184 @@ func main() {
 		defer ticker.Stop()
 		for range ticker.C {
 			sessionStore.CleanupExpired()
+			registrationStore.CleanupExpired()
+			userStore.CleanupExpired()
+			credentialStore.CleanupExpired()
+			enrollmentStore.CleanupExpired()
+			pairingStore.CleanupExpired()
+			challengeStore.CleanupExpired()
+			lockoutStore.CleanupExpired()
+			auditStore.CleanupExpired()
+			socialRecoveryStore.CleanupExpired()
+			notificationStore.CleanupExpired()
+			accessTokenStore.CleanupExpired()
+			oidcLoginStore.CleanupExpired()
+			totpStore.CleanupExpired()
+			inviteStore.CleanupExpired()
+			powStore.CleanupExpired()
+			rateLimiter.CleanupExpired()
+			for _, deletion := range accountDeletionStore.PurgeDue() {
+				if deletion.Status == models.AccountDeletionStatusFailed {
+					log.Printf("account deletion %s of user %s failed: %s", deletion.ID, deletion.UserID, deletion.Error)
+				}
+			}
+			userStore.ExpireRecoveryRollbacks(handlers.RecoveryRollbackWindow)
 		}
 	}()
 
 	// Start server
 	e.Logger.Fatal(e.Start(":8080"))
 }
+
+// discoverOIDCProvider configures single sign-on from OIDC_ISSUER, OIDC_CLIENT_ID,
+// OIDC_CLIENT_SECRET, OIDC_REDIRECT_URL and OIDC_SCOPES. It returns nil when no issuer is set.
+func discoverOIDCProvider() *oidc.Provider {
+	issuer := os.Getenv("OIDC_ISSUER")
+	if issuer == "" {
+		return nil
+	}
+
+	redirectURL := os.Getenv("OIDC_REDIRECT_URL")
+	if redirectURL == "" {
+		redirectURL = allowedOrigins[0] + "/oidc/callback"
+	}
+
+	scopes := []string{"profile", "email"}
+	if configured := os.Getenv("OIDC_SCOPES"); configured != "" {
+		scopes = strings.Fields(configured)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	provider, err := oidc.Discover(ctx, oidc.Config{
+		Issuer:       issuer,
+		ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+		ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+		RedirectURL:  redirectURL,
+		Scopes:       scopes,
+	})
+	if err != nil {
+		log.Fatalf("failed to configure single sign-on: %v", err)
+	}
+
+	return provider
+}
+
+// decoySecret returns the key decoy accounts are derived from, taken from
+// DECOY_SECRET. Without it a random key is used and decoys change on restart.
+func decoySecret() []byte {
+	if secret := os.Getenv("DECOY_SECRET"); secret != "" {
+		return []byte(secret)
+	}
+
+	log.Println("DECOY_SECRET is not set; decoy accounts will change when the server restarts")
+	secret := make([]byte, 32)
+	rand.Read(secret)
+	return secret
+}
+
+// configureUsernamePolicy starts from username.DefaultPolicy and applies
+// USERNAME_CHARSET (ascii or unicode), USERNAME_MIN_LENGTH, USERNAME_MAX_LENGTH
+// and USERNAME_RESERVED, a comma-separated list of names reserved in addition to
+// the defaults
+func configureUsernamePolicy() username.Policy {
+	policy := username.DefaultPolicy
+
+	if charset := os.Getenv("USERNAME_CHARSET"); charset != "" {
+		policy.Charset = charset
+	}
+
+	for name, length := range map[string]*int{
+		"USERNAME_MIN_LENGTH": &policy.MinLength,
+		"USERNAME_MAX_LENGTH": &policy.MaxLength,
+	} {
+		if value := os.Getenv(name); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil {
+				log.Fatalf("invalid %s: %v", name, err)
+			}
+			*length = parsed
+		}
+	}
+
+	if reserved := os.Getenv("USERNAME_RESERVED"); reserved != "" {
+		policy.Reserved = append(slices.Clone(policy.Reserved), strings.Split(reserved, ",")...)
+	}
+
+	if err := policy.Check(); err != nil {
+		log.Fatalf("invalid username policy: %v", err)
+	}
+
+	return policy
+}
+
+// registrationMode returns REGISTRATION_MODE: open (the default), invite or closed
+func registrationMode() string {
+	mode := os.Getenv("REGISTRATION_MODE")
+	switch mode {
+	case "":
+		return models.RegistrationModeOpen
+	case models.RegistrationModeOpen, models.RegistrationModeInvite, models.RegistrationModeClosed:
+		return mode
+	}
+
+	log.Fatalf("invalid REGISTRATION_MODE %q: use open, invite or closed", mode)
+	return ""
+}
+
+// configureAdminToken returns ADMIN_TOKEN, the bearer token of the operator API.
+// The API is disabled when it is unset.
+func configureAdminToken() string {
+	token := os.Getenv("ADMIN_TOKEN")
+	if token == "" {
+		if registrationMode() == models.RegistrationModeInvite {
+			log.Println("ADMIN_TOKEN is not set; no invites can be issued while registration is invite-only")
+		}
+		return ""
+	}
+
+	if len(token) < minAdminTokenLength {
+		log.Fatalf("ADMIN_TOKEN must be at least %d characters", minAdminTokenLength)
+	}
+	return token
+}
+
+// devMode reports whether DEV_MODE enables development-only endpoints
+func devMode() bool {
+	value := os.Getenv("DEV_MODE")
+	if value == "" {
+		return false
+	}
+
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Fatalf("invalid DEV_MODE %q: %v", value, err)
+	}
+	return enabled
+}
+
+// configureIPExtractor uses the connection's address unless TRUSTED_PROXIES lists the
+// CIDR ranges of reverse proxies whose X-Forwarded-For entries may be believed
+func configureIPExtractor() echo.IPExtractor {
+	configured := os.Getenv("TRUSTED_PROXIES")
+	if configured == "" {
+		return echo.ExtractIPDirect()
+	}
+
+	// Only the listed ranges are trusted, not the loopback and private defaults
+	options := []echo.TrustOption{
+		echo.TrustLoopback(false),
+		echo.TrustLinkLocal(false),
+		echo.TrustPrivateNet(false),
+	}
+	for _, cidr := range strings.Split(configured, ",") {
+		_, ipNet, err := net.ParseCIDR(strings.TrimSpace(cidr))
+		if err != nil {
+			log.Fatalf("invalid TRUSTED_PROXIES entry %q: %v", cidr, err)
+		}
+		options = append(options, echo.TrustIPRange(ipNet))
+	}
+
+	return echo.ExtractIPFromXFFHeader(options...)
+}
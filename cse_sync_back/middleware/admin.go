@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// AdminMiddleware admits requests that present adminToken as a bearer token.
+// Admin routes are for operators and scripts and do not use sessions.
+func AdminMiddleware(adminToken string) echo.MiddlewareFunc {
+	expected := sha256.Sum256([]byte(adminToken))
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			token, ok := strings.CutPrefix(c.Request().Header.Get(echo.HeaderAuthorization), bearerPrefix)
+			presented := sha256.Sum256([]byte(token))
+			if !ok || subtle.ConstantTimeCompare(presented[:], expected[:]) != 1 {
+				return echo.NewHTTPError(http.StatusUnauthorized, "admin credential required")
+			}
+
+			return next(c)
+		}
+	}
+}
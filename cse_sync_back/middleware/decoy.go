@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/labstack/echo/v4"
+)
+
+// DecoyMiddleware confines decoy sessions, issued for logins of nonexistent
+// accounts, to decoyRoutes ("METHOD /route/path"), whose handlers answer them with
+// decoy data. Anywhere else the session is treated as expired. It must run after
+// SessionMiddleware.
+func DecoyMiddleware(decoyRoutes []string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if _, decoy := c.Get(DecoyUsernameContextKey).(string); !decoy {
+				return next(c)
+			}
+
+			if !slices.Contains(decoyRoutes, c.Request().Method+" "+c.Path()) {
+				ClearSessionCookie(c)
+				return echo.NewHTTPError(http.StatusUnauthorized, "invalid or expired session")
+			}
+
+			return next(c)
+		}
+	}
+}
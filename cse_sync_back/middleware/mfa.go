@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/labstack/echo/v4"
+)
+
+// MFAPendingContextKey is set to true while the session still awaits its second factor
+const MFAPendingContextKey = "mfa_pending"
+
+// MFAMiddleware confines pre-auth sessions, whose user has not yet entered their
+// second factor, to preAuthRoutes ("METHOD /route/path"). It must run after
+// SessionMiddleware.
+func MFAMiddleware(preAuthRoutes []string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if pending, _ := c.Get(MFAPendingContextKey).(bool); !pending {
+				return next(c)
+			}
+
+			if !slices.Contains(preAuthRoutes, c.Request().Method+" "+c.Path()) {
+				return echo.NewHTTPError(http.StatusForbidden, "two-factor authentication required")
+			}
+
+			return next(c)
+		}
+	}
+}
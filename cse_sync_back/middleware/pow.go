@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/store"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// Proof-of-work headers name the challenge being answered and carry its solution
+const (
+	PoWChallengeHeader = "X-PoW-Challenge"
+	PoWNonceHeader     = "X-PoW-Nonce"
+)
+
+// ProofOfWorkMiddleware requires a solved, unused challenge from powStore before
+// the route does any work. Challenges are bound to the address they were issued to.
+func ProofOfWorkMiddleware(powStore *store.PoWStore) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			header := c.Request().Header
+			if header.Get(PoWChallengeHeader) == "" || header.Get(PoWNonceHeader) == "" {
+				return echo.NewHTTPError(http.StatusPreconditionRequired, "proof of work required")
+			}
+
+			challengeID, err := uuid.Parse(header.Get(PoWChallengeHeader))
+			if err != nil {
+				return echo.NewHTTPError(http.StatusForbidden, "invalid proof of work")
+			}
+
+			if err := powStore.Redeem(challengeID, header.Get(PoWNonceHeader), c.RealIP()); err != nil {
+				return echo.NewHTTPError(http.StatusForbidden, "invalid proof of work")
+			}
+
+			return next(c)
+		}
+	}
+}
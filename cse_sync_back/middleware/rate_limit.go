@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/store"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// Rate limit headers, following the IETF RateLimit header fields draft
+const (
+	RateLimitLimitHeader     = "RateLimit-Limit"
+	RateLimitRemainingHeader = "RateLimit-Remaining"
+	RateLimitResetHeader     = "RateLimit-Reset"
+)
+
+// RateLimitKey chooses what a rate limit counts requests by
+type RateLimitKey int
+
+const (
+	// RateLimitByIP counts requests per client address
+	RateLimitByIP RateLimitKey = iota
+	// RateLimitByUser counts requests per authenticated user, and per client
+	// address on requests without one
+	RateLimitByUser
+	// RateLimitByIPAndUser keeps both buckets and rejects a request when either is empty
+	RateLimitByIPAndUser
+)
+
+// RateLimitMiddleware rejects requests with 429 once their bucket under policy is
+// empty. Responses carry RateLimit-* headers for the most constrained bucket and
+// rejections carry Retry-After. Keying by user needs SessionMiddleware to run first.
+func RateLimitMiddleware(limiter store.RateLimiter, policy store.RateLimitPolicy, key RateLimitKey) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			userID, authenticated := c.Get(UserIDContextKey).(uuid.UUID)
+
+			var keys []string
+			if key != RateLimitByUser || !authenticated {
+				keys = append(keys, "ip:"+c.RealIP())
+			}
+			if key != RateLimitByIP && authenticated {
+				keys = append(keys, "user:"+userID.String())
+			}
+
+			var result store.RateLimitResult
+			for i, k := range keys {
+				taken := limiter.Take(k, policy)
+				if i == 0 || !taken.Allowed || taken.Remaining < result.Remaining {
+					result = taken
+				}
+				if !taken.Allowed {
+					break
+				}
+			}
+
+			header := c.Response().Header()
+			header.Set(RateLimitLimitHeader, strconv.Itoa(result.Limit))
+			header.Set(RateLimitRemainingHeader, strconv.Itoa(result.Remaining))
+			header.Set(RateLimitResetHeader, strconv.Itoa(ceilSeconds(result.Reset)))
+
+			if !result.Allowed {
+				header.Set(echo.HeaderRetryAfter, strconv.Itoa(max(ceilSeconds(result.RetryAfter), 1)))
+				return echo.NewHTTPError(http.StatusTooManyRequests, "rate limit exceeded, try again later")
+			}
+
+			return next(c)
+		}
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int((d + time.Second - 1) / time.Second)
+}
@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/labstack/echo/v4"
+)
+
+// RegistrationPendingContextKey is set to true while the session's sign-up has not completed
+const RegistrationPendingContextKey = "registration_pending"
+
+// RegistrationMiddleware confines registration sessions, whose account does not
+// exist until registration completes, to registrationRoutes ("METHOD /route/path").
+// It must run after SessionMiddleware.
+func RegistrationMiddleware(registrationRoutes []string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if pending, _ := c.Get(RegistrationPendingContextKey).(bool); !pending {
+				return next(c)
+			}
+
+			if !slices.Contains(registrationRoutes, c.Request().Method+" "+c.Path()) {
+				return echo.NewHTTPError(http.StatusForbidden, "registration not complete")
+			}
+
+			return next(c)
+		}
+	}
+}
@@ -1,35 +1,125 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/models"
 	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/store"
 	"github.com/labstack/echo/v4"
 )
 
 const (
-	SessionCookieName = "session_id"
-	UserIDContextKey  = "user_id"
+	SessionCookieName     = "session_id"
+	UserIDContextKey      = "user_id"
+	SessionIDContextKey   = "session_id"
+	AccessTokenContextKey = "access_token"
+	// AuthenticatedAtContextKey holds the session's AuthenticatedAt for RecentAuthMiddleware
+	AuthenticatedAtContextKey = "authenticated_at"
+	// DecoyUsernameContextKey holds the username a decoy session was issued for
+	DecoyUsernameContextKey = "decoy_username"
 )
 
-// SessionMiddleware validates session from cookie
-func SessionMiddleware(sessionStore *store.SessionStore, userStore *store.UserStore) echo.MiddlewareFunc {
+const bearerPrefix = "Bearer "
+
+// RouteScopes maps "METHOD /route/path" to the scope an access token needs for that route.
+// Routes that are not listed cannot be called with an access token.
+type RouteScopes map[string]string
+
+// SessionMiddleware authenticates the request either with an `Authorization: Bearer`
+// personal access token or with the session cookie.
+//
+// Access tokens are only accepted on routes listed in routeScopes and must carry the
+// listed scope; the token is stored in context under AccessTokenContextKey and no
+// session ID is set.
+//
+// For cookies it slides the session's idle timeout and reissues the cookie whenever
+// the session token is rotated. The stable session ID is stored in context; the
+// token only ever lives in the cookie. Whether the session is still waiting for its
+// second factor is stored under MFAPendingContextKey for MFAMiddleware.
+func SessionMiddleware(sessionStore *store.SessionStore, accessTokenStore *store.AccessTokenStore, userStore *store.UserStore, routeScopes RouteScopes) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
+			if authorization := c.Request().Header.Get(echo.HeaderAuthorization); authorization != "" {
+				bearer, ok := strings.CutPrefix(authorization, bearerPrefix)
+				if !ok || bearer == "" {
+					return echo.NewHTTPError(http.StatusUnauthorized, "invalid authorization header")
+				}
+
+				// A token is only counted as used on routes its scopes allow
+				scope, allowed := routeScopes[c.Request().Method+" "+c.Path()]
+				accessToken, err := accessTokenStore.Authenticate(bearer, scope, c.RealIP())
+				switch {
+				case errors.Is(err, store.ErrAccessTokenScope) && !allowed:
+					return echo.NewHTTPError(http.StatusForbidden, "route is not available to access tokens")
+				case errors.Is(err, store.ErrAccessTokenScope):
+					return echo.NewHTTPError(http.StatusForbidden, "access token lacks scope "+scope)
+				case err != nil:
+					return echo.NewHTTPError(http.StatusUnauthorized, "invalid or expired access token")
+				}
+
+				c.Set(UserIDContextKey, accessToken.UserID)
+				c.Set(AccessTokenContextKey, accessToken)
+
+				return next(c)
+			}
+
 			cookie, err := c.Cookie(SessionCookieName)
 			if err != nil {
 				return echo.NewHTTPError(http.StatusUnauthorized, "no session")
 			}
 
-			session, exists := sessionStore.FindByID(cookie.Value)
-			if !exists {
+			session, rotatedToken, err := sessionStore.Refresh(cookie.Value, c.RealIP(), c.Request().UserAgent())
+			if err != nil {
+				ClearSessionCookie(c)
+				if errors.Is(err, store.ErrSessionReused) {
+					return echo.NewHTTPError(http.StatusUnauthorized, "session reuse detected, please log in again")
+				}
 				return echo.NewHTTPError(http.StatusUnauthorized, "invalid or expired session")
 			}
 
-			// Store user ID in context
+			if rotatedToken != "" {
+				SetSessionCookie(c, session, rotatedToken)
+			}
+
+			// Store user ID and session ID in context
 			c.Set(UserIDContextKey, session.UserID)
+			c.Set(SessionIDContextKey, session.ID)
+			c.Set(MFAPendingContextKey, session.MFAPending)
+			c.Set(RegistrationPendingContextKey, session.RegistrationID != nil)
+			c.Set(AuthenticatedAtContextKey, session.AuthenticatedAt)
+			if session.DecoyUsername != "" {
+				c.Set(DecoyUsernameContextKey, session.DecoyUsername)
+			}
 
 			return next(c)
 		}
 	}
 }
+
+// SetSessionCookie issues the session cookie carrying the raw session token
+func SetSessionCookie(c echo.Context, session *models.Session, token string) {
+	c.SetCookie(&http.Cookie{
+		Name:     SessionCookieName,
+		Value:    token,
+		Expires:  session.ExpiresAt,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+		Path:     "/",
+	})
+}
+
+// ClearSessionCookie tells the browser to drop the session cookie
+func ClearSessionCookie(c echo.Context) {
+	c.SetCookie(&http.Cookie{
+		Name:     SessionCookieName,
+		Value:    "",
+		Expires:  time.Unix(0, 0),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+		Path:     "/",
+		MaxAge:   -1,
+	})
+}
@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ReauthRequiredCode is the machine-readable error of requests whose session has
+// not proved a login factor recently enough; clients answer it with a step-up
+const ReauthRequiredCode = "reauth_required"
+
+// ReauthRequiredError is the response body of a reauth_required error
+type ReauthRequiredError struct {
+	Error         string `json:"error"`
+	Message       string `json:"message"`
+	MaxAgeSeconds int    `json:"max_age_seconds"`
+}
+
+// NewReauthRequiredError builds the error for a route that needs authentication within maxAge
+func NewReauthRequiredError(maxAge time.Duration) *echo.HTTPError {
+	return echo.NewHTTPError(http.StatusForbidden, ReauthRequiredError{
+		Error:         ReauthRequiredCode,
+		Message:       "recent authentication required, please verify it's you",
+		MaxAgeSeconds: int(maxAge / time.Second),
+	})
+}
+
+// RecentAuthMiddleware rejects requests whose session last authenticated more than
+// maxAge ago. Access tokens never satisfy it since they cannot step up.
+// It must run after SessionMiddleware.
+func RecentAuthMiddleware(maxAge time.Duration) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			authenticatedAt, ok := c.Get(AuthenticatedAtContextKey).(time.Time)
+			if !ok || time.Since(authenticatedAt) > maxAge {
+				return NewReauthRequiredError(maxAge)
+			}
+
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Scopes that can be granted to personal access tokens
+const (
+	ScopeMessagesRead  = "messages:read"
+	ScopeMessagesWrite = "messages:write"
+	ScopeDevicesRead   = "devices:read"
+)
+
+// AccessTokenScopes lists every scope a personal access token may be granted
+var AccessTokenScopes = []string{ScopeMessagesRead, ScopeMessagesWrite, ScopeDevicesRead}
+
+// AccessToken is a personal access token for scripts and CLI tools.
+// Only the SHA-256 digest of the token is stored; Prefix is the start of the
+// token kept so users can recognise it in listings.
+type AccessToken struct {
+	ID         uuid.UUID `json:"id"`
+	UserID     uuid.UUID `json:"user_id"`
+	Name       string    `json:"name"`
+	Prefix     string    `json:"prefix"`
+	TokenHash  string    `json:"-"`
+	Scopes     []string  `json:"scopes"`
+	CreatedAt  time.Time `json:"created_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	LastUsedAt time.Time `json:"last_used_at,omitzero"`
+	LastUsedIP string    `json:"last_used_ip,omitempty"`
+}
+
+// IsExpired checks if the token has passed its expiry
+func (t *AccessToken) IsExpired() bool {
+	return time.Now().After(t.ExpiresAt)
+}
+
+// HasScope reports whether the token was granted scope
+func (t *AccessToken) HasScope(scope string) bool {
+	return slices.Contains(t.Scopes, scope)
+}
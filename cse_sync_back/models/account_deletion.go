@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Account deletion statuses
+const (
+	AccountDeletionStatusScheduled = "scheduled"
+	AccountDeletionStatusCanceled  = "canceled"
+	AccountDeletionStatusCompleted = "completed"
+	AccountDeletionStatusFailed    = "failed"
+)
+
+// AccountDeletion is the receipt of an account deletion. A scheduled deletion can be
+// canceled until PurgeAt; once completed, Purged says what was removed, and if the
+// purge failed, Error says why.
+type AccountDeletion struct {
+	ID          uuid.UUID           `json:"id"`
+	UserID      uuid.UUID           `json:"user_id"`
+	Username    string              `json:"username"`
+	Status      string              `json:"status"`
+	RequestedAt time.Time           `json:"requested_at"`
+	PurgeAt     time.Time           `json:"purge_at"`
+	CanceledAt  *time.Time          `json:"canceled_at,omitempty"`
+	CompletedAt *time.Time          `json:"completed_at,omitempty"`
+	FailedAt    *time.Time          `json:"failed_at,omitempty"`
+	Error       string              `json:"error,omitempty"`
+	Purged      *AccountPurgeCounts `json:"purged,omitempty"`
+}
+
+// AccountPurgeCounts counts what an account purge removed
+type AccountPurgeCounts struct {
+	Devices      int `json:"devices"`
+	Sessions     int `json:"sessions"`
+	Messages     int `json:"messages"`
+	Passkeys     int `json:"passkeys"`
+	AccessTokens int `json:"access_tokens"`
+}
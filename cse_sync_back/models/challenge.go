@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Challenge purposes
+const (
+	ChallengePurposeRecoveryRotation = "recovery_rotation"
+	ChallengePurposeRecoveryUnlock   = "recovery_unlock"
+	ChallengePurposeStepUp           = "step_up"
+)
+
+// Challenge is a single-use server nonce a client must answer for a specific purpose
+type Challenge struct {
+	ID        uuid.UUID `json:"id"`
+	UserID    uuid.UUID `json:"user_id"`
+	Purpose   string    `json:"purpose"`
+	Value     []byte    `json:"value"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// IsExpired checks if the challenge has expired
+func (c *Challenge) IsExpired() bool {
+	return time.Now().After(c.ExpiresAt)
+}
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Credential represents a WebAuthn passkey registered by a user on one of their devices
+type Credential struct {
+	ID         string    `json:"id"`
+	UserID     uuid.UUID `json:"user_id"`
+	DeviceID   uuid.UUID `json:"device_id"`
+	PublicKey  []byte    `json:"public_key"`
+	SignCount  uint32    `json:"sign_count"`
+	AAGUID     []byte    `json:"aaguid"`
+	Transports []string  `json:"transports,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+}
+
+// Passkey ceremony kinds
+const (
+	PasskeyCeremonyRegistration = "registration"
+	PasskeyCeremonyLogin        = "login"
+	PasskeyCeremonyStepUp       = "step_up"
+)
+
+// PasskeyCeremony tracks the challenge of an in-progress WebAuthn ceremony
+type PasskeyCeremony struct {
+	Challenge string    `json:"challenge"`
+	Kind      string    `json:"kind"`
+	UserID    uuid.UUID `json:"user_id"`
+	DeviceID  uuid.UUID `json:"device_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// IsExpired checks if the ceremony has expired
+func (c *PasskeyCeremony) IsExpired() bool {
+	return time.Now().After(c.ExpiresAt)
+}
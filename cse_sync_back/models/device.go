@@ -1,23 +1,70 @@
 package models
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+// Device wrap formats understood by the server
+const (
+	DeviceWrapVersion1           = 1
+	DeviceWrapAlgorithmAES256GCM = "aes-256-gcm"
+	DeviceWrapAADUserID          = "user-id"
+)
+
+// DeviceWrap describes how a device's WrappedUMK was produced by its local KEK.
+// Version 1 is base64(IV || ciphertext) from AES-256-GCM keyed by the local KEK,
+// with the user ID as additional authenticated data. KeyEpoch increases every
+// time the device re-wraps the UMK under a new local KEK.
+type DeviceWrap struct {
+	Version   int    `json:"version"`
+	Algorithm string `json:"algorithm"`
+	AADScheme string `json:"aad_scheme"`
+	KeyEpoch  int    `json:"key_epoch"`
+}
+
+// LegacyDeviceWrap describes wraps stored before wrap metadata existed
+var LegacyDeviceWrap = DeviceWrap{
+	Version:   DeviceWrapVersion1,
+	Algorithm: DeviceWrapAlgorithmAES256GCM,
+	AADScheme: DeviceWrapAADUserID,
+	KeyEpoch:  1,
+}
+
+// Validate rejects unknown wrap versions and parameters the version does not define
+func (w DeviceWrap) Validate() error {
+	if w.Version != DeviceWrapVersion1 {
+		return fmt.Errorf("unsupported wrap version %d", w.Version)
+	}
+	if w.Algorithm != DeviceWrapAlgorithmAES256GCM {
+		return fmt.Errorf("unsupported wrap algorithm %q", w.Algorithm)
+	}
+	if w.AADScheme != DeviceWrapAADUserID {
+		return fmt.Errorf("unsupported aad scheme %q", w.AADScheme)
+	}
+	if w.KeyEpoch < 1 {
+		return fmt.Errorf("key epoch must be positive")
+	}
+	return nil
+}
+
 type Device struct {
-	ID         uuid.UUID `json:"id"`
-	UserID     uuid.UUID `json:"user_id"`
-	WrappedUMK string    `json:"wrapped_umk"`
-	CreatedAt  time.Time `json:"created_at"`
+	ID            uuid.UUID  `json:"id"`
+	UserID        uuid.UUID  `json:"user_id"`
+	WrappedUMK    string     `json:"wrapped_umk"`
+	Wrap          DeviceWrap `json:"wrap"`
+	CreatedAt     time.Time  `json:"created_at"`
+	WrapUpdatedAt time.Time  `json:"wrap_updated_at,omitzero"`
 }
 
-func NewDevice(userID uuid.UUID, wrappedUMK string) *Device {
+func NewDevice(userID uuid.UUID, wrappedUMK string, wrap DeviceWrap) *Device {
 	return &Device{
 		ID:         uuid.New(),
 		UserID:     userID,
 		WrappedUMK: wrappedUMK,
+		Wrap:       wrap,
 		CreatedAt:  time.Now(),
 	}
 }
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Enrollment statuses
+const (
+	EnrollmentStatusPending   = "pending"
+	EnrollmentStatusApproved  = "approved"
+	EnrollmentStatusRejected  = "rejected"
+	EnrollmentStatusCompleted = "completed"
+)
+
+// Enrollment represents a new device asking an existing device for the UMK
+type Enrollment struct {
+	ID                 uuid.UUID  `json:"id"`
+	UserID             uuid.UUID  `json:"user_id"`
+	SessionID          string     `json:"-"`
+	EphemeralPublicKey string     `json:"ephemeral_public_key"`
+	ConfirmationCode   string     `json:"-"`
+	DeviceLabel        string     `json:"device_label,omitempty"`
+	Status             string     `json:"status"`
+	SealedUMK          string     `json:"sealed_umk,omitempty"`
+	ApproverDeviceID   *uuid.UUID `json:"approver_device_id,omitempty"`
+	DeviceID           *uuid.UUID `json:"device_id,omitempty"`
+	FailedAttempts     int        `json:"-"`
+	CreatedAt          time.Time  `json:"created_at"`
+	ExpiresAt          time.Time  `json:"expires_at"`
+}
+
+// IsExpired checks if the enrollment has expired
+func (e *Enrollment) IsExpired() bool {
+	return time.Now().After(e.ExpiresAt)
+}
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Registration modes
+const (
+	RegistrationModeOpen   = "open"
+	RegistrationModeInvite = "invite"
+	RegistrationModeClosed = "closed"
+)
+
+// Invite admits up to MaxUses sign-ups while registration is invite-only.
+// Only the SHA-256 digest of the token is stored; Prefix is the start of the
+// token kept so admins can recognise it in listings. Reserved counts sign-ups
+// in progress; each becomes a use when it completes or is given back if not.
+type Invite struct {
+	ID        uuid.UUID  `json:"id"`
+	Prefix    string     `json:"prefix"`
+	TokenHash string     `json:"-"`
+	Note      string     `json:"note,omitempty"`
+	MaxUses   int        `json:"max_uses"`
+	Uses      int        `json:"uses"`
+	Reserved  int        `json:"reserved"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// IsExpired checks if the invite has passed its expiry
+func (i *Invite) IsExpired() bool {
+	return time.Now().After(i.ExpiresAt)
+}
+
+// IsUsable reports whether the invite can admit another sign-up
+func (i *Invite) IsUsable() bool {
+	return i.RevokedAt == nil && !i.IsExpired() && i.Uses+i.Reserved < i.MaxUses
+}
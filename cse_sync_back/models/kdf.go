@@ -0,0 +1,131 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+)
+
+// KDF algorithms accepted for passphrase-derived wrapping keys
+const (
+	KDFAlgorithmPBKDF2SHA256 = "pbkdf2-sha256"
+	KDFAlgorithmArgon2id     = "argon2id"
+)
+
+// KDFDescriptorVersion is the current descriptor schema version
+const KDFDescriptorVersion = 1
+
+// KDFDescriptor records how the key wrapping a recovery payload was derived from the passphrase.
+// Iterations is the PBKDF2 iteration count or the Argon2id time cost; MemoryKiB and
+// Parallelism only apply to Argon2id.
+type KDFDescriptor struct {
+	Algorithm   string `json:"algorithm"`
+	Iterations  int    `json:"iterations"`
+	MemoryKiB   int    `json:"memory_kib,omitempty"`
+	Parallelism int    `json:"parallelism,omitempty"`
+	Version     int    `json:"version"`
+}
+
+// LegacyKDF describes recovery payloads stored before descriptors existed,
+// which the frontend derived with PBKDF2-SHA256 and 310000 iterations
+var LegacyKDF = KDFDescriptor{
+	Algorithm:  KDFAlgorithmPBKDF2SHA256,
+	Iterations: 310000,
+	Version:    KDFDescriptorVersion,
+}
+
+// KDFStrength is a set of minimum parameters per algorithm
+type KDFStrength struct {
+	PBKDF2Iterations    int
+	Argon2Iterations    int
+	Argon2MemoryKiB     int
+	Argon2MinParallel   int
+	Argon2MaxParallel   int
+	PBKDF2MaxIterations int
+	Argon2MaxMemoryKiB  int
+}
+
+// KDFPolicy separates the floor the server refuses to go below from the
+// parameters it currently recommends. Payloads between the two are accepted
+// but flagged so clients re-wrap them on the next unlock.
+type KDFPolicy struct {
+	Minimum     KDFStrength
+	Recommended KDFDescriptor
+}
+
+// DefaultKDFPolicy follows the OWASP password storage recommendations
+var DefaultKDFPolicy = KDFPolicy{
+	Minimum: KDFStrength{
+		PBKDF2Iterations:    310000,
+		Argon2Iterations:    2,
+		Argon2MemoryKiB:     19456,
+		Argon2MinParallel:   1,
+		Argon2MaxParallel:   16,
+		PBKDF2MaxIterations: 10000000,
+		Argon2MaxMemoryKiB:  1048576,
+	},
+	Recommended: KDFDescriptor{
+		Algorithm:  KDFAlgorithmPBKDF2SHA256,
+		Iterations: 600000,
+		Version:    KDFDescriptorVersion,
+	},
+}
+
+// Validate rejects unknown descriptors and parameters below the minimum or absurdly high
+func (p KDFPolicy) Validate(d KDFDescriptor) error {
+	if d.Version != KDFDescriptorVersion {
+		return fmt.Errorf("unsupported kdf descriptor version %d", d.Version)
+	}
+
+	switch d.Algorithm {
+	case KDFAlgorithmPBKDF2SHA256:
+		if d.MemoryKiB != 0 || d.Parallelism != 0 {
+			return errors.New("pbkdf2 does not take memory or parallelism parameters")
+		}
+		if d.Iterations < p.Minimum.PBKDF2Iterations {
+			return fmt.Errorf("pbkdf2 iterations must be at least %d", p.Minimum.PBKDF2Iterations)
+		}
+		if d.Iterations > p.Minimum.PBKDF2MaxIterations {
+			return errors.New("pbkdf2 iterations too high")
+		}
+	case KDFAlgorithmArgon2id:
+		if d.Iterations < p.Minimum.Argon2Iterations {
+			return fmt.Errorf("argon2id iterations must be at least %d", p.Minimum.Argon2Iterations)
+		}
+		if d.MemoryKiB < p.Minimum.Argon2MemoryKiB {
+			return fmt.Errorf("argon2id memory must be at least %d KiB", p.Minimum.Argon2MemoryKiB)
+		}
+		if d.MemoryKiB > p.Minimum.Argon2MaxMemoryKiB {
+			return errors.New("argon2id memory too high")
+		}
+		if d.Parallelism < p.Minimum.Argon2MinParallel || d.Parallelism > p.Minimum.Argon2MaxParallel {
+			return fmt.Errorf("argon2id parallelism must be between %d and %d", p.Minimum.Argon2MinParallel, p.Minimum.Argon2MaxParallel)
+		}
+	default:
+		return fmt.Errorf("unsupported kdf algorithm %q", d.Algorithm)
+	}
+
+	return nil
+}
+
+// NeedsUpgrade reports whether d is weaker than the recommended parameters.
+// Argon2id at or above the recommended Argon2id costs is never downgraded to PBKDF2.
+func (p KDFPolicy) NeedsUpgrade(d KDFDescriptor) bool {
+	if p.Validate(d) != nil {
+		return true
+	}
+
+	switch d.Algorithm {
+	case KDFAlgorithmPBKDF2SHA256:
+		if p.Recommended.Algorithm != KDFAlgorithmPBKDF2SHA256 {
+			return true
+		}
+		return d.Iterations < p.Recommended.Iterations
+	case KDFAlgorithmArgon2id:
+		if p.Recommended.Algorithm != KDFAlgorithmArgon2id {
+			return false
+		}
+		return d.Iterations < p.Recommended.Iterations || d.MemoryKiB < p.Recommended.MemoryKiB
+	}
+
+	return true
+}
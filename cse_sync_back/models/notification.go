@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Notification kinds
+const (
+	NotificationSocialRecoveryRequested = "social_recovery.requested"
+	NotificationSocialRecoveryApproved  = "social_recovery.approved"
+	NotificationSocialRecoveryReleased  = "social_recovery.released"
+	NotificationSocialRecoveryRejected  = "social_recovery.rejected"
+)
+
+// Notification is a message shown to a user on their next visit
+type Notification struct {
+	ID        uuid.UUID         `json:"id"`
+	UserID    uuid.UUID         `json:"user_id"`
+	Kind      string            `json:"kind"`
+	Message   string            `json:"message"`
+	Data      map[string]string `json:"data,omitempty"`
+	Read      bool              `json:"read"`
+	CreatedAt time.Time         `json:"created_at"`
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// OIDCLogin holds the state of an authorization request until the provider redirects back.
+// State is echoed by the provider, Nonce is bound into the ID token and CodeVerifier
+// is the PKCE secret whose challenge was sent with the request.
+type OIDCLogin struct {
+	State        string    `json:"state"`
+	Nonce        string    `json:"nonce"`
+	CodeVerifier string    `json:"code_verifier"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+// IsExpired checks if the authorization request has expired
+func (l *OIDCLogin) IsExpired() bool {
+	return time.Now().After(l.ExpiresAt)
+}
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Pairing statuses
+const (
+	PairingStatusWaiting  = "waiting"
+	PairingStatusRedeemed = "redeemed"
+)
+
+// Pairing message senders
+const (
+	PairingSenderInitiator = "initiator"
+	PairingSenderPeer      = "peer"
+)
+
+// PairingSession links an authenticated device with a new device through a short code
+type PairingSession struct {
+	ID                 uuid.UUID         `json:"id"`
+	UserID             uuid.UUID         `json:"user_id"`
+	InitiatorSessionID string            `json:"-"`
+	Code               string            `json:"-"`
+	PeerTokenHash      string            `json:"-"`
+	Status             string            `json:"status"`
+	Messages           []*PairingMessage `json:"-"`
+	CreatedAt          time.Time         `json:"created_at"`
+	RedeemBy           time.Time         `json:"redeem_by"`
+	ExpiresAt          time.Time         `json:"expires_at"`
+}
+
+// PairingMessage is an opaque encrypted payload relayed between the paired devices
+type PairingMessage struct {
+	Seq       int       `json:"seq"`
+	Sender    string    `json:"sender"`
+	Payload   string    `json:"payload"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// IsExpired checks if the pairing session has expired or was never redeemed in time
+func (p *PairingSession) IsExpired() bool {
+	now := time.Now()
+	if p.Status == PairingStatusWaiting && now.After(p.RedeemBy) {
+		return true
+	}
+	return now.After(p.ExpiresAt)
+}
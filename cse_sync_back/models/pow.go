@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PoWChallenge is a single-use hashcash puzzle: the client must find a nonce such
+// that SHA-256(Seed + ":" + nonce) starts with Difficulty zero bits
+type PoWChallenge struct {
+	ID         uuid.UUID `json:"id"`
+	Seed       string    `json:"seed"`
+	Difficulty int       `json:"difficulty"`
+	ClientIP   string    `json:"-"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// IsExpired checks if the challenge has expired
+func (c *PoWChallenge) IsExpired() bool {
+	return time.Now().After(c.ExpiresAt)
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// RecoveryCodeSlot wraps the UMK under a key derived from one printed recovery code.
+// CodeHash is a server-side hash of the identifier the client derives from the code.
+type RecoveryCodeSlot struct {
+	CodeHash   string     `json:"code_hash"`
+	WrappedUMK string     `json:"wrapped_umk"`
+	Salt       string     `json:"salt"`
+	IV         string     `json:"iv"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UsedAt     *time.Time `json:"used_at,omitempty"`
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Registration statuses. A pending registration becomes completed when Register
+// claims its username, or failed when the username turned out to be unavailable;
+// either way it cannot be completed again.
+const (
+	RegistrationStatusPending   = "pending"
+	RegistrationStatusCompleted = "completed"
+	RegistrationStatusFailed    = "failed"
+)
+
+// Registration is a sign-up between RegisterInit and Register. UserID is the ID the
+// account gets once Username is claimed. While pending and unexpired it holds its
+// username against sign-ups started after it. InviteID is the invite it reserved a
+// use of when registration is invite-only.
+type Registration struct {
+	ID          uuid.UUID  `json:"id"`
+	UserID      uuid.UUID  `json:"user_id"`
+	Username    string     `json:"username"`
+	InviteID    *uuid.UUID `json:"invite_id,omitempty"`
+	Status      string     `json:"status"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
+// IsExpired checks if the registration was abandoned before completion
+func (r *Registration) IsExpired() bool {
+	return r.Status == RegistrationStatusPending && time.Now().After(r.ExpiresAt)
+}
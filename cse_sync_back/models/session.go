@@ -6,15 +6,43 @@ import (
 	"github.com/google/uuid"
 )
 
-// Session represents a user session
+// Session represents a user session.
+// ID identifies the login and stays the same when the session token is rotated.
+// The bearer token itself is never stored; TokenHash is the SHA-256 digest of the
+// current token and changes on every rotation. CSRFToken is the synchronizer token
+// unsafe requests must echo; it is handed to the client in response bodies only.
+// CreatedAt is when the user signed in, not when the current token was issued.
+// AuthenticatedAt is when the user last proved a login factor, at sign-in or
+// through a step-up; high-risk routes require it to be recent.
+// IPAddress and UserAgent are those of the most recent request.
+// MFAPending marks a short-lived pre-auth session of a user who still has to
+// enter their second factor; it may only call the routes needed to do so.
+// RegistrationID is set on short-lived registration sessions of a sign-up that has
+// not completed; UserID is the ID the account will get. Like pre-auth sessions they
+// may only call a few routes.
+// DecoyUsername is set on decoy sessions handed out for logins of nonexistent
+// accounts; their UserID belongs to no user.
 type Session struct {
-	ID        string    `json:"id"`
-	UserID    uuid.UUID `json:"user_id"`
-	CreatedAt time.Time `json:"created_at"`
-	ExpiresAt time.Time `json:"expires_at"`
+	ID              string     `json:"id"`
+	TokenHash       string     `json:"-"`
+	CSRFToken       string     `json:"-"`
+	UserID          uuid.UUID  `json:"user_id"`
+	DeviceID        *uuid.UUID `json:"device_id,omitempty"`
+	MFAPending      bool       `json:"mfa_pending,omitempty"`
+	RegistrationID  *uuid.UUID `json:"registration_id,omitempty"`
+	DecoyUsername   string     `json:"-"`
+	IPAddress       string     `json:"ip_address"`
+	UserAgent       string     `json:"user_agent"`
+	CreatedAt       time.Time  `json:"created_at"`
+	AuthenticatedAt time.Time  `json:"authenticated_at"`
+	RotatedAt       time.Time  `json:"rotated_at"`
+	LastSeenAt      time.Time  `json:"last_seen_at"`
+	IdleExpiresAt   time.Time  `json:"idle_expires_at"`
+	ExpiresAt       time.Time  `json:"expires_at"`
 }
 
-// IsExpired checks if the session has expired
+// IsExpired checks if the session has passed its idle or absolute timeout
 func (s *Session) IsExpired() bool {
-	return time.Now().After(s.ExpiresAt)
+	now := time.Now()
+	return now.After(s.ExpiresAt) || now.After(s.IdleExpiresAt)
 }
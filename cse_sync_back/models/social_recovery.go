@@ -0,0 +1,68 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Social recovery request statuses
+const (
+	SocialRecoveryStatusPending   = "pending"
+	SocialRecoveryStatusReleased  = "released"
+	SocialRecoveryStatusRejected  = "rejected"
+	SocialRecoveryStatusCancelled = "cancelled"
+)
+
+// SocialRecoveryConfig holds a user's Shamir shares, each encrypted to one guardian
+type SocialRecoveryConfig struct {
+	UserID    uuid.UUID        `json:"user_id"`
+	Threshold int              `json:"threshold"`
+	Shares    []*GuardianShare `json:"shares"`
+	CreatedAt time.Time        `json:"created_at"`
+}
+
+// GuardianShare is one share of the recovery key, encrypted so only the guardian can read it
+type GuardianShare struct {
+	GuardianID     uuid.UUID `json:"guardian_id"`
+	Index          int       `json:"index"`
+	EncryptedShare string    `json:"encrypted_share"`
+}
+
+// SocialRecoveryRequest tracks guardians releasing their shares to a requesting device
+type SocialRecoveryRequest struct {
+	ID                 uuid.UUID           `json:"id"`
+	UserID             uuid.UUID           `json:"user_id"`
+	SessionID          string              `json:"-"`
+	EphemeralPublicKey string              `json:"ephemeral_public_key"`
+	Threshold          int                 `json:"threshold"`
+	Shares             []*GuardianShare    `json:"-"`
+	Approvals          []*GuardianApproval `json:"approvals"`
+	Rejections         []uuid.UUID         `json:"rejections"`
+	Status             string              `json:"status"`
+	CreatedAt          time.Time           `json:"created_at"`
+	ExpiresAt          time.Time           `json:"expires_at"`
+}
+
+// GuardianApproval is a share a guardian re-encrypted to the requesting device's ephemeral key
+type GuardianApproval struct {
+	GuardianID    uuid.UUID `json:"guardian_id"`
+	ShareIndex    int       `json:"share_index"`
+	ReleasedShare string    `json:"released_share,omitempty"`
+	ApprovedAt    time.Time `json:"approved_at"`
+}
+
+// IsExpired checks if the request has expired
+func (r *SocialRecoveryRequest) IsExpired() bool {
+	return time.Now().After(r.ExpiresAt)
+}
+
+// ShareFor returns the share held by a guardian in this request
+func (r *SocialRecoveryRequest) ShareFor(guardianID uuid.UUID) (*GuardianShare, bool) {
+	for _, share := range r.Shares {
+		if share.GuardianID == guardianID {
+			return share, true
+		}
+	}
+	return nil, false
+}
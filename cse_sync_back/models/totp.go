@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TOTPBackupCode is a one-time code that stands in for a TOTP code when the
+// authenticator is unavailable. Only the SHA-256 digest of the code is stored.
+type TOTPBackupCode struct {
+	CodeHash string     `json:"-"`
+	UsedAt   *time.Time `json:"used_at,omitempty"`
+}
+
+// TOTPEnrollment is a user's TOTP second factor.
+// It is pending until the user proves their authenticator produces codes for Secret;
+// LastCounter is the time step of the last accepted code, so no code is accepted twice.
+type TOTPEnrollment struct {
+	UserID      uuid.UUID         `json:"user_id"`
+	Secret      string            `json:"-"`
+	CreatedAt   time.Time         `json:"created_at"`
+	ConfirmedAt *time.Time        `json:"confirmed_at,omitempty"`
+	LastCounter uint64            `json:"-"`
+	BackupCodes []*TOTPBackupCode `json:"-"`
+}
+
+// IsConfirmed reports whether the enrollment was confirmed and is enforced at login
+func (e *TOTPEnrollment) IsConfirmed() bool {
+	return e.ConfirmedAt != nil
+}
+
+// BackupCodesRemaining counts the unused backup codes
+func (e *TOTPEnrollment) BackupCodesRemaining() int {
+	remaining := 0
+	for _, code := range e.BackupCodes {
+		if code.UsedAt == nil {
+			remaining++
+		}
+	}
+	return remaining
+}
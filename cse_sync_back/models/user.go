@@ -1,12 +1,49 @@
 package models
 
-import "github.com/google/uuid"
+import (
+	"time"
 
-// User represents a user in the system
+	"github.com/google/uuid"
+)
+
+// User represents a user in the system.
+// When RecoveryAuthKey is set, the recovery payload is only released to clients
+// that answer a challenge with a key derived from the passphrase.
+// Users created through single sign-on carry the provider's issuer and subject.
+// Username is stored folded; UsernameChangedAt is set by the last rename.
 type User struct {
-	ID                 uuid.UUID `json:"id"`
-	Username           string    `json:"username"`
-	RecoveryWrappedUMK string    `json:"recovery_wrapped_umk,omitempty"`
-	RecoverySalt       string    `json:"recovery_salt,omitempty"`
-	RecoveryIV         string    `json:"recovery_iv,omitempty"`
+	ID                 uuid.UUID         `json:"id"`
+	Username           string            `json:"username"`
+	UsernameChangedAt  *time.Time        `json:"username_changed_at,omitempty"`
+	OIDCIssuer         string            `json:"oidc_issuer,omitempty"`
+	OIDCSubject        string            `json:"oidc_subject,omitempty"`
+	RecoveryWrappedUMK string            `json:"recovery_wrapped_umk,omitempty"`
+	RecoverySalt       string            `json:"recovery_salt,omitempty"`
+	RecoveryIV         string            `json:"recovery_iv,omitempty"`
+	RecoveryAuthKey    string            `json:"recovery_auth_key,omitempty"`
+	RecoveryKDF        *KDFDescriptor    `json:"recovery_kdf,omitempty"`
+	RecoveryVersion    int               `json:"recovery_version,omitempty"`
+	RecoveryUpdatedAt  time.Time         `json:"recovery_updated_at,omitzero"`
+	PreviousRecovery   *RecoverySnapshot `json:"previous_recovery,omitempty"`
+	UMKVerifier        string            `json:"umk_verifier,omitempty"`
+}
+
+// RecoverySnapshot keeps a replaced recovery payload so a rotation can be rolled back
+type RecoverySnapshot struct {
+	WrappedUMK string         `json:"wrapped_umk"`
+	Salt       string         `json:"salt"`
+	IV         string         `json:"iv"`
+	AuthKey    string         `json:"auth_key,omitempty"`
+	KDF        *KDFDescriptor `json:"kdf,omitempty"`
+	Version    int            `json:"version"`
+	ReplacedAt time.Time      `json:"replaced_at"`
+}
+
+// RecoveryKDFOrLegacy returns the KDF of the recovery payload, assuming the
+// legacy parameters for payloads stored before descriptors existed
+func (u *User) RecoveryKDFOrLegacy() KDFDescriptor {
+	if u.RecoveryKDF == nil {
+		return LegacyKDF
+	}
+	return *u.RecoveryKDF
 }
@@ -0,0 +1,337 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Signature algorithms accepted for ID tokens
+const (
+	AlgRS256 = "RS256"
+	AlgES256 = "ES256"
+)
+
+// IDToken holds the verified claims of an ID token that this server uses
+type IDToken struct {
+	Issuer            string
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	PreferredUsername string
+	Name              string
+	Expiry            time.Time
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	Typ string `json:"typ"`
+}
+
+type idTokenClaims struct {
+	Issuer            string   `json:"iss"`
+	Subject           string   `json:"sub"`
+	Audience          audience `json:"aud"`
+	AuthorizedParty   string   `json:"azp"`
+	Expiry            int64    `json:"exp"`
+	IssuedAt          int64    `json:"iat"`
+	Nonce             string   `json:"nonce"`
+	Email             string   `json:"email"`
+	EmailVerified     bool     `json:"email_verified"`
+	PreferredUsername string   `json:"preferred_username"`
+	Name              string   `json:"name"`
+}
+
+// audience accepts the aud claim as either a single string or an array
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return errors.New("aud must be a string or an array of strings")
+	}
+	*a = many
+	return nil
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// publicKey is a parsed signing key together with the algorithm it may be used with
+type publicKey struct {
+	alg string
+	key crypto.PublicKey
+}
+
+// VerifyIDToken checks the signature of a compact JWS ID token against the provider's
+// JWKS and validates issuer, audience, expiry and nonce
+func (p *Provider) VerifyIDToken(ctx context.Context, rawIDToken, nonce string) (*IDToken, error) {
+	parts := strings.Split(rawIDToken, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("oidc: malformed id token")
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("oidc: invalid id token header: %w", err)
+	}
+
+	if header.Alg != AlgRS256 && header.Alg != AlgES256 {
+		return nil, fmt.Errorf("oidc: unsupported id token algorithm %q", header.Alg)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("oidc: invalid id token signature encoding")
+	}
+
+	key, err := p.signingKey(ctx, header.Kid, header.Alg)
+	if err != nil {
+		return nil, err
+	}
+
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := verifySignature(key, digest[:], signature); err != nil {
+		return nil, err
+	}
+
+	var claims idTokenClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("oidc: invalid id token claims: %w", err)
+	}
+
+	if claims.Issuer != p.metadata.Issuer {
+		return nil, errors.New("oidc: id token issuer mismatch")
+	}
+
+	if claims.Subject == "" {
+		return nil, errors.New("oidc: id token has no subject")
+	}
+
+	if !slices.Contains(claims.Audience, p.config.ClientID) {
+		return nil, errors.New("oidc: id token audience mismatch")
+	}
+
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != p.config.ClientID {
+		return nil, errors.New("oidc: id token authorized party mismatch")
+	}
+
+	now := time.Now()
+	expiry := time.Unix(claims.Expiry, 0)
+	if claims.Expiry == 0 || now.After(expiry.Add(clockSkew)) {
+		return nil, errors.New("oidc: id token expired")
+	}
+
+	if claims.IssuedAt != 0 && time.Unix(claims.IssuedAt, 0).After(now.Add(clockSkew)) {
+		return nil, errors.New("oidc: id token issued in the future")
+	}
+
+	if subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1 {
+		return nil, errors.New("oidc: id token nonce mismatch")
+	}
+
+	return &IDToken{
+		Issuer:            claims.Issuer,
+		Subject:           claims.Subject,
+		Email:             claims.Email,
+		EmailVerified:     claims.EmailVerified,
+		PreferredUsername: claims.PreferredUsername,
+		Name:              claims.Name,
+		Expiry:            expiry,
+	}, nil
+}
+
+// signingKey returns the key for kid, refreshing the JWKS once when it is unknown
+// so that provider key rotation is picked up
+func (p *Provider) signingKey(ctx context.Context, kid, alg string) (publicKey, error) {
+	p.mu.RLock()
+	key, ok := p.lookupKey(kid, alg)
+	recentlyRefreshed := time.Since(p.refreshedAt) < jwksRefreshInterval
+	p.mu.RUnlock()
+	if ok {
+		return key, nil
+	}
+
+	if !recentlyRefreshed {
+		if err := p.refreshKeys(ctx); err != nil {
+			return publicKey{}, err
+		}
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	key, ok = p.lookupKey(kid, alg)
+	if !ok {
+		return publicKey{}, fmt.Errorf("oidc: no %s signing key with id %q", alg, kid)
+	}
+	return key, nil
+}
+
+// lookupKey finds a key by kid, or the only key for alg when the token has no kid.
+// Callers must hold p.mu.
+func (p *Provider) lookupKey(kid, alg string) (publicKey, bool) {
+	if kid != "" {
+		key, ok := p.keys[kid]
+		return key, ok && key.alg == alg
+	}
+
+	var found publicKey
+	matches := 0
+	for _, key := range p.keys {
+		if key.alg == alg {
+			found = key
+			matches++
+		}
+	}
+	return found, matches == 1
+}
+
+func (p *Provider) refreshKeys(ctx context.Context) error {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := p.getJSON(ctx, p.metadata.JWKSURI, &set); err != nil {
+		return fmt.Errorf("oidc: fetching jwks failed: %w", err)
+	}
+
+	keys := make(map[string]publicKey, len(set.Keys))
+	for i, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		key, err := parseJWK(jwk)
+		if err != nil {
+			continue
+		}
+
+		kid := jwk.Kid
+		if kid == "" {
+			kid = fmt.Sprintf("#%d", i)
+		}
+		keys[kid] = key
+	}
+
+	p.mu.Lock()
+	p.keys = keys
+	p.refreshedAt = time.Now()
+	p.mu.Unlock()
+
+	return nil
+}
+
+func parseJWK(jwk jsonWebKey) (publicKey, error) {
+	switch jwk.Kty {
+	case "RSA":
+		if jwk.Alg != "" && jwk.Alg != AlgRS256 {
+			return publicKey{}, fmt.Errorf("unsupported rsa algorithm %q", jwk.Alg)
+		}
+
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil || len(n) < 256 {
+			return publicKey{}, errors.New("invalid rsa modulus")
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return publicKey{}, errors.New("invalid rsa exponent")
+		}
+
+		exponent := 0
+		for _, b := range e {
+			exponent = exponent<<8 | int(b)
+		}
+
+		return publicKey{
+			alg: AlgRS256,
+			key: &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: exponent},
+		}, nil
+
+	case "EC":
+		if jwk.Crv != "P-256" || (jwk.Alg != "" && jwk.Alg != AlgES256) {
+			return publicKey{}, fmt.Errorf("unsupported ec key %q", jwk.Crv)
+		}
+
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil || len(x) != 32 {
+			return publicKey{}, errors.New("invalid ec x coordinate")
+		}
+		y, err := base64.RawURLEncoding.DecodeString(jwk.Y)
+		if err != nil || len(y) != 32 {
+			return publicKey{}, errors.New("invalid ec y coordinate")
+		}
+
+		key := &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			return publicKey{}, errors.New("ec point not on curve")
+		}
+
+		return publicKey{alg: AlgES256, key: key}, nil
+	}
+
+	return publicKey{}, fmt.Errorf("unsupported key type %q", jwk.Kty)
+}
+
+// verifySignature checks a JWS signature; ES256 signatures are the raw r||s concatenation
+func verifySignature(key publicKey, digest, signature []byte) error {
+	switch pub := key.key.(type) {
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest, signature); err != nil {
+			return errors.New("oidc: id token signature verification failed")
+		}
+		return nil
+
+	case *ecdsa.PublicKey:
+		if len(signature) != 64 {
+			return errors.New("oidc: invalid es256 signature length")
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(pub, digest, r, s) {
+			return errors.New("oidc: id token signature verification failed")
+		}
+		return nil
+	}
+
+	return errors.New("oidc: unsupported signing key")
+}
+
+func decodeSegment(segment string, v any) error {
+	raw, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, v)
+}
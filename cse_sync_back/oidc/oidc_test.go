@@ -0,0 +1,228 @@
+package oidc
+
+import (
+	"context"
+	"encoding/base64"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/oidc/oidctest"
+)
+
+const (
+	testClientID    = "cse-sync"
+	testRedirectURL = "http://localhost:5173/oidc/callback"
+)
+
+func discoverTestProvider(t *testing.T, idp *oidctest.Server) *Provider {
+	t.Helper()
+
+	provider, err := Discover(context.Background(), Config{
+		Issuer:      idp.Issuer(),
+		ClientID:    testClientID,
+		RedirectURL: testRedirectURL,
+		Scopes:      []string{"profile", "email"},
+		HTTPClient:  idp.Client(),
+	})
+	if err != nil {
+		t.Fatalf("Discover: %v", err)
+	}
+	return provider
+}
+
+func validClaims(idp *oidctest.Server, nonce string) map[string]any {
+	now := time.Now()
+	return map[string]any{
+		"iss":   idp.Issuer(),
+		"sub":   "subject-1",
+		"aud":   testClientID,
+		"iat":   now.Unix(),
+		"exp":   now.Add(5 * time.Minute).Unix(),
+		"nonce": nonce,
+	}
+}
+
+func TestDiscoverRejectsIssuerMismatch(t *testing.T) {
+	idp := oidctest.NewServer(t, testClientID)
+
+	_, err := Discover(context.Background(), Config{
+		Issuer:      idp.Issuer() + "/other",
+		ClientID:    testClientID,
+		RedirectURL: testRedirectURL,
+		HTTPClient:  idp.Client(),
+	})
+	if err == nil {
+		t.Fatal("Discover succeeded for another issuer, want error")
+	}
+}
+
+func TestAuthorizationCodeFlowWithPKCE(t *testing.T) {
+	idp := oidctest.NewServer(t, testClientID)
+	provider := discoverTestProvider(t, idp)
+	ctx := context.Background()
+
+	verifier := NewCodeVerifier()
+	authURL := provider.AuthCodeURL("state-1", "nonce-1", verifier)
+
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := parsed.Query()
+	if got := query.Get("code_challenge"); got != CodeChallengeS256(verifier) {
+		t.Errorf("code_challenge = %q, want S256 of the verifier", got)
+	}
+	if strings.Contains(authURL, verifier) {
+		t.Error("authorization URL contains the code verifier")
+	}
+	if got := query.Get("scope"); got != "openid profile email" {
+		t.Errorf("scope = %q, want %q", got, "openid profile email")
+	}
+
+	code, state := idp.Authorize(t, authURL, map[string]any{"sub": "subject-1"})
+	if state != "state-1" {
+		t.Errorf("state = %q, want %q", state, "state-1")
+	}
+
+	token, err := provider.Exchange(ctx, code, verifier)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+
+	idToken, err := provider.VerifyIDToken(ctx, token.IDToken, "nonce-1")
+	if err != nil {
+		t.Fatalf("VerifyIDToken: %v", err)
+	}
+	if idToken.Subject != "subject-1" || idToken.Issuer != idp.Issuer() {
+		t.Errorf("id token = %+v, want subject-1 from %s", idToken, idp.Issuer())
+	}
+
+	// A code is redeemed once, and only with the verifier it was requested with
+	if _, err := provider.Exchange(ctx, code, verifier); err == nil {
+		t.Error("second Exchange of the same code succeeded, want error")
+	}
+
+	code, _ = idp.Authorize(t, provider.AuthCodeURL("state-2", "nonce-2", verifier), nil)
+	if _, err := provider.Exchange(ctx, code, NewCodeVerifier()); err == nil {
+		t.Error("Exchange with another verifier succeeded, want error")
+	}
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	idp := oidctest.NewServer(t, testClientID)
+	provider := discoverTestProvider(t, idp)
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		claims  map[string]any
+		tamper  func(token string) string
+		wantErr bool
+	}{
+		{name: "valid"},
+		{name: "audience array with azp", claims: map[string]any{"aud": []string{testClientID, "other"}, "azp": testClientID}},
+		{name: "expired within clock skew", claims: map[string]any{"exp": time.Now().Add(-clockSkew / 2).Unix()}},
+		{name: "wrong nonce", claims: map[string]any{"nonce": "another nonce"}, wantErr: true},
+		{name: "missing nonce", claims: map[string]any{"nonce": nil}, wantErr: true},
+		{name: "wrong audience", claims: map[string]any{"aud": "another-client"}, wantErr: true},
+		{name: "audience array without azp", claims: map[string]any{"aud": []string{testClientID, "other"}}, wantErr: true},
+		{name: "wrong issuer", claims: map[string]any{"iss": "https://evil.example"}, wantErr: true},
+		{name: "expired", claims: map[string]any{"exp": time.Now().Add(-2 * clockSkew).Unix()}, wantErr: true},
+		{name: "missing expiry", claims: map[string]any{"exp": nil}, wantErr: true},
+		{name: "issued in the future", claims: map[string]any{"iat": time.Now().Add(2 * clockSkew).Unix()}, wantErr: true},
+		{name: "missing subject", claims: map[string]any{"sub": nil}, wantErr: true},
+		{
+			name: "bad signature",
+			tamper: func(token string) string {
+				i := strings.LastIndexByte(token, '.')
+				signature, _ := base64.RawURLEncoding.DecodeString(token[i+1:])
+				signature[0] ^= 0x01
+				return token[:i+1] + base64.RawURLEncoding.EncodeToString(signature)
+			},
+			wantErr: true,
+		},
+		{
+			name: "claims swapped under a valid signature",
+			tamper: func(token string) string {
+				other := strings.Split(idp.IDToken(t, map[string]any{"sub": "subject-2"}), ".")
+				parts := strings.Split(token, ".")
+				return parts[0] + "." + other[1] + "." + parts[2]
+			},
+			wantErr: true,
+		},
+		{
+			name: "unsigned",
+			tamper: func(token string) string {
+				parts := strings.Split(token, ".")
+				return "eyJhbGciOiJub25lIn0." + parts[1] + "."
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := validClaims(idp, "nonce-1")
+			for name, value := range tt.claims {
+				if value == nil {
+					delete(claims, name)
+				} else {
+					claims[name] = value
+				}
+			}
+
+			token := idp.IDToken(t, claims)
+			if tt.tamper != nil {
+				token = tt.tamper(token)
+			}
+
+			_, err := provider.VerifyIDToken(ctx, token, "nonce-1")
+			if tt.wantErr && err == nil {
+				t.Fatal("VerifyIDToken succeeded, want error")
+			}
+			if !tt.wantErr && err != nil {
+				t.Fatalf("VerifyIDToken: %v", err)
+			}
+		})
+	}
+}
+
+func TestVerifyIDTokenKeyRotation(t *testing.T) {
+	idp := oidctest.NewServer(t, testClientID)
+	provider := discoverTestProvider(t, idp)
+	ctx := context.Background()
+
+	before := idp.IDToken(t, validClaims(idp, "nonce-1"))
+	if _, err := provider.VerifyIDToken(ctx, before, "nonce-1"); err != nil {
+		t.Fatalf("VerifyIDToken with the first key: %v", err)
+	}
+
+	idp.RotateKey(t)
+	after := idp.IDToken(t, validClaims(idp, "nonce-1"))
+
+	// Unknown key IDs only trigger a refetch once per jwksRefreshInterval
+	if _, err := provider.VerifyIDToken(ctx, after, "nonce-1"); err == nil {
+		t.Fatal("VerifyIDToken picked up the new key within the refresh interval")
+	}
+	if fetches := idp.JWKSFetches(); fetches != 1 {
+		t.Fatalf("JWKS fetched %d times, want 1", fetches)
+	}
+
+	provider.mu.Lock()
+	provider.refreshedAt = time.Now().Add(-jwksRefreshInterval)
+	provider.mu.Unlock()
+
+	if _, err := provider.VerifyIDToken(ctx, after, "nonce-1"); err != nil {
+		t.Fatalf("VerifyIDToken with the rotated key: %v", err)
+	}
+	if fetches := idp.JWKSFetches(); fetches != 2 {
+		t.Errorf("JWKS fetched %d times, want 2", fetches)
+	}
+
+	// The retired key is gone from the JWKS and no longer accepted
+	if _, err := provider.VerifyIDToken(ctx, before, "nonce-1"); err == nil {
+		t.Error("VerifyIDToken accepted a token signed by the retired key")
+	}
+}
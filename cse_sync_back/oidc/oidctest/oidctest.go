@@ -0,0 +1,269 @@
+// Package oidctest provides an OpenID provider for tests of single sign-on
+package oidctest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Server is an OpenID provider serving discovery, JWKS and token endpoints. ID tokens
+// are signed with ES256 by the newest key; Authorize stands in for the user signing in
+// at the authorization endpoint.
+type Server struct {
+	*httptest.Server
+	ClientID string
+
+	mu          sync.Mutex
+	keys        []signingKey
+	rotations   int
+	grants      map[string]grant
+	jwksFetches int
+}
+
+type signingKey struct {
+	kid string
+	key *ecdsa.PrivateKey
+}
+
+// grant is an authorization code waiting to be redeemed
+type grant struct {
+	redirectURI   string
+	codeChallenge string
+	claims        map[string]any
+}
+
+// NewServer starts a provider for clientID that is closed when the test ends
+func NewServer(t testing.TB, clientID string) *Server {
+	t.Helper()
+
+	s := &Server{
+		ClientID: clientID,
+		grants:   make(map[string]grant),
+	}
+	s.RotateKey(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", s.discovery)
+	mux.HandleFunc("GET /jwks", s.jwks)
+	mux.HandleFunc("POST /token", s.token)
+
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+// Issuer returns the provider's issuer identifier
+func (s *Server) Issuer() string {
+	return s.URL
+}
+
+// RotateKey replaces the signing keys with a new one under a new key ID
+func (s *Server) RotateKey(t testing.TB) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rotations++
+	s.keys = []signingKey{{kid: fmt.Sprintf("key-%d", s.rotations), key: key}}
+}
+
+// JWKSFetches returns how often the JWKS was requested
+func (s *Server) JWKSFetches() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.jwksFetches
+}
+
+// Authorize plays the user signing in at authURL, an authorization request built by
+// the client. It returns the code and state the provider redirects back with. The ID
+// token issued for the code carries the standard claims for this provider and the
+// request's nonce, overridden by claims; a nil value removes a claim.
+func (s *Server) Authorize(t testing.TB, authURL string, claims map[string]any) (code, state string) {
+	t.Helper()
+
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := parsed.Query()
+
+	if query.Get("response_type") != "code" || query.Get("client_id") != s.ClientID {
+		t.Fatalf("unexpected authorization request %s", authURL)
+	}
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		t.Fatalf("authorization request %s does not use PKCE", authURL)
+	}
+
+	now := time.Now()
+	idClaims := map[string]any{
+		"iss":   s.Issuer(),
+		"aud":   s.ClientID,
+		"iat":   now.Unix(),
+		"exp":   now.Add(5 * time.Minute).Unix(),
+		"nonce": query.Get("nonce"),
+	}
+	maps.Copy(idClaims, claims)
+	maps.DeleteFunc(idClaims, func(_ string, v any) bool { return v == nil })
+
+	code = rand.Text()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.grants[code] = grant{
+		redirectURI:   query.Get("redirect_uri"),
+		codeChallenge: query.Get("code_challenge"),
+		claims:        idClaims,
+	}
+
+	return code, query.Get("state")
+}
+
+// IDToken signs claims as an ID token with the current key
+func (s *Server) IDToken(t testing.TB, claims map[string]any) string {
+	t.Helper()
+
+	s.mu.Lock()
+	key := s.keys[len(s.keys)-1]
+	s.mu.Unlock()
+
+	token, err := sign(key, claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func sign(key signingKey, claims map[string]any) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "ES256", "kid": key.kid, "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+
+	r, sig, err := ecdsa.Sign(rand.Reader, key.key, digest[:])
+	if err != nil {
+		return "", err
+	}
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	sig.FillBytes(signature[32:])
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+func (s *Server) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"issuer":                           s.Issuer(),
+		"authorization_endpoint":           s.URL + "/authorize",
+		"token_endpoint":                   s.URL + "/token",
+		"jwks_uri":                         s.URL + "/jwks",
+		"code_challenge_methods_supported": []string{"S256"},
+	})
+}
+
+func (s *Server) jwks(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.jwksFetches++
+
+	keys := make([]map[string]string, 0, len(s.keys))
+	for _, key := range s.keys {
+		x := make([]byte, 32)
+		y := make([]byte, 32)
+		key.key.X.FillBytes(x)
+		key.key.Y.FillBytes(y)
+
+		keys = append(keys, map[string]string{
+			"kty": "EC",
+			"kid": key.kid,
+			"use": "sig",
+			"alg": "ES256",
+			"crv": "P-256",
+			"x":   base64.RawURLEncoding.EncodeToString(x),
+			"y":   base64.RawURLEncoding.EncodeToString(y),
+		})
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"keys": keys})
+}
+
+// token redeems an authorization code once, checking the PKCE verifier against the
+// challenge of the authorization request
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	clientID := r.PostForm.Get("client_id")
+	if user, _, ok := r.BasicAuth(); ok {
+		clientID, _ = url.QueryUnescape(user)
+	}
+
+	s.mu.Lock()
+	code := r.PostForm.Get("code")
+	g, exists := s.grants[code]
+	delete(s.grants, code)
+	key := s.keys[len(s.keys)-1]
+	s.mu.Unlock()
+
+	verifierDigest := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	switch {
+	case r.PostForm.Get("grant_type") != "authorization_code" || clientID != s.ClientID:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_client"})
+		return
+	case !exists || r.PostForm.Get("redirect_uri") != g.redirectURI:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	case base64.RawURLEncoding.EncodeToString(verifierDigest[:]) != g.codeChallenge:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "code verifier mismatch"})
+		return
+	}
+
+	idToken, err := sign(key, g.claims)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": rand.Text(),
+		"token_type":   "Bearer",
+		"id_token":     idToken,
+		"expires_in":   300,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,156 @@
+package store
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/models"
+	"github.com/google/uuid"
+)
+
+const (
+	// AccessTokenPrefix marks personal access tokens so they are easy to spot in logs and secret scanners
+	AccessTokenPrefix = "csepat_"
+
+	accessTokenBytes       = 32
+	accessTokenPrefixChars = len(AccessTokenPrefix) + 6
+)
+
+var (
+	ErrAccessTokenNotFound = errors.New("access token not found or expired")
+	ErrAccessTokenScope    = errors.New("access token lacks the required scope")
+)
+
+// AccessTokenStore manages personal access tokens in memory, keyed by token hash
+type AccessTokenStore struct {
+	mu     sync.RWMutex
+	tokens map[string]*models.AccessToken
+}
+
+// NewAccessTokenStore creates a new AccessTokenStore
+func NewAccessTokenStore() *AccessTokenStore {
+	return &AccessTokenStore{
+		tokens: make(map[string]*models.AccessToken),
+	}
+}
+
+func hashAccessToken(token string) string {
+	digest := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(digest[:])
+}
+
+// Create issues a token for a user and returns it with the raw token, which is not stored
+func (s *AccessTokenStore) Create(userID uuid.UUID, name string, scopes []string, lifetime time.Duration) (*models.AccessToken, string) {
+	b := make([]byte, accessTokenBytes)
+	rand.Read(b)
+	token := AccessTokenPrefix + base64.RawURLEncoding.EncodeToString(b)
+
+	now := time.Now()
+	accessToken := &models.AccessToken{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Name:      name,
+		Prefix:    token[:accessTokenPrefixChars],
+		TokenHash: hashAccessToken(token),
+		Scopes:    scopes,
+		CreatedAt: now,
+		ExpiresAt: now.Add(lifetime),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tokens[accessToken.TokenHash] = accessToken
+
+	copied := *accessToken
+	return &copied, token
+}
+
+// Authenticate finds the unexpired token matching a raw bearer token and, if it
+// carries scope, records its use. Tokens are looked up by their SHA-256 digest, so
+// the lookup's timing reveals nothing about the raw token.
+func (s *AccessTokenStore) Authenticate(token, scope, ipAddress string) (*models.AccessToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tokenHash := hashAccessToken(token)
+	accessToken, exists := s.tokens[tokenHash]
+	if !exists {
+		return nil, ErrAccessTokenNotFound
+	}
+
+	if accessToken.IsExpired() {
+		delete(s.tokens, tokenHash)
+		return nil, ErrAccessTokenNotFound
+	}
+
+	if !accessToken.HasScope(scope) {
+		return nil, ErrAccessTokenScope
+	}
+
+	accessToken.LastUsedAt = time.Now()
+	accessToken.LastUsedIP = ipAddress
+
+	copied := *accessToken
+	return &copied, nil
+}
+
+// FindByUserID returns a user's unexpired tokens
+func (s *AccessTokenStore) FindByUserID(userID uuid.UUID) []*models.AccessToken {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tokens := make([]*models.AccessToken, 0)
+	for _, accessToken := range s.tokens {
+		if accessToken.UserID == userID && !accessToken.IsExpired() {
+			copied := *accessToken
+			tokens = append(tokens, &copied)
+		}
+	}
+
+	return tokens
+}
+
+// Revoke deletes one of a user's tokens
+func (s *AccessTokenStore) Revoke(userID, tokenID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for tokenHash, accessToken := range s.tokens {
+		if accessToken.ID == tokenID && accessToken.UserID == userID {
+			delete(s.tokens, tokenHash)
+			return nil
+		}
+	}
+
+	return ErrAccessTokenNotFound
+}
+
+// purgeUserLocked removes every token of a user. Callers must hold s.mu.
+func (s *AccessTokenStore) purgeUserLocked(userID uuid.UUID) int {
+	removed := 0
+	for tokenHash, accessToken := range s.tokens {
+		if accessToken.UserID == userID {
+			delete(s.tokens, tokenHash)
+			removed++
+		}
+	}
+	return removed
+}
+
+// CleanupExpired removes expired tokens
+func (s *AccessTokenStore) CleanupExpired() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for tokenHash, accessToken := range s.tokens {
+		if accessToken.IsExpired() {
+			delete(s.tokens, tokenHash)
+		}
+	}
+}
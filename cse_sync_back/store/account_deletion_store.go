@@ -0,0 +1,173 @@
+package store
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/models"
+	"github.com/google/uuid"
+)
+
+const (
+	// AccountDeletionMaxGrace bounds how long a deletion can be scheduled ahead
+	AccountDeletionMaxGrace = 30 * 24 * time.Hour
+	// AccountDeletionReceiptRetention is how long receipts of finished deletions are kept
+	AccountDeletionReceiptRetention = 30 * 24 * time.Hour
+)
+
+var (
+	ErrAccountDeletionScheduled    = errors.New("account deletion already scheduled")
+	ErrAccountDeletionNotFound     = errors.New("no account deletion scheduled")
+	ErrAccountDeletionInvalidGrace = errors.New("invalid grace period")
+)
+
+// AccountDeletionStore schedules account deletions and carries them out through an
+// AccountPurger, immediately or once their grace period ends. The receipt of each
+// user's last finished deletion is kept in finished for
+// AccountDeletionReceiptRetention, and every purge is recorded in audit.
+type AccountDeletionStore struct {
+	mu        sync.Mutex
+	scheduled map[uuid.UUID]*models.AccountDeletion
+	finished  map[uuid.UUID]*models.AccountDeletion
+	purger    *AccountPurger
+	audit     *AuditStore
+}
+
+// NewAccountDeletionStore creates a new AccountDeletionStore
+func NewAccountDeletionStore(purger *AccountPurger, audit *AuditStore) *AccountDeletionStore {
+	return &AccountDeletionStore{
+		scheduled: make(map[uuid.UUID]*models.AccountDeletion),
+		finished:  make(map[uuid.UUID]*models.AccountDeletion),
+		purger:    purger,
+		audit:     audit,
+	}
+}
+
+// Request deletes user's account. With no grace period the account is purged at
+// once and the completed receipt returned; otherwise the deletion is scheduled and
+// can be canceled until the grace period ends.
+func (s *AccountDeletionStore) Request(user *models.User, grace time.Duration) (*models.AccountDeletion, error) {
+	if grace < 0 || grace > AccountDeletionMaxGrace {
+		return nil, ErrAccountDeletionInvalidGrace
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.scheduled[user.ID]; exists {
+		return nil, ErrAccountDeletionScheduled
+	}
+
+	now := time.Now()
+	deletion := &models.AccountDeletion{
+		ID:          uuid.New(),
+		UserID:      user.ID,
+		Username:    user.Username,
+		Status:      models.AccountDeletionStatusScheduled,
+		RequestedAt: now,
+		PurgeAt:     now.Add(grace),
+	}
+
+	if grace == 0 {
+		if err := s.purgeLocked(deletion); err != nil {
+			return nil, err
+		}
+	} else {
+		s.scheduled[user.ID] = deletion
+	}
+
+	copied := *deletion
+	return &copied, nil
+}
+
+// Find returns a user's scheduled deletion or, if there is none, the receipt of their
+// last finished one
+func (s *AccountDeletionStore) Find(userID uuid.UUID) (*models.AccountDeletion, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deletion, exists := s.scheduled[userID]
+	if !exists {
+		deletion, exists = s.finished[userID]
+	}
+	if !exists {
+		return nil, false
+	}
+
+	copied := *deletion
+	return &copied, true
+}
+
+// Cancel undoes a user's scheduled deletion
+func (s *AccountDeletionStore) Cancel(userID uuid.UUID) (*models.AccountDeletion, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deletion, exists := s.scheduled[userID]
+	if !exists {
+		return nil, ErrAccountDeletionNotFound
+	}
+
+	delete(s.scheduled, userID)
+
+	now := time.Now()
+	deletion.Status = models.AccountDeletionStatusCanceled
+	deletion.CanceledAt = &now
+
+	copied := *deletion
+	return &copied, nil
+}
+
+// PurgeDue purges the accounts whose grace period has ended and returns the receipts
+// of those deletions, completed or failed. It also drops receipts older than
+// AccountDeletionReceiptRetention.
+func (s *AccountDeletionStore) PurgeDue() []*models.AccountDeletion {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	var purged []*models.AccountDeletion
+	for userID, deletion := range s.scheduled {
+		if now.Before(deletion.PurgeAt) {
+			continue
+		}
+
+		s.purgeLocked(deletion)
+		delete(s.scheduled, userID)
+
+		copied := *deletion
+		purged = append(purged, &copied)
+	}
+
+	for userID, deletion := range s.finished {
+		if now.Sub(deletion.PurgeAt) > AccountDeletionReceiptRetention {
+			delete(s.finished, userID)
+		}
+	}
+
+	return purged
+}
+
+// purgeLocked purges the account of deletion and completes it, or marks it failed
+// with the purge error. Either way the receipt is kept and the outcome audited.
+// Callers must hold s.mu.
+func (s *AccountDeletionStore) purgeLocked(deletion *models.AccountDeletion) error {
+	counts, err := s.purger.Purge(deletion.UserID)
+
+	now := time.Now()
+	if err != nil {
+		deletion.Status = models.AccountDeletionStatusFailed
+		deletion.FailedAt = &now
+		deletion.Error = err.Error()
+		s.audit.Record(deletion.UserID, models.AuditActionAccountDelete, models.AuditOutcomeFailure, err.Error(), "", "")
+	} else {
+		deletion.Status = models.AccountDeletionStatusCompleted
+		deletion.CompletedAt = &now
+		deletion.Purged = counts
+		s.audit.Record(deletion.UserID, models.AuditActionAccountDelete, models.AuditOutcomeSuccess, "", "", "")
+	}
+
+	s.finished[deletion.UserID] = deletion
+	return err
+}
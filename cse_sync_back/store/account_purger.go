@@ -0,0 +1,95 @@
+package store
+
+import (
+	"slices"
+	"sync"
+
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/models"
+	"github.com/google/uuid"
+)
+
+// AccountPurger removes a user and everything stored for them in one step. It
+// holds the locks of all stores involved while purging, so no request observes a
+// partly deleted account. Short-lived records such as challenges and pairings are
+// left to expire.
+type AccountPurger struct {
+	users          *UserStore
+	sessions       *SessionStore
+	devices        *DeviceStore
+	messages       *MessageStore
+	credentials    *CredentialStore
+	accessTokens   *AccessTokenStore
+	recoveryCodes  *RecoveryCodeStore
+	totp           *TOTPStore
+	enrollments    *EnrollmentStore
+	socialRecovery *SocialRecoveryStore
+	notifications  *NotificationStore
+	audit          *AuditStore
+}
+
+// NewAccountPurger creates an AccountPurger over the stores holding user data
+func NewAccountPurger(users *UserStore, sessions *SessionStore, devices *DeviceStore, messages *MessageStore, credentials *CredentialStore, accessTokens *AccessTokenStore, recoveryCodes *RecoveryCodeStore, totp *TOTPStore, enrollments *EnrollmentStore, socialRecovery *SocialRecoveryStore, notifications *NotificationStore, audit *AuditStore) *AccountPurger {
+	return &AccountPurger{
+		users:          users,
+		sessions:       sessions,
+		devices:        devices,
+		messages:       messages,
+		credentials:    credentials,
+		accessTokens:   accessTokens,
+		recoveryCodes:  recoveryCodes,
+		totp:           totp,
+		enrollments:    enrollments,
+		socialRecovery: socialRecovery,
+		notifications:  notifications,
+		audit:          audit,
+	}
+}
+
+// Purge deletes a user, frees their username and removes their devices, sessions,
+// messages, passkeys, tokens, second factors, enrollments, recovery setup,
+// notifications and audit entries
+func (p *AccountPurger) Purge(userID uuid.UUID) (*models.AccountPurgeCounts, error) {
+	// Always locked in this order; no other code holds two of these locks at once
+	locks := []sync.Locker{
+		&p.users.mu,
+		&p.sessions.mu,
+		&p.devices.mu,
+		&p.messages.mu,
+		&p.credentials.mu,
+		&p.accessTokens.mu,
+		&p.recoveryCodes.mu,
+		&p.totp.mu,
+		&p.enrollments.mu,
+		&p.socialRecovery.mu,
+		&p.notifications.mu,
+		&p.audit.mu,
+	}
+	for _, lock := range locks {
+		lock.Lock()
+	}
+	defer func() {
+		for _, lock := range slices.Backward(locks) {
+			lock.Unlock()
+		}
+	}()
+
+	if !p.users.deleteLocked(userID) {
+		return nil, ErrUserNotFound
+	}
+
+	counts := &models.AccountPurgeCounts{
+		Sessions:     p.sessions.purgeUserLocked(userID),
+		Devices:      p.devices.purgeUserLocked(userID),
+		Messages:     p.messages.purgeUserLocked(userID),
+		Passkeys:     p.credentials.purgeUserLocked(userID),
+		AccessTokens: p.accessTokens.purgeUserLocked(userID),
+	}
+	p.recoveryCodes.purgeUserLocked(userID)
+	p.totp.purgeUserLocked(userID)
+	p.enrollments.purgeUserLocked(userID)
+	p.socialRecovery.purgeUserLocked(userID)
+	p.notifications.purgeUserLocked(userID)
+	p.audit.purgeUserLocked(userID)
+
+	return counts, nil
+}
@@ -0,0 +1,78 @@
+package store
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/models"
+	"github.com/google/uuid"
+)
+
+const AuditRetention = 90 * 24 * time.Hour
+
+// AuditStore keeps an append-only audit log in memory
+type AuditStore struct {
+	mu      sync.RWMutex
+	entries []*models.AuditEntry
+}
+
+// NewAuditStore creates a new AuditStore
+func NewAuditStore() *AuditStore {
+	return &AuditStore{
+		entries: make([]*models.AuditEntry, 0),
+	}
+}
+
+// Record appends an audit entry
+func (s *AuditStore) Record(userID uuid.UUID, action, outcome, detail, ip, userAgent string) *models.AuditEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry := &models.AuditEntry{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Action:    action,
+		Outcome:   outcome,
+		Detail:    detail,
+		IP:        ip,
+		UserAgent: userAgent,
+		CreatedAt: time.Now(),
+	}
+
+	s.entries = append(s.entries, entry)
+	return entry
+}
+
+// FindByUserID returns a user's entries for an action, newest first.
+// An empty action matches every action.
+func (s *AuditStore) FindByUserID(userID uuid.UUID, action string) []*models.AuditEntry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entries := make([]*models.AuditEntry, 0)
+	for _, entry := range slices.Backward(s.entries) {
+		if entry.UserID == userID && (action == "" || entry.Action == action) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// purgeUserLocked removes a user's audit entries. Callers must hold s.mu.
+func (s *AuditStore) purgeUserLocked(userID uuid.UUID) {
+	s.entries = slices.DeleteFunc(s.entries, func(entry *models.AuditEntry) bool {
+		return entry.UserID == userID
+	})
+}
+
+// CleanupExpired removes entries older than the retention period
+func (s *AuditStore) CleanupExpired() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cutoff := time.Now().Add(-AuditRetention)
+	s.entries = slices.DeleteFunc(s.entries, func(entry *models.AuditEntry) bool {
+		return entry.CreatedAt.Before(cutoff)
+	})
+}
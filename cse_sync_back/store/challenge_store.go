@@ -0,0 +1,79 @@
+package store
+
+import (
+	"crypto/rand"
+	"sync"
+	"time"
+
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/models"
+	"github.com/google/uuid"
+)
+
+const (
+	ChallengeDuration = 5 * time.Minute
+	challengeLength   = 32
+)
+
+// ChallengeStore manages single-use server challenges in memory
+type ChallengeStore struct {
+	mu         sync.Mutex
+	challenges map[uuid.UUID]*models.Challenge
+}
+
+// NewChallengeStore creates a new ChallengeStore
+func NewChallengeStore() *ChallengeStore {
+	return &ChallengeStore{
+		challenges: make(map[uuid.UUID]*models.Challenge),
+	}
+}
+
+// Issue creates a random challenge bound to a user and purpose
+func (s *ChallengeStore) Issue(userID uuid.UUID, purpose string) *models.Challenge {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	value := make([]byte, challengeLength)
+	rand.Read(value)
+
+	challenge := &models.Challenge{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Purpose:   purpose,
+		Value:     value,
+		ExpiresAt: time.Now().Add(ChallengeDuration),
+	}
+
+	s.challenges[challenge.ID] = challenge
+	return challenge
+}
+
+// Consume removes and returns a challenge if it matches the user and purpose and has not expired
+func (s *ChallengeStore) Consume(challengeID uuid.UUID, userID uuid.UUID, purpose string) (*models.Challenge, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	challenge, exists := s.challenges[challengeID]
+	if !exists {
+		return nil, false
+	}
+
+	delete(s.challenges, challengeID)
+
+	if challenge.UserID != userID || challenge.Purpose != purpose || challenge.IsExpired() {
+		return nil, false
+	}
+
+	return challenge, true
+}
+
+// CleanupExpired removes expired challenges
+func (s *ChallengeStore) CleanupExpired() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, challenge := range s.challenges {
+		if challenge.IsExpired() {
+			delete(s.challenges, id)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package store
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/models"
+	"github.com/google/uuid"
+)
+
+const PasskeyCeremonyDuration = 5 * time.Minute
+
+var (
+	ErrCredentialExists    = errors.New("credential already registered")
+	ErrCredentialNotFound  = errors.New("credential not found")
+	ErrSignCountRegression = errors.New("sign count did not increase")
+)
+
+// CredentialStore manages WebAuthn credentials and pending ceremonies in memory
+type CredentialStore struct {
+	mu          sync.RWMutex
+	credentials map[string]*models.Credential
+	ceremonies  map[string]*models.PasskeyCeremony
+}
+
+// NewCredentialStore creates a new CredentialStore
+func NewCredentialStore() *CredentialStore {
+	return &CredentialStore{
+		credentials: make(map[string]*models.Credential),
+		ceremonies:  make(map[string]*models.PasskeyCeremony),
+	}
+}
+
+// Create stores a newly registered credential
+func (s *CredentialStore) Create(credential *models.Credential) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.credentials[credential.ID]; exists {
+		return ErrCredentialExists
+	}
+
+	now := time.Now()
+	credential.CreatedAt = now
+	credential.LastUsedAt = now
+	s.credentials[credential.ID] = credential
+
+	return nil
+}
+
+// FindByID finds a credential by its base64url credential ID
+func (s *CredentialStore) FindByID(credentialID string) (*models.Credential, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	credential, exists := s.credentials[credentialID]
+	return credential, exists
+}
+
+// FindByUserID returns all credentials registered by a user
+func (s *CredentialStore) FindByUserID(userID uuid.UUID) []*models.Credential {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	credentials := make([]*models.Credential, 0)
+	for _, credential := range s.credentials {
+		if credential.UserID == userID {
+			credentials = append(credentials, credential)
+		}
+	}
+	return credentials
+}
+
+// UpdateSignCount records a successful assertion. Authenticators that keep a counter must
+// report a strictly increasing value; anything else suggests a cloned authenticator.
+func (s *CredentialStore) UpdateSignCount(credentialID string, signCount uint32) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	credential, exists := s.credentials[credentialID]
+	if !exists {
+		return ErrCredentialNotFound
+	}
+
+	if (signCount != 0 || credential.SignCount != 0) && signCount <= credential.SignCount {
+		return ErrSignCountRegression
+	}
+
+	credential.SignCount = signCount
+	credential.LastUsedAt = time.Now()
+
+	return nil
+}
+
+// Delete deletes a credential
+func (s *CredentialStore) Delete(credentialID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.credentials[credentialID]; exists {
+		delete(s.credentials, credentialID)
+		return true
+	}
+
+	return false
+}
+
+// purgeUserLocked removes every passkey of a user and their open ceremonies.
+// Callers must hold s.mu.
+func (s *CredentialStore) purgeUserLocked(userID uuid.UUID) int {
+	removed := 0
+	for credentialID, credential := range s.credentials {
+		if credential.UserID == userID {
+			delete(s.credentials, credentialID)
+			removed++
+		}
+	}
+	for challenge, ceremony := range s.ceremonies {
+		if ceremony.UserID == userID {
+			delete(s.ceremonies, challenge)
+		}
+	}
+	return removed
+}
+
+// BeginCeremony records a pending ceremony keyed by its challenge
+func (s *CredentialStore) BeginCeremony(kind, challenge string, userID, deviceID uuid.UUID) *models.PasskeyCeremony {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ceremony := &models.PasskeyCeremony{
+		Challenge: challenge,
+		Kind:      kind,
+		UserID:    userID,
+		DeviceID:  deviceID,
+		ExpiresAt: time.Now().Add(PasskeyCeremonyDuration),
+	}
+
+	s.ceremonies[challenge] = ceremony
+	return ceremony
+}
+
+// ConsumeCeremony removes and returns a pending ceremony so each challenge is used only once
+func (s *CredentialStore) ConsumeCeremony(kind, challenge string) (*models.PasskeyCeremony, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ceremony, exists := s.ceremonies[challenge]
+	if !exists {
+		return nil, false
+	}
+
+	delete(s.ceremonies, challenge)
+
+	if ceremony.Kind != kind || ceremony.IsExpired() {
+		return nil, false
+	}
+
+	return ceremony, true
+}
+
+// CleanupExpired removes expired ceremonies
+func (s *CredentialStore) CleanupExpired() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for challenge, ceremony := range s.ceremonies {
+		if ceremony.IsExpired() {
+			delete(s.ceremonies, challenge)
+		}
+	}
+}
+
+// GetAll returns all credentials
+func (s *CredentialStore) GetAll() []*models.Credential {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	credentials := make([]*models.Credential, 0, len(s.credentials))
+	for _, credential := range s.credentials {
+		credentials = append(credentials, credential)
+	}
+	return credentials
+}
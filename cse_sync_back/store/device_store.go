@@ -1,12 +1,21 @@
 package store
 
 import (
+	"errors"
 	"sync"
+	"time"
 
 	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/models"
 	"github.com/google/uuid"
 )
 
+var (
+	ErrDeviceNotFound      = errors.New("device not found")
+	ErrDeviceKeyEpochStale = errors.New("key epoch must increase")
+)
+
+// DeviceStore manages devices in memory. Devices are only changed under mu, so
+// every method returns copies.
 type DeviceStore struct {
 	devices map[uuid.UUID]*models.Device
 	mu      sync.RWMutex
@@ -18,14 +27,15 @@ func NewDeviceStore() *DeviceStore {
 	}
 }
 
-func (s *DeviceStore) Create(userID uuid.UUID, wrappedUMK string) *models.Device {
+func (s *DeviceStore) Create(userID uuid.UUID, wrappedUMK string, wrap models.DeviceWrap) *models.Device {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	device := models.NewDevice(userID, wrappedUMK)
+	device := models.NewDevice(userID, wrappedUMK, wrap)
 	s.devices[device.ID] = device
 
-	return device
+	copied := *device
+	return &copied
 }
 
 func (s *DeviceStore) FindByID(deviceID uuid.UUID) (*models.Device, bool) {
@@ -33,7 +43,35 @@ func (s *DeviceStore) FindByID(deviceID uuid.UUID) (*models.Device, bool) {
 	defer s.mu.RUnlock()
 
 	device, exists := s.devices[deviceID]
-	return device, exists
+	if !exists {
+		return nil, false
+	}
+
+	copied := *device
+	return &copied, true
+}
+
+// UpdateWrappedUMK replaces a device's wrapped UMK with one produced under a newer local KEK.
+// The key epoch must strictly increase so a replayed older wrap cannot overwrite a newer one.
+func (s *DeviceStore) UpdateWrappedUMK(deviceID uuid.UUID, wrappedUMK string, wrap models.DeviceWrap) (*models.Device, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	device, exists := s.devices[deviceID]
+	if !exists {
+		return nil, ErrDeviceNotFound
+	}
+
+	if wrap.KeyEpoch <= device.Wrap.KeyEpoch {
+		return nil, ErrDeviceKeyEpochStale
+	}
+
+	device.WrappedUMK = wrappedUMK
+	device.Wrap = wrap
+	device.WrapUpdatedAt = time.Now()
+
+	copied := *device
+	return &copied, nil
 }
 
 func (s *DeviceStore) FindByUserID(userID uuid.UUID) []*models.Device {
@@ -43,7 +81,8 @@ func (s *DeviceStore) FindByUserID(userID uuid.UUID) []*models.Device {
 	var userDevices []*models.Device
 	for _, device := range s.devices {
 		if device.UserID == userID {
-			userDevices = append(userDevices, device)
+			copied := *device
+			userDevices = append(userDevices, &copied)
 		}
 	}
 
@@ -56,7 +95,8 @@ func (s *DeviceStore) GetAll() []*models.Device {
 
 	devices := make([]*models.Device, 0, len(s.devices))
 	for _, device := range s.devices {
-		devices = append(devices, device)
+		copied := *device
+		devices = append(devices, &copied)
 	}
 
 	return devices
@@ -73,3 +113,15 @@ func (s *DeviceStore) Delete(deviceID uuid.UUID) bool {
 
 	return false
 }
+
+// purgeUserLocked removes every device of a user. Callers must hold s.mu.
+func (s *DeviceStore) purgeUserLocked(userID uuid.UUID) int {
+	removed := 0
+	for deviceID, device := range s.devices {
+		if device.UserID == userID {
+			delete(s.devices, deviceID)
+			removed++
+		}
+	}
+	return removed
+}
@@ -0,0 +1,180 @@
+package store
+
+import (
+	"crypto/subtle"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/models"
+	"github.com/google/uuid"
+)
+
+const (
+	EnrollmentDuration          = 10 * time.Minute
+	EnrollmentMaxFailedAttempts = 5
+)
+
+var (
+	ErrEnrollmentNotFound       = errors.New("enrollment not found")
+	ErrEnrollmentNotPending     = errors.New("enrollment is not pending")
+	ErrEnrollmentNotApproved    = errors.New("enrollment is not approved")
+	ErrConfirmationCodeMismatch = errors.New("confirmation code mismatch")
+	ErrTooManyAttempts          = errors.New("too many failed attempts")
+)
+
+// EnrollmentStore manages pending device enrollments in memory
+type EnrollmentStore struct {
+	mu          sync.RWMutex
+	enrollments map[uuid.UUID]*models.Enrollment
+}
+
+// NewEnrollmentStore creates a new EnrollmentStore
+func NewEnrollmentStore() *EnrollmentStore {
+	return &EnrollmentStore{
+		enrollments: make(map[uuid.UUID]*models.Enrollment),
+	}
+}
+
+// Create creates a pending enrollment for the requesting session
+func (s *EnrollmentStore) Create(userID uuid.UUID, sessionID, ephemeralPublicKey, confirmationCode, deviceLabel string) *models.Enrollment {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	enrollment := &models.Enrollment{
+		ID:                 uuid.New(),
+		UserID:             userID,
+		SessionID:          sessionID,
+		EphemeralPublicKey: ephemeralPublicKey,
+		ConfirmationCode:   confirmationCode,
+		DeviceLabel:        deviceLabel,
+		Status:             models.EnrollmentStatusPending,
+		CreatedAt:          now,
+		ExpiresAt:          now.Add(EnrollmentDuration),
+	}
+
+	s.enrollments[enrollment.ID] = enrollment
+	return enrollment
+}
+
+// FindByID finds an unexpired enrollment by ID
+func (s *EnrollmentStore) FindByID(enrollmentID uuid.UUID) (*models.Enrollment, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	enrollment, exists := s.enrollments[enrollmentID]
+	if !exists || enrollment.IsExpired() {
+		return nil, false
+	}
+
+	copied := *enrollment
+	return &copied, true
+}
+
+// FindPendingByUserID returns the unexpired pending enrollments of a user
+func (s *EnrollmentStore) FindPendingByUserID(userID uuid.UUID) []*models.Enrollment {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	enrollments := make([]*models.Enrollment, 0)
+	for _, enrollment := range s.enrollments {
+		if enrollment.UserID == userID && enrollment.Status == models.EnrollmentStatusPending && !enrollment.IsExpired() {
+			copied := *enrollment
+			enrollments = append(enrollments, &copied)
+		}
+	}
+	return enrollments
+}
+
+// Approve checks the confirmation code and attaches the UMK sealed to the ephemeral key.
+// Repeated wrong codes reject the enrollment.
+func (s *EnrollmentStore) Approve(enrollmentID uuid.UUID, confirmationCode string, approverDeviceID uuid.UUID, sealedUMK string) (*models.Enrollment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	enrollment, exists := s.enrollments[enrollmentID]
+	if !exists || enrollment.IsExpired() {
+		return nil, ErrEnrollmentNotFound
+	}
+
+	if enrollment.Status != models.EnrollmentStatusPending {
+		return nil, ErrEnrollmentNotPending
+	}
+
+	if subtle.ConstantTimeCompare([]byte(confirmationCode), []byte(enrollment.ConfirmationCode)) != 1 {
+		enrollment.FailedAttempts++
+		if enrollment.FailedAttempts >= EnrollmentMaxFailedAttempts {
+			enrollment.Status = models.EnrollmentStatusRejected
+			return nil, ErrTooManyAttempts
+		}
+		return nil, ErrConfirmationCodeMismatch
+	}
+
+	enrollment.Status = models.EnrollmentStatusApproved
+	enrollment.ApproverDeviceID = &approverDeviceID
+	enrollment.SealedUMK = sealedUMK
+
+	copied := *enrollment
+	return &copied, nil
+}
+
+// Reject marks a pending enrollment as rejected
+func (s *EnrollmentStore) Reject(enrollmentID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	enrollment, exists := s.enrollments[enrollmentID]
+	if !exists || enrollment.IsExpired() {
+		return ErrEnrollmentNotFound
+	}
+
+	if enrollment.Status != models.EnrollmentStatusPending {
+		return ErrEnrollmentNotPending
+	}
+
+	enrollment.Status = models.EnrollmentStatusRejected
+	return nil
+}
+
+// Complete records the device created from an approved enrollment and drops the sealed UMK
+func (s *EnrollmentStore) Complete(enrollmentID uuid.UUID, deviceID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	enrollment, exists := s.enrollments[enrollmentID]
+	if !exists || enrollment.IsExpired() {
+		return ErrEnrollmentNotFound
+	}
+
+	if enrollment.Status != models.EnrollmentStatusApproved {
+		return ErrEnrollmentNotApproved
+	}
+
+	enrollment.Status = models.EnrollmentStatusCompleted
+	enrollment.DeviceID = &deviceID
+	enrollment.SealedUMK = ""
+
+	return nil
+}
+
+// purgeUserLocked removes every enrollment of a user. Callers must hold s.mu.
+func (s *EnrollmentStore) purgeUserLocked(userID uuid.UUID) {
+	for enrollmentID, enrollment := range s.enrollments {
+		if enrollment.UserID == userID {
+			delete(s.enrollments, enrollmentID)
+		}
+	}
+}
+
+// CleanupExpired removes expired enrollments
+func (s *EnrollmentStore) CleanupExpired() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, enrollment := range s.enrollments {
+		if enrollment.IsExpired() {
+			delete(s.enrollments, id)
+		}
+	}
+}
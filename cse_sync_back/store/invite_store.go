@@ -0,0 +1,165 @@
+package store
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/models"
+	"github.com/google/uuid"
+)
+
+const (
+	// InvitePrefix marks invite tokens so they are easy to tell from other secrets
+	InvitePrefix = "cseinv_"
+
+	inviteTokenBytes  = 24
+	invitePrefixChars = len(InvitePrefix) + 6
+)
+
+var ErrInviteNotFound = errors.New("invite not found, expired or used up")
+
+// InviteStore manages registration invites in memory, keyed by token hash
+type InviteStore struct {
+	mu      sync.Mutex
+	invites map[string]*models.Invite
+}
+
+// NewInviteStore creates a new InviteStore
+func NewInviteStore() *InviteStore {
+	return &InviteStore{
+		invites: make(map[string]*models.Invite),
+	}
+}
+
+func hashInviteToken(token string) string {
+	digest := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(digest[:])
+}
+
+// Create issues an invite and returns it with the raw token, which is not stored
+func (s *InviteStore) Create(note string, maxUses int, lifetime time.Duration) (*models.Invite, string) {
+	b := make([]byte, inviteTokenBytes)
+	rand.Read(b)
+	token := InvitePrefix + base64.RawURLEncoding.EncodeToString(b)
+
+	now := time.Now()
+	invite := &models.Invite{
+		ID:        uuid.New(),
+		Prefix:    token[:invitePrefixChars],
+		TokenHash: hashInviteToken(token),
+		Note:      note,
+		MaxUses:   maxUses,
+		CreatedAt: now,
+		ExpiresAt: now.Add(lifetime),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.invites[invite.TokenHash] = invite
+
+	copied := *invite
+	return &copied, token
+}
+
+// Reserve holds one sign-up of the invite with the given raw token for a sign-up in
+// progress. The reservation must be passed to Commit or Release.
+func (s *InviteStore) Reserve(token string) (*models.Invite, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	invite, exists := s.invites[hashInviteToken(token)]
+	if !exists || !invite.IsUsable() {
+		return nil, ErrInviteNotFound
+	}
+
+	invite.Reserved++
+
+	copied := *invite
+	return &copied, nil
+}
+
+// Commit turns a reservation into a use once its sign-up completed. A sign-up that
+// reserved in time completes even if the invite was revoked or expired since.
+func (s *InviteStore) Commit(inviteID uuid.UUID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if invite, exists := s.findLocked(inviteID); exists && invite.Reserved > 0 {
+		invite.Reserved--
+		invite.Uses++
+	}
+}
+
+// Release gives back the reservation of a sign-up that failed or was abandoned
+func (s *InviteStore) Release(inviteID uuid.UUID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if invite, exists := s.findLocked(inviteID); exists && invite.Reserved > 0 {
+		invite.Reserved--
+	}
+}
+
+// List returns every invite, newest first
+func (s *InviteStore) List() []*models.Invite {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	invites := make([]*models.Invite, 0, len(s.invites))
+	for _, invite := range s.invites {
+		copied := *invite
+		invites = append(invites, &copied)
+	}
+	slices.SortFunc(invites, func(a, b *models.Invite) int {
+		return b.CreatedAt.Compare(a.CreatedAt)
+	})
+	return invites
+}
+
+// Revoke stops an invite from admitting further sign-ups
+func (s *InviteStore) Revoke(inviteID uuid.UUID) (*models.Invite, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	invite, exists := s.findLocked(inviteID)
+	if !exists {
+		return nil, ErrInviteNotFound
+	}
+
+	if invite.RevokedAt == nil {
+		now := time.Now()
+		invite.RevokedAt = &now
+	}
+
+	copied := *invite
+	return &copied, nil
+}
+
+// CleanupExpired removes expired invites that no sign-up in progress still reserves
+func (s *InviteStore) CleanupExpired() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for tokenHash, invite := range s.invites {
+		if invite.IsExpired() && invite.Reserved == 0 {
+			delete(s.invites, tokenHash)
+		}
+	}
+}
+
+// findLocked looks an invite up by ID; the map is keyed by token hash
+func (s *InviteStore) findLocked(inviteID uuid.UUID) (*models.Invite, bool) {
+	for _, invite := range s.invites {
+		if invite.ID == inviteID {
+			return invite, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,113 @@
+package store
+
+import (
+	"sync"
+	"time"
+)
+
+// LockoutPolicy limits attempts per window and locks a key out for exponentially
+// longer periods each time it misbehaves
+type LockoutPolicy struct {
+	Limit       int
+	Window      time.Duration
+	BaseLockout time.Duration
+	MaxLockout  time.Duration
+}
+
+type lockoutEntry struct {
+	windowStart time.Time
+	count       int
+	strikes     int
+	lockedUntil time.Time
+	lastSeen    time.Time
+	window      time.Duration
+}
+
+// LockoutStore tracks attempts and lockouts per key in memory
+type LockoutStore struct {
+	mu      sync.Mutex
+	entries map[string]*lockoutEntry
+}
+
+// NewLockoutStore creates a new LockoutStore
+func NewLockoutStore() *LockoutStore {
+	return &LockoutStore{
+		entries: make(map[string]*lockoutEntry),
+	}
+}
+
+// Attempt counts an attempt for key. It returns false and the remaining lockout
+// when the key is locked or the attempt exceeds the policy limit.
+func (s *LockoutStore) Attempt(key string, policy LockoutPolicy) (time.Duration, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	entry := s.entry(key, policy, now)
+
+	if now.Before(entry.lockedUntil) {
+		return entry.lockedUntil.Sub(now), false
+	}
+
+	if now.Sub(entry.windowStart) > policy.Window {
+		entry.windowStart = now
+		entry.count = 0
+	}
+
+	entry.count++
+	if entry.count > policy.Limit {
+		return s.strike(entry, policy, now), false
+	}
+
+	return 0, true
+}
+
+// Fail records a failed attempt and locks key out with exponential backoff
+func (s *LockoutStore) Fail(key string, policy LockoutPolicy) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	return s.strike(s.entry(key, policy, now), policy, now)
+}
+
+// CleanupExpired forgets keys that are neither locked nor inside their window,
+// which also resets their backoff
+func (s *LockoutStore) CleanupExpired() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for key, entry := range s.entries {
+		if now.After(entry.lockedUntil) && now.Sub(entry.lastSeen) > entry.window {
+			delete(s.entries, key)
+		}
+	}
+}
+
+func (s *LockoutStore) entry(key string, policy LockoutPolicy, now time.Time) *lockoutEntry {
+	entry, exists := s.entries[key]
+	if !exists {
+		entry = &lockoutEntry{windowStart: now}
+		s.entries[key] = entry
+	}
+	entry.lastSeen = now
+	entry.window = policy.Window
+	return entry
+}
+
+func (s *LockoutStore) strike(entry *lockoutEntry, policy LockoutPolicy, now time.Time) time.Duration {
+	entry.strikes++
+
+	lockout := policy.BaseLockout
+	for i := 1; i < entry.strikes && lockout < policy.MaxLockout; i++ {
+		lockout *= 2
+	}
+	lockout = min(lockout, policy.MaxLockout)
+
+	entry.lockedUntil = now.Add(lockout)
+	entry.windowStart = entry.lockedUntil
+	entry.count = 0
+
+	return lockout
+}
@@ -64,3 +64,15 @@ func (s *MessageStore) FindByUserID(userID uuid.UUID) []*models.Message {
 	}
 	return messages
 }
+
+// purgeUserLocked removes every message of a user. Callers must hold s.mu.
+func (s *MessageStore) purgeUserLocked(userID uuid.UUID) int {
+	removed := 0
+	for messageID, message := range s.messages {
+		if message.UserID == userID {
+			delete(s.messages, messageID)
+			removed++
+		}
+	}
+	return removed
+}
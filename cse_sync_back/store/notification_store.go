@@ -0,0 +1,97 @@
+package store
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/models"
+	"github.com/google/uuid"
+)
+
+const NotificationRetention = 30 * 24 * time.Hour
+
+// NotificationStore manages user notifications in memory
+type NotificationStore struct {
+	mu            sync.RWMutex
+	notifications map[uuid.UUID]*models.Notification
+}
+
+// NewNotificationStore creates a new NotificationStore
+func NewNotificationStore() *NotificationStore {
+	return &NotificationStore{
+		notifications: make(map[uuid.UUID]*models.Notification),
+	}
+}
+
+// Create creates a notification for a user
+func (s *NotificationStore) Create(userID uuid.UUID, kind, message string, data map[string]string) *models.Notification {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	notification := &models.Notification{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Kind:      kind,
+		Message:   message,
+		Data:      data,
+		CreatedAt: time.Now(),
+	}
+
+	s.notifications[notification.ID] = notification
+	return notification
+}
+
+// FindByUserID returns a user's notifications, newest first
+func (s *NotificationStore) FindByUserID(userID uuid.UUID) []*models.Notification {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	notifications := make([]*models.Notification, 0)
+	for _, notification := range s.notifications {
+		if notification.UserID == userID {
+			notifications = append(notifications, notification)
+		}
+	}
+
+	slices.SortFunc(notifications, func(a, b *models.Notification) int {
+		return b.CreatedAt.Compare(a.CreatedAt)
+	})
+	return notifications
+}
+
+// MarkRead marks a user's notification as read
+func (s *NotificationStore) MarkRead(notificationID, userID uuid.UUID) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	notification, exists := s.notifications[notificationID]
+	if !exists || notification.UserID != userID {
+		return false
+	}
+
+	notification.Read = true
+	return true
+}
+
+// purgeUserLocked removes every notification of a user. Callers must hold s.mu.
+func (s *NotificationStore) purgeUserLocked(userID uuid.UUID) {
+	for notificationID, notification := range s.notifications {
+		if notification.UserID == userID {
+			delete(s.notifications, notificationID)
+		}
+	}
+}
+
+// CleanupExpired removes notifications older than the retention period
+func (s *NotificationStore) CleanupExpired() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cutoff := time.Now().Add(-NotificationRetention)
+	for id, notification := range s.notifications {
+		if notification.CreatedAt.Before(cutoff) {
+			delete(s.notifications, id)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package store
+
+import (
+	"crypto/rand"
+	"sync"
+	"time"
+
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/models"
+)
+
+// OIDCLoginDuration is how long the user has to complete sign-in at the provider
+const OIDCLoginDuration = 10 * time.Minute
+
+// OIDCLoginStore manages pending OpenID Connect authorization requests in memory
+type OIDCLoginStore struct {
+	mu     sync.Mutex
+	logins map[string]*models.OIDCLogin
+}
+
+// NewOIDCLoginStore creates a new OIDCLoginStore
+func NewOIDCLoginStore() *OIDCLoginStore {
+	return &OIDCLoginStore{
+		logins: make(map[string]*models.OIDCLogin),
+	}
+}
+
+// Begin records a new authorization request with a random state and nonce
+func (s *OIDCLoginStore) Begin(codeVerifier string) *models.OIDCLogin {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	login := &models.OIDCLogin{
+		State:        rand.Text(),
+		Nonce:        rand.Text(),
+		CodeVerifier: codeVerifier,
+		ExpiresAt:    time.Now().Add(OIDCLoginDuration),
+	}
+
+	s.logins[login.State] = login
+	return login
+}
+
+// Consume removes and returns the pending request for state if it has not expired
+func (s *OIDCLoginStore) Consume(state string) (*models.OIDCLogin, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	login, exists := s.logins[state]
+	if !exists {
+		return nil, false
+	}
+
+	delete(s.logins, state)
+
+	if login.IsExpired() {
+		return nil, false
+	}
+
+	return login, true
+}
+
+// CleanupExpired removes expired authorization requests
+func (s *OIDCLoginStore) CleanupExpired() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for state, login := range s.logins {
+		if login.IsExpired() {
+			delete(s.logins, state)
+		}
+	}
+}
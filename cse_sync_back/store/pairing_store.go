@@ -0,0 +1,240 @@
+package store
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/models"
+	"github.com/google/uuid"
+)
+
+const (
+	PairingRedeemWindow      = 5 * time.Minute
+	PairingDuration          = 15 * time.Minute
+	PairingMaxMessages       = 32
+	PairingMaxFailedRedeems  = 5
+	PairingFailedRedeemReset = 15 * time.Minute
+)
+
+var (
+	ErrPairingCodeInUse       = errors.New("pairing code already in use")
+	ErrPairingNotFound        = errors.New("pairing session not found")
+	ErrPairingNotRedeemed     = errors.New("pairing session has not been redeemed")
+	ErrPairingMailboxFull     = errors.New("pairing message limit reached")
+	ErrPairingRedeemThrottled = errors.New("too many failed pairing attempts")
+)
+
+type redeemFailures struct {
+	count   int
+	resetAt time.Time
+}
+
+// PairingStore manages short-code pairing sessions in memory
+type PairingStore struct {
+	mu       sync.Mutex
+	pairings map[uuid.UUID]*models.PairingSession
+	codes    map[string]uuid.UUID
+	failures map[string]*redeemFailures
+}
+
+// NewPairingStore creates a new PairingStore
+func NewPairingStore() *PairingStore {
+	return &PairingStore{
+		pairings: make(map[uuid.UUID]*models.PairingSession),
+		codes:    make(map[string]uuid.UUID),
+		failures: make(map[string]*redeemFailures),
+	}
+}
+
+// Create creates a pairing session waiting for its code to be redeemed
+func (s *PairingStore) Create(userID uuid.UUID, initiatorSessionID, code string) (*models.PairingSession, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existingID, exists := s.codes[code]; exists {
+		if existing, ok := s.pairings[existingID]; ok && !existing.IsExpired() {
+			return nil, ErrPairingCodeInUse
+		}
+	}
+
+	now := time.Now()
+	pairing := &models.PairingSession{
+		ID:                 uuid.New(),
+		UserID:             userID,
+		InitiatorSessionID: initiatorSessionID,
+		Code:               code,
+		Status:             models.PairingStatusWaiting,
+		CreatedAt:          now,
+		RedeemBy:           now.Add(PairingRedeemWindow),
+		ExpiresAt:          now.Add(PairingDuration),
+	}
+
+	s.pairings[pairing.ID] = pairing
+	s.codes[code] = pairing.ID
+
+	copied := *pairing
+	return &copied, nil
+}
+
+// Redeem consumes a code on behalf of a new device identified by clientKey.
+// Codes are single use, and repeated failures from the same client are throttled.
+func (s *PairingStore) Redeem(code, peerToken, clientKey string) (*models.PairingSession, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	failures, tracked := s.failures[clientKey]
+	if tracked && now.After(failures.resetAt) {
+		delete(s.failures, clientKey)
+		tracked = false
+	}
+	if tracked && failures.count >= PairingMaxFailedRedeems {
+		return nil, ErrPairingRedeemThrottled
+	}
+
+	pairingID, exists := s.codes[code]
+	var pairing *models.PairingSession
+	if exists {
+		pairing = s.pairings[pairingID]
+	}
+
+	if pairing == nil || pairing.IsExpired() || pairing.Status != models.PairingStatusWaiting {
+		if !tracked {
+			failures = &redeemFailures{resetAt: now.Add(PairingFailedRedeemReset)}
+			s.failures[clientKey] = failures
+		}
+		failures.count++
+		return nil, ErrPairingNotFound
+	}
+
+	delete(s.codes, code)
+	pairing.Status = models.PairingStatusRedeemed
+	pairing.PeerTokenHash = hashPairingToken(peerToken)
+
+	copied := *pairing
+	return &copied, nil
+}
+
+// FindForInitiator finds an active pairing session owned by the initiating session
+func (s *PairingStore) FindForInitiator(pairingID uuid.UUID, userID uuid.UUID, sessionID string) (*models.PairingSession, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pairing, exists := s.pairings[pairingID]
+	if !exists || pairing.IsExpired() || pairing.UserID != userID || pairing.InitiatorSessionID != sessionID {
+		return nil, false
+	}
+
+	copied := *pairing
+	return &copied, true
+}
+
+// FindForPeer finds an active pairing session by the token handed out on redemption
+func (s *PairingStore) FindForPeer(pairingID uuid.UUID, peerToken string) (*models.PairingSession, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pairing, exists := s.pairings[pairingID]
+	if !exists || pairing.IsExpired() || pairing.Status != models.PairingStatusRedeemed {
+		return nil, false
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashPairingToken(peerToken)), []byte(pairing.PeerTokenHash)) != 1 {
+		return nil, false
+	}
+
+	copied := *pairing
+	return &copied, true
+}
+
+// AppendMessage relays an opaque payload from one side of a redeemed pairing
+func (s *PairingStore) AppendMessage(pairingID uuid.UUID, sender, payload string) (*models.PairingMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pairing, exists := s.pairings[pairingID]
+	if !exists || pairing.IsExpired() {
+		return nil, ErrPairingNotFound
+	}
+
+	if pairing.Status != models.PairingStatusRedeemed {
+		return nil, ErrPairingNotRedeemed
+	}
+
+	if len(pairing.Messages) >= PairingMaxMessages {
+		return nil, ErrPairingMailboxFull
+	}
+
+	message := &models.PairingMessage{
+		Seq:       len(pairing.Messages) + 1,
+		Sender:    sender,
+		Payload:   payload,
+		CreatedAt: time.Now(),
+	}
+	pairing.Messages = append(pairing.Messages, message)
+
+	return message, nil
+}
+
+// MessagesFor returns the messages sent by the other side after the given sequence number
+func (s *PairingStore) MessagesFor(pairingID uuid.UUID, recipient string, after int) ([]*models.PairingMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pairing, exists := s.pairings[pairingID]
+	if !exists || pairing.IsExpired() {
+		return nil, ErrPairingNotFound
+	}
+
+	messages := make([]*models.PairingMessage, 0)
+	for _, message := range pairing.Messages {
+		if message.Seq > after && message.Sender != recipient {
+			messages = append(messages, message)
+		}
+	}
+	return messages, nil
+}
+
+// Delete closes a pairing session
+func (s *PairingStore) Delete(pairingID uuid.UUID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if pairing, exists := s.pairings[pairingID]; exists {
+		if s.codes[pairing.Code] == pairingID {
+			delete(s.codes, pairing.Code)
+		}
+		delete(s.pairings, pairingID)
+	}
+}
+
+// CleanupExpired removes expired pairing sessions and stale failure counters
+func (s *PairingStore) CleanupExpired() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, pairing := range s.pairings {
+		if pairing.IsExpired() {
+			if s.codes[pairing.Code] == id {
+				delete(s.codes, pairing.Code)
+			}
+			delete(s.pairings, id)
+		}
+	}
+
+	now := time.Now()
+	for key, failures := range s.failures {
+		if now.After(failures.resetAt) {
+			delete(s.failures, key)
+		}
+	}
+}
+
+func hashPairingToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,155 @@
+package store
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"math/bits"
+	"sync"
+	"time"
+
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/models"
+	"github.com/google/uuid"
+)
+
+const (
+	PoWChallengeDuration = 2 * time.Minute
+
+	// PoWBaseDifficulty is the number of leading zero bits asked of a quiet client;
+	// each doubling of its recent requests past powFreeRequests adds one bit, up to
+	// PoWMaxDifficulty
+	PoWBaseDifficulty = 16
+	PoWMaxDifficulty  = 24
+
+	powVolumeWindow  = 10 * time.Minute
+	powFreeRequests  = 10
+	powSeedBytes     = 16
+	powMaxNonceBytes = 64
+)
+
+var (
+	ErrPoWChallengeNotFound = errors.New("proof-of-work challenge not found or expired")
+	ErrPoWInvalidSolution   = errors.New("proof-of-work solution does not meet the difficulty")
+)
+
+// PoWStore issues proof-of-work challenges in memory and tracks how many each
+// client address asked for recently
+type PoWStore struct {
+	mu         sync.Mutex
+	challenges map[uuid.UUID]*models.PoWChallenge
+	volume     map[string][]time.Time
+}
+
+// NewPoWStore creates a new PoWStore
+func NewPoWStore() *PoWStore {
+	return &PoWStore{
+		challenges: make(map[uuid.UUID]*models.PoWChallenge),
+		volume:     make(map[string][]time.Time),
+	}
+}
+
+// Issue creates a challenge for clientIP whose difficulty grows with the number of
+// challenges that address requested within the last ten minutes
+func (s *PoWStore) Issue(clientIP string) *models.PoWChallenge {
+	seed := make([]byte, powSeedBytes)
+	rand.Read(seed)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	recent := s.recentLocked(clientIP, now)
+	// Past the maximum difficulty further requests change nothing, so stop counting
+	if powDifficulty(len(recent)) < PoWMaxDifficulty {
+		recent = append(recent, now)
+	}
+	s.volume[clientIP] = recent
+
+	challenge := &models.PoWChallenge{
+		ID:         uuid.New(),
+		Seed:       base64.RawURLEncoding.EncodeToString(seed),
+		Difficulty: powDifficulty(len(recent)),
+		ClientIP:   clientIP,
+		ExpiresAt:  now.Add(PoWChallengeDuration),
+	}
+
+	s.challenges[challenge.ID] = challenge
+
+	copied := *challenge
+	return &copied
+}
+
+// Redeem checks nonce against a challenge issued to clientIP. The challenge is
+// removed whether or not the solution is valid, so each one is answered only once.
+func (s *PoWStore) Redeem(challengeID uuid.UUID, nonce string, clientIP string) error {
+	s.mu.Lock()
+	challenge, exists := s.challenges[challengeID]
+	delete(s.challenges, challengeID)
+	s.mu.Unlock()
+
+	if !exists || challenge.ClientIP != clientIP || challenge.IsExpired() {
+		return ErrPoWChallengeNotFound
+	}
+
+	if nonce == "" || len(nonce) > powMaxNonceBytes {
+		return ErrPoWInvalidSolution
+	}
+
+	digest := sha256.Sum256([]byte(challenge.Seed + ":" + nonce))
+	if leadingZeroBits(digest[:]) < challenge.Difficulty {
+		return ErrPoWInvalidSolution
+	}
+
+	return nil
+}
+
+// CleanupExpired removes expired challenges and request history outside the window
+func (s *PoWStore) CleanupExpired() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for id, challenge := range s.challenges {
+		if challenge.IsExpired() {
+			delete(s.challenges, id)
+		}
+	}
+
+	for clientIP := range s.volume {
+		if recent := s.recentLocked(clientIP, now); len(recent) > 0 {
+			s.volume[clientIP] = recent
+		} else {
+			delete(s.volume, clientIP)
+		}
+	}
+}
+
+// recentLocked returns the request times of clientIP that are still inside the window
+func (s *PoWStore) recentLocked(clientIP string, now time.Time) []time.Time {
+	times := s.volume[clientIP]
+	cutoff := now.Add(-powVolumeWindow)
+
+	i := 0
+	for i < len(times) && !times[i].After(cutoff) {
+		i++
+	}
+	return times[i:]
+}
+
+// powDifficulty adds a bit for each doubling of requests past powFreeRequests
+func powDifficulty(requests int) int {
+	difficulty := PoWBaseDifficulty + bits.Len(uint(requests/powFreeRequests))
+	return min(difficulty, PoWMaxDifficulty)
+}
+
+func leadingZeroBits(digest []byte) int {
+	count := 0
+	for _, b := range digest {
+		if b != 0 {
+			return count + bits.LeadingZeros8(b)
+		}
+		count += 8
+	}
+	return count
+}
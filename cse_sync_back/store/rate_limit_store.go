@@ -0,0 +1,102 @@
+package store
+
+import (
+	"sync"
+	"time"
+)
+
+// RateLimitPolicy is a token bucket holding up to Burst requests and refilled with
+// one request every Interval. Name keeps buckets of different policies apart.
+type RateLimitPolicy struct {
+	Name     string
+	Burst    int
+	Interval time.Duration
+}
+
+// RateLimitResult describes a bucket after a request was counted against it
+type RateLimitResult struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is the time until the bucket is full again
+	Reset time.Duration
+	// RetryAfter is the time until the next request is allowed, zero if it already is
+	RetryAfter time.Duration
+}
+
+// RateLimiter counts requests against token buckets. MemoryRateLimiter keeps them in
+// process; a backend shared between servers only needs to implement Take.
+type RateLimiter interface {
+	Take(key string, policy RateLimitPolicy) RateLimitResult
+}
+
+type rateLimitBucket struct {
+	tokens  float64
+	updated time.Time
+	fullAt  time.Time
+}
+
+// MemoryRateLimiter keeps token buckets in memory, keyed by policy name and key
+type MemoryRateLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*rateLimitBucket
+}
+
+// NewMemoryRateLimiter creates a new MemoryRateLimiter
+func NewMemoryRateLimiter() *MemoryRateLimiter {
+	return &MemoryRateLimiter{
+		buckets: make(map[string]*rateLimitBucket),
+	}
+}
+
+// Take refills the bucket for key and removes one request from it if one is left
+func (s *MemoryRateLimiter) Take(key string, policy RateLimitPolicy) RateLimitResult {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	burst := float64(policy.Burst)
+
+	bucket, exists := s.buckets[policy.Name+":"+key]
+	if !exists {
+		bucket = &rateLimitBucket{tokens: burst, updated: now}
+		s.buckets[policy.Name+":"+key] = bucket
+	}
+
+	refilled := float64(now.Sub(bucket.updated)) / float64(policy.Interval)
+	bucket.tokens = min(burst, bucket.tokens+refilled)
+	bucket.updated = now
+
+	allowed := bucket.tokens >= 1
+	if allowed {
+		bucket.tokens--
+	}
+
+	reset := time.Duration((burst - bucket.tokens) * float64(policy.Interval))
+	bucket.fullAt = now.Add(reset)
+
+	result := RateLimitResult{
+		Allowed:   allowed,
+		Limit:     policy.Burst,
+		Remaining: int(bucket.tokens),
+		Reset:     reset,
+	}
+	if !allowed {
+		result.RetryAfter = time.Duration((1 - bucket.tokens) * float64(policy.Interval))
+	}
+
+	return result
+}
+
+// CleanupExpired forgets buckets that have refilled, which are the same as new ones
+func (s *MemoryRateLimiter) CleanupExpired() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for key, bucket := range s.buckets {
+		if !now.Before(bucket.fullAt) {
+			delete(s.buckets, key)
+		}
+	}
+}
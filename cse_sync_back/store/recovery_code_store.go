@@ -0,0 +1,107 @@
+package store
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/models"
+	"github.com/google/uuid"
+)
+
+// RecoveryCodeInput is a client-prepared slot for one recovery code
+type RecoveryCodeInput struct {
+	CodeID     string
+	WrappedUMK string
+	Salt       string
+	IV         string
+}
+
+// RecoveryCodeStore manages one-time recovery code slots in memory
+type RecoveryCodeStore struct {
+	mu    sync.RWMutex
+	slots map[uuid.UUID][]*models.RecoveryCodeSlot
+}
+
+// NewRecoveryCodeStore creates a new RecoveryCodeStore
+func NewRecoveryCodeStore() *RecoveryCodeStore {
+	return &RecoveryCodeStore{
+		slots: make(map[uuid.UUID][]*models.RecoveryCodeSlot),
+	}
+}
+
+// Replace discards a user's slots and stores a freshly generated set
+func (s *RecoveryCodeStore) Replace(userID uuid.UUID, inputs []RecoveryCodeInput) []*models.RecoveryCodeSlot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	slots := make([]*models.RecoveryCodeSlot, 0, len(inputs))
+	for _, input := range inputs {
+		slots = append(slots, &models.RecoveryCodeSlot{
+			CodeHash:   hashRecoveryCodeID(input.CodeID),
+			WrappedUMK: input.WrappedUMK,
+			Salt:       input.Salt,
+			IV:         input.IV,
+			CreatedAt:  now,
+		})
+	}
+
+	s.slots[userID] = slots
+	return slots
+}
+
+// FindUnused finds an unused slot by the client's code identifier
+func (s *RecoveryCodeStore) FindUnused(userID uuid.UUID, codeID string) (*models.RecoveryCodeSlot, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	codeHash := hashRecoveryCodeID(codeID)
+	for _, slot := range s.slots[userID] {
+		if slot.CodeHash == codeHash && slot.UsedAt == nil {
+			copied := *slot
+			return &copied, true
+		}
+	}
+	return nil, false
+}
+
+// Burn marks a slot as used so its code can never unlock the UMK again
+func (s *RecoveryCodeStore) Burn(userID uuid.UUID, codeID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	codeHash := hashRecoveryCodeID(codeID)
+	for _, slot := range s.slots[userID] {
+		if slot.CodeHash == codeHash && slot.UsedAt == nil {
+			now := time.Now()
+			slot.UsedAt = &now
+			return true
+		}
+	}
+	return false
+}
+
+// Counts returns the number of unused slots and the size of the current set
+func (s *RecoveryCodeStore) Counts(userID uuid.UUID) (remaining int, total int) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, slot := range s.slots[userID] {
+		if slot.UsedAt == nil {
+			remaining++
+		}
+	}
+	return remaining, len(s.slots[userID])
+}
+
+// purgeUserLocked removes a user's recovery codes. Callers must hold s.mu.
+func (s *RecoveryCodeStore) purgeUserLocked(userID uuid.UUID) {
+	delete(s.slots, userID)
+}
+
+func hashRecoveryCodeID(codeID string) string {
+	sum := sha256.Sum256([]byte(codeID))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,173 @@
+package store
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/models"
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/username"
+	"github.com/google/uuid"
+)
+
+// RegistrationDuration is how long a sign-up has to complete before it is abandoned
+const RegistrationDuration = 15 * time.Minute
+
+var (
+	ErrRegistrationNotFound  = errors.New("registration not found or expired")
+	ErrRegistrationCompleted = errors.New("registration already completed")
+	ErrRegistrationHeld      = errors.New("username is held by another registration")
+)
+
+// RegistrationStore manages pending sign-ups in memory. Each username is held by
+// at most one pending registration, the oldest unexpired one; holders is keyed by
+// the username's confusable skeleton. Invite reservations are committed to
+// inviteStore when a registration completes and released when it fails or expires.
+type RegistrationStore struct {
+	mu            sync.Mutex
+	registrations map[uuid.UUID]*models.Registration
+	holders       map[string]uuid.UUID
+	inviteStore   *InviteStore
+}
+
+// NewRegistrationStore creates a new RegistrationStore
+func NewRegistrationStore(inviteStore *InviteStore) *RegistrationStore {
+	return &RegistrationStore{
+		registrations: make(map[uuid.UUID]*models.Registration),
+		holders:       make(map[string]uuid.UUID),
+		inviteStore:   inviteStore,
+	}
+}
+
+// Begin starts a registration for username, which it holds unless an earlier
+// pending registration already does. Callers get no hint either way. inviteID is
+// the invite reserved for it, if any; the store takes over the reservation.
+func (s *RegistrationStore) Begin(name string, inviteID *uuid.UUID) *models.Registration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	registration := &models.Registration{
+		ID:        uuid.New(),
+		UserID:    uuid.New(),
+		Username:  name,
+		InviteID:  inviteID,
+		Status:    models.RegistrationStatusPending,
+		CreatedAt: now,
+		ExpiresAt: now.Add(RegistrationDuration),
+	}
+
+	s.registrations[registration.ID] = registration
+	if _, held := s.holderLocked(registration.Username); !held {
+		s.holders[username.Skeleton(registration.Username)] = registration.ID
+	}
+
+	copied := *registration
+	return &copied
+}
+
+// Find returns a registration that has not expired
+func (s *RegistrationStore) Find(registrationID uuid.UUID) (*models.Registration, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	registration, exists := s.registrations[registrationID]
+	if !exists || registration.IsExpired() {
+		return nil, false
+	}
+
+	copied := *registration
+	return &copied, true
+}
+
+// Complete finishes a pending registration exactly once. claim creates the account
+// and runs while the store is locked, so no other registration can complete in
+// between; if it fails, or another pending registration holds the username, the
+// registration is marked failed. Its invite reservation becomes a use on success
+// and is released on failure.
+func (s *RegistrationStore) Complete(registrationID uuid.UUID, claim func(*models.Registration) error) (*models.Registration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	registration, exists := s.registrations[registrationID]
+	if !exists || registration.IsExpired() || registration.Status == models.RegistrationStatusFailed {
+		return nil, ErrRegistrationNotFound
+	}
+	if registration.Status == models.RegistrationStatusCompleted {
+		return nil, ErrRegistrationCompleted
+	}
+
+	if holderID, held := s.holderLocked(registration.Username); held && holderID != registration.ID {
+		registration.Status = models.RegistrationStatusFailed
+		s.releaseInviteLocked(registration)
+		return nil, ErrRegistrationHeld
+	}
+
+	if err := claim(registration); err != nil {
+		registration.Status = models.RegistrationStatusFailed
+		s.releaseLocked(registration)
+		s.releaseInviteLocked(registration)
+		return nil, err
+	}
+
+	now := time.Now()
+	registration.Status = models.RegistrationStatusCompleted
+	registration.CompletedAt = &now
+	s.releaseLocked(registration)
+	if registration.InviteID != nil {
+		s.inviteStore.Commit(*registration.InviteID)
+	}
+
+	copied := *registration
+	return &copied, nil
+}
+
+// CleanupExpired removes finished registrations and abandoned ones, freeing the
+// usernames and invite uses the abandoned ones held
+func (s *RegistrationStore) CleanupExpired() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, registration := range s.registrations {
+		if registration.Status != models.RegistrationStatusPending || registration.IsExpired() {
+			s.releaseLocked(registration)
+			if registration.IsExpired() {
+				s.releaseInviteLocked(registration)
+			}
+			delete(s.registrations, id)
+		}
+	}
+}
+
+// holderLocked returns the pending registration holding name, if any
+func (s *RegistrationStore) holderLocked(name string) (uuid.UUID, bool) {
+	key := username.Skeleton(name)
+	holderID, exists := s.holders[key]
+	if !exists {
+		return uuid.Nil, false
+	}
+
+	holder, exists := s.registrations[holderID]
+	if !exists || holder.IsExpired() || holder.Status != models.RegistrationStatusPending {
+		delete(s.holders, key)
+		return uuid.Nil, false
+	}
+
+	return holderID, true
+}
+
+// releaseInviteLocked gives back the invite use reserved for a registration that
+// will not complete. It is called at most once per registration, when it fails or
+// is removed after expiring.
+func (s *RegistrationStore) releaseInviteLocked(registration *models.Registration) {
+	if registration.InviteID != nil {
+		s.inviteStore.Release(*registration.InviteID)
+	}
+}
+
+func (s *RegistrationStore) releaseLocked(registration *models.Registration) {
+	key := username.Skeleton(registration.Username)
+	if s.holders[key] == registration.ID {
+		delete(s.holders, key)
+	}
+}
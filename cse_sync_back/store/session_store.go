@@ -1,6 +1,11 @@
 package store
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"sync"
 	"time"
 
@@ -8,61 +13,459 @@ import (
 	"github.com/google/uuid"
 )
 
-const SessionDuration = 24 * time.Hour
+const (
+	// SessionIdleTimeout ends a session that has not been used for this long
+	SessionIdleTimeout = 30 * time.Minute
+	// SessionAbsoluteTimeout ends a session this long after login regardless of activity
+	SessionAbsoluteTimeout = 24 * time.Hour
+	// SessionRotationInterval is the minimum time between session token rotations
+	SessionRotationInterval = time.Minute
+	// SessionRotationGrace keeps a rotated-out token usable briefly for requests already in flight
+	SessionRotationGrace = 30 * time.Second
+	// SessionMFATimeout bounds how long a pre-auth session waits for the second factor
+	SessionMFATimeout = 5 * time.Minute
 
-// SessionStore manages sessions in memory
+	sessionTokenBytes = 32
+)
+
+var (
+	ErrSessionNotFound = errors.New("session not found or expired")
+	ErrSessionReused   = errors.New("rotated session token was reused")
+)
+
+// retiredSession remembers a rotated-out token so its reuse can be detected
+type retiredSession struct {
+	sessionID string
+	retiredAt time.Time
+	expiresAt time.Time
+}
+
+// SessionStore manages sessions in memory.
+// Raw tokens are never kept: sessions and retired are keyed by token hash,
+// current maps session ID to the current token hash, and userSessions indexes
+// the session IDs of each user. Sessions are only changed under mu, so every
+// method returns copies.
 type SessionStore struct {
-	mu       sync.RWMutex
-	sessions map[string]*models.Session
+	mu           sync.RWMutex
+	sessions     map[string]*models.Session
+	current      map[string]string
+	userSessions map[uuid.UUID]map[string]struct{}
+	retired      map[string]retiredSession
 }
 
 // NewSessionStore creates a new SessionStore
 func NewSessionStore() *SessionStore {
 	return &SessionStore{
-		sessions: make(map[string]*models.Session),
+		sessions:     make(map[string]*models.Session),
+		current:      make(map[string]string),
+		userSessions: make(map[uuid.UUID]map[string]struct{}),
+		retired:      make(map[string]retiredSession),
 	}
 }
 
-// Create creates a new session for a user
-func (s *SessionStore) Create(userID uuid.UUID) *models.Session {
+// newSessionToken returns a 256-bit random bearer token and its hash
+func newSessionToken() (string, string) {
+	b := make([]byte, sessionTokenBytes)
+	rand.Read(b)
+	token := base64.RawURLEncoding.EncodeToString(b)
+	return token, hashSessionToken(token)
+}
+
+func hashSessionToken(token string) string {
+	digest := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(digest[:])
+}
+
+// Create creates a new session for a user and returns it with its bearer token.
+// deviceID may be nil when the login did not prove a device.
+func (s *SessionStore) Create(userID uuid.UUID, deviceID *uuid.UUID, ipAddress, userAgent string) (*models.Session, string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	session, token := s.createLocked(userID, deviceID, ipAddress, userAgent)
+
+	copied := *session
+	return &copied, token
+}
+
+// createLocked adds a full session and returns the stored session with its bearer
+// token. Callers must hold s.mu.
+func (s *SessionStore) createLocked(userID uuid.UUID, deviceID *uuid.UUID, ipAddress, userAgent string) (*models.Session, string) {
+	token, tokenHash := newSessionToken()
+
 	now := time.Now()
 	session := &models.Session{
-		ID:        uuid.New().String(),
-		UserID:    userID,
-		CreatedAt: now,
-		ExpiresAt: now.Add(SessionDuration),
+		ID:              uuid.New().String(),
+		TokenHash:       tokenHash,
+		CSRFToken:       rand.Text(),
+		UserID:          userID,
+		DeviceID:        deviceID,
+		IPAddress:       ipAddress,
+		UserAgent:       userAgent,
+		CreatedAt:       now,
+		AuthenticatedAt: now,
+		RotatedAt:       now,
+		LastSeenAt:      now,
+		IdleExpiresAt:   now.Add(SessionIdleTimeout),
+		ExpiresAt:       now.Add(SessionAbsoluteTimeout),
+	}
+
+	s.sessions[tokenHash] = session
+	s.current[session.ID] = tokenHash
+
+	if s.userSessions[userID] == nil {
+		s.userSessions[userID] = make(map[string]struct{})
+	}
+	s.userSessions[userID][session.ID] = struct{}{}
+
+	return session, token
+}
+
+// CreatePending creates a pre-auth session for a user who still has to pass their
+// second factor. It expires after SessionMFATimeout unless CompleteMFA upgrades it.
+func (s *SessionStore) CreatePending(userID uuid.UUID, deviceID *uuid.UUID, ipAddress, userAgent string) (*models.Session, string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, token := s.createLocked(userID, deviceID, ipAddress, userAgent)
+	session.MFAPending = true
+	session.ExpiresAt = session.CreatedAt.Add(SessionMFATimeout)
+	session.IdleExpiresAt = session.ExpiresAt
+
+	copied := *session
+	return &copied, token
+}
+
+// CreateRegistration creates the session of a pending registration. It expires
+// with the registration unless CompleteRegistration upgrades it.
+func (s *SessionStore) CreateRegistration(registration *models.Registration, ipAddress, userAgent string) (*models.Session, string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, token := s.createLocked(registration.UserID, nil, ipAddress, userAgent)
+	session.RegistrationID = &registration.ID
+	session.ExpiresAt = registration.ExpiresAt
+	session.IdleExpiresAt = session.ExpiresAt
+
+	copied := *session
+	return &copied, token
+}
+
+// CompleteRegistration upgrades a registration session to a full session of the
+// account that was just created, with a new token and CSRF token like CompleteMFA
+func (s *SessionStore) CompleteRegistration(sessionID string) (*models.Session, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, exists := s.sessions[s.current[sessionID]]
+	if !exists || session.IsExpired() || session.RegistrationID == nil {
+		return nil, "", ErrSessionNotFound
+	}
+
+	session.RegistrationID = nil
+	token := s.upgradeLocked(session)
+
+	copied := *session
+	return &copied, token, nil
+}
+
+// CreateDecoy creates a session for a login of an account that does not exist.
+// It behaves like a real session so the login response gives nothing away, down to
+// being a pre-auth session, like CreatePending's, when mfaPending is set.
+func (s *SessionStore) CreateDecoy(decoyUserID uuid.UUID, username string, mfaPending bool, ipAddress, userAgent string) (*models.Session, string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, token := s.createLocked(decoyUserID, nil, ipAddress, userAgent)
+	session.DecoyUsername = username
+	if mfaPending {
+		session.MFAPending = true
+		session.ExpiresAt = session.CreatedAt.Add(SessionMFATimeout)
+		session.IdleExpiresAt = session.ExpiresAt
+	}
+
+	copied := *session
+	return &copied, token
+}
+
+// CompleteMFA upgrades a pre-auth session to a full session once the second factor
+// was verified. The token and CSRF token are replaced so that nothing issued before
+// the upgrade carries the new privileges, and the session timeouts start over.
+func (s *SessionStore) CompleteMFA(sessionID string) (*models.Session, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, exists := s.sessions[s.current[sessionID]]
+	if !exists || session.IsExpired() || !session.MFAPending {
+		return nil, "", ErrSessionNotFound
 	}
 
-	s.sessions[session.ID] = session
-	return session
+	session.MFAPending = false
+	token := s.upgradeLocked(session)
+
+	copied := *session
+	return &copied, token, nil
+}
+
+// upgradeLocked gives a session that just gained privileges a new token and CSRF
+// token and restarts its timeouts. It returns the new token.
+func (s *SessionStore) upgradeLocked(session *models.Session) string {
+	delete(s.sessions, session.TokenHash)
+
+	token, tokenHash := newSessionToken()
+	now := time.Now()
+	session.TokenHash = tokenHash
+	session.CSRFToken = rand.Text()
+	session.CreatedAt = now
+	session.AuthenticatedAt = now
+	session.RotatedAt = now
+	session.LastSeenAt = now
+	session.IdleExpiresAt = now.Add(SessionIdleTimeout)
+	session.ExpiresAt = now.Add(SessionAbsoluteTimeout)
+
+	s.sessions[tokenHash] = session
+	s.current[session.ID] = tokenHash
+
+	return token
 }
 
-// FindByID finds a session by ID
+// StepUp records that the user just proved a login factor again on a session
+func (s *SessionStore) StepUp(sessionID string) (*models.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, exists := s.sessions[s.current[sessionID]]
+	if !exists || session.IsExpired() || session.MFAPending {
+		return nil, ErrSessionNotFound
+	}
+
+	session.AuthenticatedAt = time.Now()
+
+	copied := *session
+	return &copied, nil
+}
+
+// lookupLocked finds the session whose current token is token. The map is keyed by
+// the token's SHA-256 digest, so the lookup's timing depends on the digest only and
+// reveals nothing about the raw token. Callers must hold s.mu.
+func (s *SessionStore) lookupLocked(token string) (*models.Session, string, bool) {
+	tokenHash := hashSessionToken(token)
+	session, exists := s.sessions[tokenHash]
+	return session, tokenHash, exists
+}
+
+// FindByToken finds a session by its current bearer token
+func (s *SessionStore) FindByToken(token string) (*models.Session, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	session, _, exists := s.lookupLocked(token)
+	if !exists || session.IsExpired() {
+		return nil, false
+	}
+
+	copied := *session
+	return &copied, true
+}
+
+// FindByID finds a session by its stable ID
 func (s *SessionStore) FindByID(sessionID string) (*models.Session, bool) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	session, exists := s.sessions[sessionID]
-	if !exists {
+	session, exists := s.sessions[s.current[sessionID]]
+	if !exists || session.IsExpired() {
 		return nil, false
 	}
 
+	copied := *session
+	return &copied, true
+}
+
+// FindByUserID returns the unexpired sessions of a user
+func (s *SessionStore) FindByUserID(userID uuid.UUID) []*models.Session {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	sessions := make([]*models.Session, 0, len(s.userSessions[userID]))
+	for sessionID := range s.userSessions[userID] {
+		session, exists := s.sessions[s.current[sessionID]]
+		if exists && !session.IsExpired() {
+			copied := *session
+			sessions = append(sessions, &copied)
+		}
+	}
+
+	return sessions
+}
+
+// SetDeviceID links a session to the device registered during it
+func (s *SessionStore) SetDeviceID(sessionID string, deviceID uuid.UUID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if session, exists := s.sessions[s.current[sessionID]]; exists {
+		session.DeviceID = &deviceID
+	}
+}
+
+// Refresh records use of a session, sliding its idle timeout, and rotates its token when
+// the current one is older than SessionRotationInterval. The returned token is empty
+// unless it changed and the cookie must be reissued.
+// Presenting a token that was rotated out more than SessionRotationGrace ago means it
+// leaked, so the whole session is revoked and ErrSessionReused is returned.
+func (s *SessionStore) Refresh(token, ipAddress, userAgent string) (*models.Session, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+
+	session, tokenHash, exists := s.lookupLocked(token)
+	if !exists {
+		retired, wasRotated := s.retired[tokenHash]
+		if !wasRotated {
+			return nil, "", ErrSessionNotFound
+		}
+
+		current, exists := s.sessions[s.current[retired.sessionID]]
+		if !exists || current.IsExpired() {
+			return nil, "", ErrSessionNotFound
+		}
+
+		if now.Sub(retired.retiredAt) > SessionRotationGrace {
+			s.deleteLocked(retired.sessionID)
+			return nil, "", ErrSessionReused
+		}
+
+		copied := *current
+		return &copied, "", nil
+	}
+
 	if session.IsExpired() {
-		return nil, false
+		s.deleteLocked(session.ID)
+		return nil, "", ErrSessionNotFound
+	}
+
+	session.LastSeenAt = now
+	session.IPAddress = ipAddress
+	session.UserAgent = userAgent
+	session.IdleExpiresAt = now.Add(SessionIdleTimeout)
+	if session.IdleExpiresAt.After(session.ExpiresAt) {
+		session.IdleExpiresAt = session.ExpiresAt
+	}
+
+	if now.Sub(session.RotatedAt) < SessionRotationInterval {
+		copied := *session
+		return &copied, "", nil
+	}
+
+	s.retired[tokenHash] = retiredSession{
+		sessionID: session.ID,
+		retiredAt: now,
+		expiresAt: session.ExpiresAt,
+	}
+	delete(s.sessions, tokenHash)
+
+	newToken, newHash := newSessionToken()
+	session.TokenHash = newHash
+	session.RotatedAt = now
+	s.sessions[newHash] = session
+	s.current[session.ID] = newHash
+
+	copied := *session
+	return &copied, newToken, nil
+}
+
+// DeleteByToken deletes the session the given current or rotated-out token belongs to
+func (s *SessionStore) DeleteByToken(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, tokenHash, exists := s.lookupLocked(token)
+	if exists {
+		s.deleteLocked(session.ID)
+		return
+	}
+
+	if retired, exists := s.retired[tokenHash]; exists {
+		s.deleteLocked(retired.sessionID)
+	}
+}
+
+// Delete revokes a session of the given user by ID
+func (s *SessionStore) Delete(userID uuid.UUID, sessionID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.userSessions[userID][sessionID]; !exists {
+		return ErrSessionNotFound
 	}
 
-	return session, true
+	s.deleteLocked(sessionID)
+	return nil
 }
 
-// Delete deletes a session
-func (s *SessionStore) Delete(sessionID string) {
+// DeleteByDevice revokes every session of a user that is linked to deviceID and
+// returns how many were revoked
+func (s *SessionStore) DeleteByDevice(userID, deviceID uuid.UUID) int {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	delete(s.sessions, sessionID)
+	revoked := 0
+	for sessionID := range s.userSessions[userID] {
+		session, exists := s.sessions[s.current[sessionID]]
+		if exists && session.DeviceID != nil && *session.DeviceID == deviceID {
+			s.deleteLocked(sessionID)
+			revoked++
+		}
+	}
+
+	return revoked
+}
+
+// DeleteOthers revokes every session of a user except keepSessionID and returns how many were revoked
+func (s *SessionStore) DeleteOthers(userID uuid.UUID, keepSessionID string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	revoked := 0
+	for sessionID := range s.userSessions[userID] {
+		if sessionID != keepSessionID {
+			s.deleteLocked(sessionID)
+			revoked++
+		}
+	}
+
+	return revoked
+}
+
+// purgeUserLocked revokes every session of a user and returns how many there
+// were. Callers must hold s.mu.
+func (s *SessionStore) purgeUserLocked(userID uuid.UUID) int {
+	revoked := 0
+	for sessionID := range s.userSessions[userID] {
+		s.deleteLocked(sessionID)
+		revoked++
+	}
+	return revoked
+}
+
+// deleteLocked removes a session; its rotated-out tokens are kept until they
+// expire so that later reuse is still recognised. Callers must hold s.mu.
+func (s *SessionStore) deleteLocked(sessionID string) {
+	if session, exists := s.sessions[s.current[sessionID]]; exists {
+		delete(s.sessions, session.TokenHash)
+		s.unindexLocked(session.UserID, sessionID)
+	}
+	delete(s.current, sessionID)
+}
+
+// unindexLocked drops a session from the per-user index. Callers must hold s.mu.
+func (s *SessionStore) unindexLocked(userID uuid.UUID, sessionID string) {
+	delete(s.userSessions[userID], sessionID)
+	if len(s.userSessions[userID]) == 0 {
+		delete(s.userSessions, userID)
+	}
 }
 
 // CleanupExpired removes expired sessions
@@ -70,9 +473,19 @@ func (s *SessionStore) CleanupExpired() {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	for id, session := range s.sessions {
+	now := time.Now()
+
+	for tokenHash, session := range s.sessions {
 		if session.IsExpired() {
-			delete(s.sessions, id)
+			delete(s.sessions, tokenHash)
+			delete(s.current, session.ID)
+			s.unindexLocked(session.UserID, session.ID)
+		}
+	}
+
+	for tokenHash, retired := range s.retired {
+		if now.After(retired.expiresAt) {
+			delete(s.retired, tokenHash)
 		}
 	}
 }
@@ -84,7 +497,8 @@ func (s *SessionStore) GetAll() []*models.Session {
 
 	sessions := make([]*models.Session, 0, len(s.sessions))
 	for _, session := range s.sessions {
-		sessions = append(sessions, session)
+		copied := *session
+		sessions = append(sessions, &copied)
 	}
 	return sessions
 }
@@ -0,0 +1,262 @@
+package store
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/models"
+	"github.com/google/uuid"
+)
+
+const SocialRecoveryRequestDuration = 72 * time.Hour
+
+var (
+	ErrSocialRecoveryNotConfigured = errors.New("social recovery is not configured")
+	ErrSocialRecoveryNotFound      = errors.New("social recovery request not found")
+	ErrSocialRecoveryNotPending    = errors.New("social recovery request is not pending")
+	ErrNotGuardian                 = errors.New("user is not a guardian of this request")
+	ErrGuardianAlreadyResponded    = errors.New("guardian already responded")
+)
+
+// SocialRecoveryStore manages guardian-held shares and recovery requests in memory
+type SocialRecoveryStore struct {
+	mu       sync.RWMutex
+	configs  map[uuid.UUID]*models.SocialRecoveryConfig
+	requests map[uuid.UUID]*models.SocialRecoveryRequest
+}
+
+// NewSocialRecoveryStore creates a new SocialRecoveryStore
+func NewSocialRecoveryStore() *SocialRecoveryStore {
+	return &SocialRecoveryStore{
+		configs:  make(map[uuid.UUID]*models.SocialRecoveryConfig),
+		requests: make(map[uuid.UUID]*models.SocialRecoveryRequest),
+	}
+}
+
+// SaveConfig replaces a user's shares and cancels their pending requests,
+// since those were made against the old shares
+func (s *SocialRecoveryStore) SaveConfig(userID uuid.UUID, threshold int, shares []*models.GuardianShare) *models.SocialRecoveryConfig {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	config := &models.SocialRecoveryConfig{
+		UserID:    userID,
+		Threshold: threshold,
+		Shares:    shares,
+		CreatedAt: time.Now(),
+	}
+	s.configs[userID] = config
+	s.cancelPendingLocked(userID)
+
+	return config
+}
+
+// FindConfig finds a user's social recovery configuration
+func (s *SocialRecoveryStore) FindConfig(userID uuid.UUID) (*models.SocialRecoveryConfig, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	config, exists := s.configs[userID]
+	return config, exists
+}
+
+// DeleteConfig removes a user's configuration and cancels their pending requests
+func (s *SocialRecoveryStore) DeleteConfig(userID uuid.UUID) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.configs[userID]; !exists {
+		return false
+	}
+
+	delete(s.configs, userID)
+	s.cancelPendingLocked(userID)
+	return true
+}
+
+// purgeUserLocked removes a user's configuration and recovery requests. Shares the
+// user holds as a guardian of others are left in place. Callers must hold s.mu.
+func (s *SocialRecoveryStore) purgeUserLocked(userID uuid.UUID) {
+	delete(s.configs, userID)
+	for requestID, request := range s.requests {
+		if request.UserID == userID {
+			delete(s.requests, requestID)
+		}
+	}
+}
+
+// CreateRequest opens a recovery request for the requesting session, superseding any pending one
+func (s *SocialRecoveryStore) CreateRequest(userID uuid.UUID, sessionID, ephemeralPublicKey string) (*models.SocialRecoveryRequest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	config, exists := s.configs[userID]
+	if !exists {
+		return nil, ErrSocialRecoveryNotConfigured
+	}
+
+	s.cancelPendingLocked(userID)
+
+	now := time.Now()
+	request := &models.SocialRecoveryRequest{
+		ID:                 uuid.New(),
+		UserID:             userID,
+		SessionID:          sessionID,
+		EphemeralPublicKey: ephemeralPublicKey,
+		Threshold:          config.Threshold,
+		Shares:             slices.Clone(config.Shares),
+		Approvals:          make([]*models.GuardianApproval, 0),
+		Rejections:         make([]uuid.UUID, 0),
+		Status:             models.SocialRecoveryStatusPending,
+		CreatedAt:          now,
+		ExpiresAt:          now.Add(SocialRecoveryRequestDuration),
+	}
+	s.requests[request.ID] = request
+
+	return cloneSocialRecoveryRequest(request), nil
+}
+
+// FindRequest finds an unexpired recovery request by ID
+func (s *SocialRecoveryStore) FindRequest(requestID uuid.UUID) (*models.SocialRecoveryRequest, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	request, exists := s.requests[requestID]
+	if !exists || request.IsExpired() {
+		return nil, false
+	}
+
+	return cloneSocialRecoveryRequest(request), true
+}
+
+// FindPendingForGuardian returns pending requests in which the user holds a share
+func (s *SocialRecoveryStore) FindPendingForGuardian(guardianID uuid.UUID) []*models.SocialRecoveryRequest {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	requests := make([]*models.SocialRecoveryRequest, 0)
+	for _, request := range s.requests {
+		if request.Status != models.SocialRecoveryStatusPending || request.IsExpired() {
+			continue
+		}
+		if _, ok := request.ShareFor(guardianID); ok {
+			requests = append(requests, cloneSocialRecoveryRequest(request))
+		}
+	}
+	return requests
+}
+
+// Approve records a guardian's released share; reaching the threshold releases the request
+func (s *SocialRecoveryStore) Approve(requestID, guardianID uuid.UUID, releasedShare string) (*models.SocialRecoveryRequest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	request, share, err := s.guardianRequestLocked(requestID, guardianID)
+	if err != nil {
+		return nil, err
+	}
+
+	request.Approvals = append(request.Approvals, &models.GuardianApproval{
+		GuardianID:    guardianID,
+		ShareIndex:    share.Index,
+		ReleasedShare: releasedShare,
+		ApprovedAt:    time.Now(),
+	})
+
+	if len(request.Approvals) >= request.Threshold {
+		request.Status = models.SocialRecoveryStatusReleased
+	}
+
+	return cloneSocialRecoveryRequest(request), nil
+}
+
+// Reject records a guardian declining; once the threshold can no longer be met the request is rejected
+func (s *SocialRecoveryStore) Reject(requestID, guardianID uuid.UUID) (*models.SocialRecoveryRequest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	request, _, err := s.guardianRequestLocked(requestID, guardianID)
+	if err != nil {
+		return nil, err
+	}
+
+	request.Rejections = append(request.Rejections, guardianID)
+
+	if len(request.Shares)-len(request.Rejections) < request.Threshold {
+		request.Status = models.SocialRecoveryStatusRejected
+	}
+
+	return cloneSocialRecoveryRequest(request), nil
+}
+
+// Cancel cancels a pending request on behalf of its owner
+func (s *SocialRecoveryStore) Cancel(requestID, userID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	request, exists := s.requests[requestID]
+	if !exists || request.IsExpired() || request.UserID != userID {
+		return ErrSocialRecoveryNotFound
+	}
+
+	if request.Status != models.SocialRecoveryStatusPending {
+		return ErrSocialRecoveryNotPending
+	}
+
+	request.Status = models.SocialRecoveryStatusCancelled
+	return nil
+}
+
+// CleanupExpired removes expired requests
+func (s *SocialRecoveryStore) CleanupExpired() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, request := range s.requests {
+		if request.IsExpired() {
+			delete(s.requests, id)
+		}
+	}
+}
+
+func (s *SocialRecoveryStore) guardianRequestLocked(requestID, guardianID uuid.UUID) (*models.SocialRecoveryRequest, *models.GuardianShare, error) {
+	request, exists := s.requests[requestID]
+	if !exists || request.IsExpired() {
+		return nil, nil, ErrSocialRecoveryNotFound
+	}
+
+	share, ok := request.ShareFor(guardianID)
+	if !ok {
+		return nil, nil, ErrNotGuardian
+	}
+
+	if request.Status != models.SocialRecoveryStatusPending {
+		return nil, nil, ErrSocialRecoveryNotPending
+	}
+
+	if slices.Contains(request.Rejections, guardianID) || slices.ContainsFunc(request.Approvals, func(approval *models.GuardianApproval) bool {
+		return approval.GuardianID == guardianID
+	}) {
+		return nil, nil, ErrGuardianAlreadyResponded
+	}
+
+	return request, share, nil
+}
+
+func (s *SocialRecoveryStore) cancelPendingLocked(userID uuid.UUID) {
+	for _, request := range s.requests {
+		if request.UserID == userID && request.Status == models.SocialRecoveryStatusPending {
+			request.Status = models.SocialRecoveryStatusCancelled
+		}
+	}
+}
+
+func cloneSocialRecoveryRequest(request *models.SocialRecoveryRequest) *models.SocialRecoveryRequest {
+	copied := *request
+	copied.Shares = slices.Clone(request.Shares)
+	copied.Approvals = slices.Clone(request.Approvals)
+	copied.Rejections = slices.Clone(request.Rejections)
+	return &copied
+}
@@ -0,0 +1,201 @@
+package store
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/models"
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/totp"
+	"github.com/google/uuid"
+)
+
+// TOTPEnrollmentDuration is how long an unconfirmed enrollment waits for its first code
+const TOTPEnrollmentDuration = 10 * time.Minute
+
+var (
+	ErrTOTPNotEnabled     = errors.New("two-factor authentication is not enabled")
+	ErrTOTPAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrTOTPNotPending     = errors.New("no pending two-factor enrollment")
+	ErrTOTPInvalidCode    = errors.New("invalid two-factor code")
+)
+
+// TOTPStore manages TOTP enrollments and backup codes in memory, one per user
+type TOTPStore struct {
+	mu          sync.Mutex
+	enrollments map[uuid.UUID]*models.TOTPEnrollment
+}
+
+// NewTOTPStore creates a new TOTPStore
+func NewTOTPStore() *TOTPStore {
+	return &TOTPStore{
+		enrollments: make(map[uuid.UUID]*models.TOTPEnrollment),
+	}
+}
+
+// Begin starts an enrollment with a fresh secret, replacing any unconfirmed one
+func (s *TOTPStore) Begin(userID uuid.UUID) (*models.TOTPEnrollment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, exists := s.enrollments[userID]; exists && existing.IsConfirmed() {
+		return nil, ErrTOTPAlreadyEnabled
+	}
+
+	enrollment := &models.TOTPEnrollment{
+		UserID:    userID,
+		Secret:    totp.GenerateSecret(),
+		CreatedAt: time.Now(),
+	}
+
+	s.enrollments[userID] = enrollment
+	return enrollment, nil
+}
+
+// Find returns a user's enrollment, confirmed or not
+func (s *TOTPStore) Find(userID uuid.UUID) (*models.TOTPEnrollment, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	enrollment, exists := s.enrollments[userID]
+	return enrollment, exists
+}
+
+// IsEnabled reports whether a user has a confirmed enrollment
+func (s *TOTPStore) IsEnabled(userID uuid.UUID) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	enrollment, exists := s.enrollments[userID]
+	return exists && enrollment.IsConfirmed()
+}
+
+// Confirm enables a pending enrollment once code proves the authenticator holds its
+// secret, and stores the backup codes issued with it
+func (s *TOTPStore) Confirm(userID uuid.UUID, code string, backupCodes []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	enrollment, exists := s.enrollments[userID]
+	if !exists {
+		return ErrTOTPNotPending
+	}
+	if enrollment.IsConfirmed() {
+		return ErrTOTPAlreadyEnabled
+	}
+	if time.Since(enrollment.CreatedAt) > TOTPEnrollmentDuration {
+		return ErrTOTPNotPending
+	}
+
+	counter, ok := totp.Validate(enrollment.Secret, normalizeTOTPCode(code), time.Now())
+	if !ok {
+		return ErrTOTPInvalidCode
+	}
+
+	now := time.Now()
+	enrollment.ConfirmedAt = &now
+	enrollment.LastCounter = counter
+	enrollment.BackupCodes = newTOTPBackupCodes(backupCodes)
+
+	return nil
+}
+
+// Verify checks a TOTP code or an unused backup code for a confirmed enrollment.
+// Accepted codes are consumed: backup codes are marked used and TOTP codes from
+// the same or an earlier time step are rejected afterwards. It reports whether a
+// backup code was used.
+func (s *TOTPStore) Verify(userID uuid.UUID, code string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	enrollment, exists := s.enrollments[userID]
+	if !exists || !enrollment.IsConfirmed() {
+		return false, ErrTOTPNotEnabled
+	}
+
+	code = normalizeTOTPCode(code)
+	if len(code) == totp.Digits {
+		counter, ok := totp.Validate(enrollment.Secret, code, time.Now())
+		if !ok || counter <= enrollment.LastCounter {
+			return false, ErrTOTPInvalidCode
+		}
+
+		enrollment.LastCounter = counter
+		return false, nil
+	}
+
+	codeHash := hashTOTPBackupCode(code)
+	for _, backupCode := range enrollment.BackupCodes {
+		if backupCode.UsedAt == nil && subtle.ConstantTimeCompare([]byte(backupCode.CodeHash), []byte(codeHash)) == 1 {
+			now := time.Now()
+			backupCode.UsedAt = &now
+			return true, nil
+		}
+	}
+
+	return false, ErrTOTPInvalidCode
+}
+
+// ReplaceBackupCodes discards a user's backup codes and stores a fresh set
+func (s *TOTPStore) ReplaceBackupCodes(userID uuid.UUID, backupCodes []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	enrollment, exists := s.enrollments[userID]
+	if !exists || !enrollment.IsConfirmed() {
+		return ErrTOTPNotEnabled
+	}
+
+	enrollment.BackupCodes = newTOTPBackupCodes(backupCodes)
+	return nil
+}
+
+// Disable removes a user's enrollment together with its backup codes
+func (s *TOTPStore) Disable(userID uuid.UUID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.enrollments, userID)
+}
+
+// purgeUserLocked removes a user's enrollment. Callers must hold s.mu.
+func (s *TOTPStore) purgeUserLocked(userID uuid.UUID) {
+	delete(s.enrollments, userID)
+}
+
+// CleanupExpired removes enrollments that were never confirmed
+func (s *TOTPStore) CleanupExpired() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for userID, enrollment := range s.enrollments {
+		if !enrollment.IsConfirmed() && time.Since(enrollment.CreatedAt) > TOTPEnrollmentDuration {
+			delete(s.enrollments, userID)
+		}
+	}
+}
+
+func newTOTPBackupCodes(codes []string) []*models.TOTPBackupCode {
+	backupCodes := make([]*models.TOTPBackupCode, 0, len(codes))
+	for _, code := range codes {
+		backupCodes = append(backupCodes, &models.TOTPBackupCode{
+			CodeHash: hashTOTPBackupCode(normalizeTOTPCode(code)),
+		})
+	}
+	return backupCodes
+}
+
+// normalizeTOTPCode drops the separators users type or copy along with codes
+func normalizeTOTPCode(code string) string {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+func hashTOTPBackupCode(code string) string {
+	digest := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(digest[:])
+}
@@ -1,39 +1,95 @@
 package store
 
 import (
+	"errors"
 	"sync"
+	"time"
 
 	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/models"
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/username"
 	"github.com/google/uuid"
 )
 
-// UserStore manages users in memory
+const (
+	// UsernameCooldown keeps a name given up in a rename reserved for its previous owner
+	UsernameCooldown = 30 * 24 * time.Hour
+	// UsernameChangeInterval is the minimum time between two renames of one account
+	UsernameChangeInterval = 24 * time.Hour
+)
+
+var (
+	ErrUserNotFound            = errors.New("user not found")
+	ErrUsernameTaken           = errors.New("username already exists")
+	ErrUsernameChangeTooSoon   = errors.New("username was changed too recently")
+	ErrRecoveryVersionConflict = errors.New("recovery payload was changed concurrently")
+	ErrNoRecoveryRollback      = errors.New("no recovery payload to roll back to")
+)
+
+// retiredUsername is a name given up in a rename, reserved for its previous owner
+type retiredUsername struct {
+	userID uuid.UUID
+	until  time.Time
+}
+
+// UserStore manages users in memory. Usernames are stored folded, and
+// usernameToIDMap and retiredUsernames are keyed by their confusable skeleton so
+// that look-alike names cannot belong to different accounts. Users are only
+// changed under mu, so every method returns copies.
 type UserStore struct {
-	mu              sync.RWMutex
-	users           map[uuid.UUID]*models.User
-	usernameToIDMap map[string]uuid.UUID
+	mu                 sync.RWMutex
+	users              map[uuid.UUID]*models.User
+	usernameToIDMap    map[string]uuid.UUID
+	retiredUsernames   map[string]retiredUsername
+	oidcSubjectToIDMap map[string]uuid.UUID
 }
 
 // NewUserStore creates a new UserStore
 func NewUserStore() *UserStore {
 	return &UserStore{
-		users:           make(map[uuid.UUID]*models.User),
-		usernameToIDMap: make(map[string]uuid.UUID),
+		users:              make(map[uuid.UUID]*models.User),
+		usernameToIDMap:    make(map[string]uuid.UUID),
+		retiredUsernames:   make(map[string]retiredUsername),
+		oidcSubjectToIDMap: make(map[string]uuid.UUID),
 	}
 }
 
-// FindByUsername finds a user by username
-func (s *UserStore) FindByUsername(username string) (*models.User, bool) {
+// oidcSubjectKey identifies a provider account; subjects are only unique per issuer
+func oidcSubjectKey(issuer, subject string) string {
+	return issuer + "\x00" + subject
+}
+
+// FindByUsername finds a user by username. The name is folded first, but a
+// look-alike of a username does not find its user.
+func (s *UserStore) FindByUsername(name string) (*models.User, bool) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	userID, exists := s.usernameToIDMap[username]
+	name = username.Fold(name)
+	userID, exists := s.usernameToIDMap[username.Skeleton(name)]
 	if !exists {
 		return nil, false
 	}
 
 	user, exists := s.users[userID]
-	return user, exists
+	if !exists || user.Username != name {
+		return nil, false
+	}
+
+	copied := *user
+	return &copied, true
+}
+
+// availableLocked reports whether name is free for userID: not in use by another
+// user and not retired by another user within the cooldown. Callers must hold s.mu.
+func (s *UserStore) availableLocked(userID uuid.UUID, name string) bool {
+	key := username.Skeleton(name)
+	if ownerID, exists := s.usernameToIDMap[key]; exists && ownerID != userID {
+		return false
+	}
+	if retired, exists := s.retiredUsernames[key]; exists && retired.userID != userID && time.Now().Before(retired.until) {
+		return false
+	}
+	return true
 }
 
 // FindByID finds a user by ID
@@ -42,27 +98,162 @@ func (s *UserStore) FindByID(id uuid.UUID) (*models.User, bool) {
 	defer s.mu.RUnlock()
 
 	user, exists := s.users[id]
-	return user, exists
+	if !exists {
+		return nil, false
+	}
+
+	copied := *user
+	return &copied, true
 }
 
 // Create creates a new user
-func (s *UserStore) Create(username string) *models.User {
+func (s *UserStore) Create(name string) *models.User {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	user := &models.User{
 		ID:       uuid.New(),
-		Username: username,
+		Username: username.Fold(name),
+	}
+
+	s.users[user.ID] = user
+	s.usernameToIDMap[username.Skeleton(user.Username)] = user.ID
+
+	copied := *user
+	return &copied
+}
+
+// Claim creates a user with a pre-assigned ID, failing if the username is taken
+func (s *UserStore) Claim(userID uuid.UUID, name string) (*models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	name = username.Fold(name)
+	if !s.availableLocked(userID, name) {
+		return nil, ErrUsernameTaken
+	}
+
+	user := &models.User{
+		ID:       userID,
+		Username: name,
 	}
 
 	s.users[user.ID] = user
-	s.usernameToIDMap[username] = user.ID
+	s.usernameToIDMap[username.Skeleton(name)] = user.ID
+
+	copied := *user
+	return &copied, nil
+}
+
+// Rename changes a user's username. The old name stays reserved for the user for
+// UsernameCooldown, and a user may rename once per UsernameChangeInterval.
+func (s *UserStore) Rename(userID uuid.UUID, name string) (*models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	return user
+	user, exists := s.users[userID]
+	if !exists {
+		return nil, ErrUserNotFound
+	}
+
+	name = username.Fold(name)
+	if name == user.Username {
+		copied := *user
+		return &copied, nil
+	}
+
+	now := time.Now()
+	if user.UsernameChangedAt != nil && now.Sub(*user.UsernameChangedAt) < UsernameChangeInterval {
+		return nil, ErrUsernameChangeTooSoon
+	}
+
+	if !s.availableLocked(userID, name) {
+		return nil, ErrUsernameTaken
+	}
+
+	oldKey, newKey := username.Skeleton(user.Username), username.Skeleton(name)
+	if oldKey != newKey {
+		delete(s.usernameToIDMap, oldKey)
+		s.retiredUsernames[oldKey] = retiredUsername{userID: userID, until: now.Add(UsernameCooldown)}
+	}
+	delete(s.retiredUsernames, newKey)
+	s.usernameToIDMap[newKey] = userID
+
+	user.Username = name
+	user.UsernameChangedAt = &now
+
+	copied := *user
+	return &copied, nil
+}
+
+// deleteLocked removes a user and frees their username and provider link.
+// Callers must hold s.mu.
+func (s *UserStore) deleteLocked(userID uuid.UUID) bool {
+	user, exists := s.users[userID]
+	if !exists {
+		return false
+	}
+
+	delete(s.users, userID)
+	delete(s.usernameToIDMap, username.Skeleton(user.Username))
+	if user.OIDCSubject != "" {
+		delete(s.oidcSubjectToIDMap, oidcSubjectKey(user.OIDCIssuer, user.OIDCSubject))
+	}
+	return true
+}
+
+// FindByOIDCSubject finds the user linked to a provider account
+func (s *UserStore) FindByOIDCSubject(issuer, subject string) (*models.User, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	userID, exists := s.oidcSubjectToIDMap[oidcSubjectKey(issuer, subject)]
+	if !exists {
+		return nil, false
+	}
+
+	user, exists := s.users[userID]
+	if !exists {
+		return nil, false
+	}
+
+	copied := *user
+	return &copied, true
+}
+
+// CreateOIDCUser creates a user linked to a provider account, failing if the username is taken.
+// If a concurrent sign-in already linked the account, that user is returned instead.
+func (s *UserStore) CreateOIDCUser(name, issuer, subject string) (*models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if userID, linked := s.oidcSubjectToIDMap[oidcSubjectKey(issuer, subject)]; linked {
+		copied := *s.users[userID]
+		return &copied, nil
+	}
+
+	name = username.Fold(name)
+	if !s.availableLocked(uuid.Nil, name) {
+		return nil, ErrUsernameTaken
+	}
+
+	user := &models.User{
+		ID:          uuid.New(),
+		Username:    name,
+		OIDCIssuer:  issuer,
+		OIDCSubject: subject,
+	}
+
+	s.users[user.ID] = user
+	s.usernameToIDMap[username.Skeleton(name)] = user.ID
+	s.oidcSubjectToIDMap[oidcSubjectKey(issuer, subject)] = user.ID
+
+	copied := *user
+	return &copied, nil
 }
 
 // UpdateRecoveryData stores the user's passphrase-based recovery payload
-func (s *UserStore) UpdateRecoveryData(userID uuid.UUID, wrappedUMK, salt, iv string) (*models.User, bool) {
+func (s *UserStore) UpdateRecoveryData(userID uuid.UUID, wrappedUMK, salt, iv string, kdf models.KDFDescriptor) (*models.User, bool) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -74,17 +265,140 @@ func (s *UserStore) UpdateRecoveryData(userID uuid.UUID, wrappedUMK, salt, iv st
 	user.RecoveryWrappedUMK = wrappedUMK
 	user.RecoverySalt = salt
 	user.RecoveryIV = iv
+	user.RecoveryKDF = &kdf
+	user.RecoveryVersion++
+	user.RecoveryUpdatedAt = time.Now()
+
+	copied := *user
+	return &copied, true
+}
+
+// SetRecoveryAuthKey stores the passphrase-derived key that gates recovery payload release
+func (s *UserStore) SetRecoveryAuthKey(userID uuid.UUID, authKey string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, exists := s.users[userID]
+	if !exists {
+		return false
+	}
+
+	user.RecoveryAuthKey = authKey
+	return true
+}
+
+// SetUMKVerifier stores the key the user proves possession of the UMK with
+func (s *UserStore) SetUMKVerifier(userID uuid.UUID, verifier string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, exists := s.users[userID]
+	if !exists {
+		return false
+	}
+
+	user.UMKVerifier = verifier
+	return true
+}
 
-	return user, true
+// RotateRecoveryData replaces the recovery payload if it is still at expectedVersion,
+// keeping the replaced payload so the rotation can be rolled back
+func (s *UserStore) RotateRecoveryData(userID uuid.UUID, expectedVersion int, wrappedUMK, salt, iv, authKey string, kdf models.KDFDescriptor) (*models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, exists := s.users[userID]
+	if !exists {
+		return nil, ErrUserNotFound
+	}
+
+	if user.RecoveryVersion != expectedVersion {
+		return nil, ErrRecoveryVersionConflict
+	}
+
+	now := time.Now()
+	user.PreviousRecovery = &models.RecoverySnapshot{
+		WrappedUMK: user.RecoveryWrappedUMK,
+		Salt:       user.RecoverySalt,
+		IV:         user.RecoveryIV,
+		AuthKey:    user.RecoveryAuthKey,
+		KDF:        user.RecoveryKDF,
+		Version:    user.RecoveryVersion,
+		ReplacedAt: now,
+	}
+	user.RecoveryWrappedUMK = wrappedUMK
+	user.RecoverySalt = salt
+	user.RecoveryIV = iv
+	user.RecoveryAuthKey = authKey
+	user.RecoveryKDF = &kdf
+	user.RecoveryVersion++
+	user.RecoveryUpdatedAt = now
+
+	copied := *user
+	return &copied, nil
+}
+
+// RollbackRecoveryData restores the previous recovery payload if it was replaced within window.
+// The restored payload gets a new version number so clients never see a version go backwards.
+func (s *UserStore) RollbackRecoveryData(userID uuid.UUID, window time.Duration) (*models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, exists := s.users[userID]
+	if !exists {
+		return nil, ErrUserNotFound
+	}
+
+	previous := user.PreviousRecovery
+	if previous == nil || time.Since(previous.ReplacedAt) > window {
+		return nil, ErrNoRecoveryRollback
+	}
+
+	user.RecoveryWrappedUMK = previous.WrappedUMK
+	user.RecoverySalt = previous.Salt
+	user.RecoveryIV = previous.IV
+	user.RecoveryAuthKey = previous.AuthKey
+	user.RecoveryKDF = previous.KDF
+	user.RecoveryVersion++
+	user.RecoveryUpdatedAt = time.Now()
+	user.PreviousRecovery = nil
+
+	copied := *user
+	return &copied, nil
+}
+
+// ExpireRecoveryRollbacks drops previous recovery payloads older than window
+func (s *UserStore) ExpireRecoveryRollbacks(window time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, user := range s.users {
+		if user.PreviousRecovery != nil && time.Since(user.PreviousRecovery.ReplacedAt) > window {
+			user.PreviousRecovery = nil
+		}
+	}
+}
+
+// CleanupExpired frees retired usernames whose cooldown has ended
+func (s *UserStore) CleanupExpired() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for key, retired := range s.retiredUsernames {
+		if now.After(retired.until) {
+			delete(s.retiredUsernames, key)
+		}
+	}
 }
 
 // GetOrCreate finds a user by username or creates a new one
-func (s *UserStore) GetOrCreate(username string) *models.User {
-	user, exists := s.FindByUsername(username)
+func (s *UserStore) GetOrCreate(name string) *models.User {
+	user, exists := s.FindByUsername(name)
 	if exists {
 		return user
 	}
-	return s.Create(username)
+	return s.Create(name)
 }
 
 // GetAll returns all users
@@ -94,7 +408,8 @@ func (s *UserStore) GetAll() []*models.User {
 
 	users := make([]*models.User, 0, len(s.users))
 	for _, user := range s.users {
-		users = append(users, user)
+		copied := *user
+		users = append(users, &copied)
 	}
 	return users
 }
@@ -0,0 +1,149 @@
+// Package username canonicalizes and validates account names. Names are compared
+// after Fold, which applies NFKC and Unicode case folding, and two names collide
+// when their confusable skeletons match, so "Alice", "ａｌｉｃｅ" and "аlice" with a
+// Cyrillic а cannot belong to different accounts.
+package username
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Character sets a Policy can allow. Both permit the separators in Separators,
+// but never at the start or end of a name.
+const (
+	// CharsetASCII allows a-z and 0-9
+	CharsetASCII = "ascii"
+	// CharsetUnicode allows letters, digits and combining marks of any script
+	CharsetUnicode = "unicode"
+)
+
+// Separators are the punctuation characters allowed inside usernames
+const Separators = "._-"
+
+var (
+	ErrInvalidLength    = errors.New("invalid username length")
+	ErrInvalidCharacter = errors.New("invalid character in username")
+	ErrReserved         = errors.New("username is reserved")
+)
+
+// DefaultReserved lists names that could be mistaken for the service or its staff
+var DefaultReserved = []string{
+	"admin", "administrator", "root", "system", "support", "help", "security",
+	"api", "www", "mail", "official", "staff", "moderator", "null", "undefined",
+	"anonymous", "me", "self",
+}
+
+// Policy decides which names are acceptable for new accounts and renames
+type Policy struct {
+	MinLength int
+	MaxLength int
+	Charset   string
+	Reserved  []string
+}
+
+// DefaultPolicy accepts 3 to 32 ASCII letters, digits and separators
+var DefaultPolicy = Policy{
+	MinLength: 3,
+	MaxLength: 32,
+	Charset:   CharsetASCII,
+	Reserved:  DefaultReserved,
+}
+
+// Check reports whether the policy itself is usable
+func (p Policy) Check() error {
+	if p.MinLength < 1 || p.MaxLength < p.MinLength {
+		return fmt.Errorf("username lengths %d to %d are not a valid range", p.MinLength, p.MaxLength)
+	}
+	if p.Charset != CharsetASCII && p.Charset != CharsetUnicode {
+		return fmt.Errorf("unknown username charset %q", p.Charset)
+	}
+	return nil
+}
+
+// Normalize folds raw and checks it against the policy, returning the name to store
+func (p Policy) Normalize(raw string) (string, error) {
+	name := Fold(raw)
+
+	if length := utf8.RuneCountInString(name); length < p.MinLength || length > p.MaxLength {
+		return "", fmt.Errorf("%w: must be between %d and %d characters", ErrInvalidLength, p.MinLength, p.MaxLength)
+	}
+
+	for i, r := range name {
+		if strings.ContainsRune(Separators, r) {
+			if i == 0 || i+utf8.RuneLen(r) == len(name) {
+				return "", fmt.Errorf("%w: %q may not start or end it", ErrInvalidCharacter, r)
+			}
+			continue
+		}
+		if !p.allows(r) {
+			return "", fmt.Errorf("%w: %q", ErrInvalidCharacter, r)
+		}
+	}
+
+	skeleton := Skeleton(name)
+	if slices.ContainsFunc(p.Reserved, func(reserved string) bool { return Skeleton(Fold(reserved)) == skeleton }) {
+		return "", ErrReserved
+	}
+
+	return name, nil
+}
+
+func (p Policy) allows(r rune) bool {
+	if p.Charset == CharsetUnicode {
+		return unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r)
+	}
+	return ('a' <= r && r <= 'z') || ('0' <= r && r <= '9')
+}
+
+// Fold returns the canonical form of a name: trimmed, NFKC normalized and case
+// folded. Folding can undo normalization, so NFKC is applied again afterwards.
+func Fold(name string) string {
+	name = norm.NFKC.String(strings.TrimSpace(name))
+	return norm.NFKC.String(cases.Fold().String(name))
+}
+
+// Skeleton maps a folded name to a representative of the names that look like it,
+// after Unicode TR39: combining marks are dropped and common look-alike letters,
+// digits and letter pairs are replaced with one Latin form. Names with the same
+// skeleton are treated as the same name.
+func Skeleton(name string) string {
+	var b strings.Builder
+	for _, r := range norm.NFD.String(name) {
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+		if mapped, ok := confusables[r]; ok {
+			b.WriteRune(mapped)
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return confusablePairs.Replace(b.String())
+}
+
+// confusables maps characters to the Latin letter they are mistaken for. Input is
+// already folded, so only lowercase forms are listed.
+var confusables = map[rune]rune{
+	// Digits and symbols
+	'0': 'o', '1': 'l', '|': 'l', 'ı': 'i', 'ℓ': 'l',
+	// Cyrillic
+	'а': 'a', 'в': 'b', 'ԁ': 'd', 'е': 'e', 'һ': 'h', 'і': 'i', 'ј': 'j', 'к': 'k',
+	'ӏ': 'l', 'м': 'm', 'н': 'h', 'о': 'o', 'р': 'p', 'ԛ': 'q', 'ѕ': 's', 'т': 't',
+	'у': 'y', 'ԝ': 'w', 'х': 'x', 'ь': 'b', 'ү': 'y',
+	// Greek
+	'α': 'a', 'β': 'b', 'ε': 'e', 'η': 'n', 'ι': 'i', 'κ': 'k', 'ν': 'v', 'ο': 'o',
+	'ρ': 'p', 'τ': 't', 'υ': 'u', 'χ': 'x', 'γ': 'y',
+	// Armenian
+	'օ': 'o', 'ս': 'u', 'հ': 'h', 'ո': 'n',
+}
+
+// confusablePairs replaces letter pairs that render like a single letter
+var confusablePairs = strings.NewReplacer("rn", "m", "vv", "w", "cl", "d")
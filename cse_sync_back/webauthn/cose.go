@@ -0,0 +1,139 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// COSE algorithm identifiers accepted for credential public keys
+const (
+	AlgES256 int64 = -7
+	AlgEdDSA int64 = -8
+	AlgRS256 int64 = -257
+)
+
+// SupportedAlgorithms lists the algorithms offered in pubKeyCredParams, in order of preference
+var SupportedAlgorithms = []int64{AlgES256, AlgEdDSA, AlgRS256}
+
+const (
+	coseKeyKty = 1
+	coseKeyAlg = 3
+	coseKeyCrv = -1
+	coseKeyX   = -2
+	coseKeyY   = -3
+	coseKeyN   = -1
+	coseKeyE   = -2
+
+	coseKtyOKP = 1
+	coseKtyEC2 = 2
+	coseKtyRSA = 3
+
+	coseCrvP256    = 1
+	coseCrvEd25519 = 6
+)
+
+// VerifySignature checks sig over data using a COSE_Key encoded credential public key
+func VerifySignature(coseKey, data, sig []byte) error {
+	raw, _, err := decodeCBOR(coseKey)
+	if err != nil {
+		return fmt.Errorf("invalid public key: %w", err)
+	}
+
+	key, ok := raw.(map[any]any)
+	if !ok {
+		return errors.New("invalid public key: not a map")
+	}
+
+	kty, _ := key[int64(coseKeyKty)].(int64)
+	alg, _ := key[int64(coseKeyAlg)].(int64)
+
+	switch {
+	case kty == coseKtyEC2 && alg == AlgES256:
+		crv, _ := key[int64(coseKeyCrv)].(int64)
+		x, _ := key[int64(coseKeyX)].([]byte)
+		y, _ := key[int64(coseKeyY)].([]byte)
+		if crv != coseCrvP256 || len(x) != 32 || len(y) != 32 {
+			return errors.New("invalid public key: malformed EC2 key")
+		}
+
+		pub := &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return errors.New("invalid public key: point not on curve")
+		}
+
+		digest := sha256.Sum256(data)
+		if !ecdsa.VerifyASN1(pub, digest[:], sig) {
+			return errors.New("signature verification failed")
+		}
+		return nil
+
+	case kty == coseKtyOKP && alg == AlgEdDSA:
+		crv, _ := key[int64(coseKeyCrv)].(int64)
+		x, _ := key[int64(coseKeyX)].([]byte)
+		if crv != coseCrvEd25519 || len(x) != ed25519.PublicKeySize {
+			return errors.New("invalid public key: malformed OKP key")
+		}
+
+		if !ed25519.Verify(ed25519.PublicKey(x), data, sig) {
+			return errors.New("signature verification failed")
+		}
+		return nil
+
+	case kty == coseKtyRSA && alg == AlgRS256:
+		n, _ := key[int64(coseKeyN)].([]byte)
+		e, _ := key[int64(coseKeyE)].([]byte)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return errors.New("invalid public key: malformed RSA key")
+		}
+
+		exponent := 0
+		for _, b := range e {
+			exponent = exponent<<8 | int(b)
+		}
+		pub := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: exponent}
+
+		digest := sha256.Sum256(data)
+		if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig); err != nil {
+			return errors.New("signature verification failed")
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unsupported public key type (kty %d, alg %d)", kty, alg)
+}
+
+// checkPublicKey ensures a COSE_Key uses one of the supported algorithms
+func checkPublicKey(coseKey []byte) (int64, error) {
+	raw, n, err := decodeCBOR(coseKey)
+	if err != nil {
+		return 0, fmt.Errorf("invalid public key: %w", err)
+	}
+	if n != len(coseKey) {
+		return 0, errors.New("invalid public key: trailing data")
+	}
+
+	key, ok := raw.(map[any]any)
+	if !ok {
+		return 0, errors.New("invalid public key: not a map")
+	}
+
+	alg, _ := key[int64(coseKeyAlg)].(int64)
+	for _, supported := range SupportedAlgorithms {
+		if alg == supported {
+			return alg, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unsupported public key algorithm %d", alg)
+}
@@ -0,0 +1,403 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	challengeLength = 32
+
+	flagUserPresent      = 0x01
+	flagUserVerified     = 0x04
+	flagAttestedCredData = 0x40
+
+	ceremonyCreate = "webauthn.create"
+	ceremonyGet    = "webauthn.get"
+)
+
+// RelyingParty describes this server as a WebAuthn relying party
+type RelyingParty struct {
+	ID      string
+	Name    string
+	Origins []string
+	Timeout time.Duration
+}
+
+// RelyingPartyEntity is the rp member of the creation options
+type RelyingPartyEntity struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// UserEntity is the user member of the creation options
+type UserEntity struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+// CredentialParameter is a single pubKeyCredParams entry
+type CredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int64  `json:"alg"`
+}
+
+// CredentialDescriptor identifies an existing credential for exclude/allow lists
+type CredentialDescriptor struct {
+	Type       string   `json:"type"`
+	ID         string   `json:"id"`
+	Transports []string `json:"transports,omitempty"`
+}
+
+// AuthenticatorSelection is the authenticatorSelection member of the creation options
+type AuthenticatorSelection struct {
+	ResidentKey      string `json:"residentKey"`
+	UserVerification string `json:"userVerification"`
+}
+
+// CreationOptions mirrors PublicKeyCredentialCreationOptionsJSON
+type CreationOptions struct {
+	RP                     RelyingPartyEntity     `json:"rp"`
+	User                   UserEntity             `json:"user"`
+	Challenge              string                 `json:"challenge"`
+	PubKeyCredParams       []CredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation"`
+}
+
+// RequestOptions mirrors PublicKeyCredentialRequestOptionsJSON
+type RequestOptions struct {
+	Challenge        string                 `json:"challenge"`
+	Timeout          int64                  `json:"timeout"`
+	RPID             string                 `json:"rpId"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+// AttestationResponse mirrors RegistrationResponseJSON as produced by PublicKeyCredential.toJSON()
+type AttestationResponse struct {
+	ID       string `json:"id"`
+	RawID    string `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string   `json:"clientDataJSON"`
+		AttestationObject string   `json:"attestationObject"`
+		Transports        []string `json:"transports,omitempty"`
+	} `json:"response"`
+}
+
+// AssertionResponse mirrors AuthenticationResponseJSON as produced by PublicKeyCredential.toJSON()
+type AssertionResponse struct {
+	ID       string `json:"id"`
+	RawID    string `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string `json:"clientDataJSON"`
+		AuthenticatorData string `json:"authenticatorData"`
+		Signature         string `json:"signature"`
+		UserHandle        string `json:"userHandle,omitempty"`
+	} `json:"response"`
+}
+
+// AuthenticatorData is the parsed authenticator data structure
+type AuthenticatorData struct {
+	RPIDHash     []byte
+	Flags        byte
+	SignCount    uint32
+	AAGUID       []byte
+	CredentialID []byte
+	PublicKey    []byte
+}
+
+// UserPresent reports whether the UP flag is set
+func (a *AuthenticatorData) UserPresent() bool {
+	return a.Flags&flagUserPresent != 0
+}
+
+// UserVerified reports whether the UV flag is set
+func (a *AuthenticatorData) UserVerified() bool {
+	return a.Flags&flagUserVerified != 0
+}
+
+type clientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+// NewChallenge returns a fresh base64url encoded challenge
+func NewChallenge() string {
+	b := make([]byte, challengeLength)
+	rand.Read(b)
+	return EncodeBase64URL(b)
+}
+
+// EncodeBase64URL encodes b the way browsers serialize WebAuthn buffers
+func EncodeBase64URL(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodeBase64URL decodes unpadded or padded base64url
+func DecodeBase64URL(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+// CreationOptions builds registration options for a user
+func (rp *RelyingParty) CreationOptions(challenge string, user UserEntity, exclude []CredentialDescriptor) CreationOptions {
+	params := make([]CredentialParameter, 0, len(SupportedAlgorithms))
+	for _, alg := range SupportedAlgorithms {
+		params = append(params, CredentialParameter{Type: "public-key", Alg: alg})
+	}
+
+	if exclude == nil {
+		exclude = []CredentialDescriptor{}
+	}
+
+	return CreationOptions{
+		RP:                 RelyingPartyEntity{ID: rp.ID, Name: rp.Name},
+		User:               user,
+		Challenge:          challenge,
+		PubKeyCredParams:   params,
+		Timeout:            rp.Timeout.Milliseconds(),
+		ExcludeCredentials: exclude,
+		AuthenticatorSelection: AuthenticatorSelection{
+			ResidentKey:      "preferred",
+			UserVerification: "preferred",
+		},
+		Attestation: "none",
+	}
+}
+
+// RequestOptions builds authentication options, optionally restricted to known credentials
+func (rp *RelyingParty) RequestOptions(challenge string, allow []CredentialDescriptor) RequestOptions {
+	if allow == nil {
+		allow = []CredentialDescriptor{}
+	}
+
+	return RequestOptions{
+		Challenge:        challenge,
+		Timeout:          rp.Timeout.Milliseconds(),
+		RPID:             rp.ID,
+		AllowCredentials: allow,
+		UserVerification: "preferred",
+	}
+}
+
+// ChallengeFromClientData extracts the challenge so the pending ceremony can be looked up
+func ChallengeFromClientData(clientDataJSON string) (string, error) {
+	raw, err := DecodeBase64URL(clientDataJSON)
+	if err != nil {
+		return "", errors.New("invalid clientDataJSON encoding")
+	}
+
+	var cd clientData
+	if err := json.Unmarshal(raw, &cd); err != nil {
+		return "", errors.New("invalid clientDataJSON")
+	}
+	if cd.Challenge == "" {
+		return "", errors.New("clientDataJSON has no challenge")
+	}
+
+	return cd.Challenge, nil
+}
+
+// VerifyRegistration validates an attestation response against the expected challenge
+// and returns the authenticator data holding the new credential.
+// Attestation conveyance is "none", so the attestation statement itself is not trusted.
+func (rp *RelyingParty) VerifyRegistration(resp *AttestationResponse, challenge string) (*AuthenticatorData, error) {
+	if resp.Type != "public-key" {
+		return nil, errors.New("unexpected credential type")
+	}
+
+	if _, err := rp.verifyClientData(resp.Response.ClientDataJSON, ceremonyCreate, challenge); err != nil {
+		return nil, err
+	}
+
+	attObjRaw, err := DecodeBase64URL(resp.Response.AttestationObject)
+	if err != nil {
+		return nil, errors.New("invalid attestationObject encoding")
+	}
+
+	decoded, n, err := decodeCBOR(attObjRaw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid attestationObject: %w", err)
+	}
+	if n != len(attObjRaw) {
+		return nil, errors.New("invalid attestationObject: trailing data")
+	}
+
+	attObj, ok := decoded.(map[any]any)
+	if !ok {
+		return nil, errors.New("invalid attestationObject")
+	}
+	if _, ok := attObj["fmt"].(string); !ok {
+		return nil, errors.New("attestationObject has no fmt")
+	}
+	authDataRaw, ok := attObj["authData"].([]byte)
+	if !ok {
+		return nil, errors.New("attestationObject has no authData")
+	}
+
+	authData, err := ParseAuthenticatorData(authDataRaw)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := rp.checkAuthenticatorData(authData); err != nil {
+		return nil, err
+	}
+
+	if authData.CredentialID == nil {
+		return nil, errors.New("authenticator data has no attested credential")
+	}
+
+	if _, err := checkPublicKey(authData.PublicKey); err != nil {
+		return nil, err
+	}
+
+	rawID, err := DecodeBase64URL(resp.RawID)
+	if err != nil || !bytes.Equal(rawID, authData.CredentialID) {
+		return nil, errors.New("credential id mismatch")
+	}
+
+	return authData, nil
+}
+
+// VerifyAssertion validates an assertion response against the expected challenge and the
+// stored COSE public key of the credential. Sign count handling is left to the caller.
+func (rp *RelyingParty) VerifyAssertion(resp *AssertionResponse, challenge string, publicKey []byte) (*AuthenticatorData, error) {
+	if resp.Type != "public-key" {
+		return nil, errors.New("unexpected credential type")
+	}
+
+	clientDataRaw, err := rp.verifyClientData(resp.Response.ClientDataJSON, ceremonyGet, challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	authDataRaw, err := DecodeBase64URL(resp.Response.AuthenticatorData)
+	if err != nil {
+		return nil, errors.New("invalid authenticatorData encoding")
+	}
+
+	authData, err := ParseAuthenticatorData(authDataRaw)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := rp.checkAuthenticatorData(authData); err != nil {
+		return nil, err
+	}
+
+	sig, err := DecodeBase64URL(resp.Response.Signature)
+	if err != nil {
+		return nil, errors.New("invalid signature encoding")
+	}
+
+	clientDataHash := sha256.Sum256(clientDataRaw)
+	signed := make([]byte, 0, len(authDataRaw)+len(clientDataHash))
+	signed = append(signed, authDataRaw...)
+	signed = append(signed, clientDataHash[:]...)
+
+	if err := VerifySignature(publicKey, signed, sig); err != nil {
+		return nil, err
+	}
+
+	return authData, nil
+}
+
+// ParseAuthenticatorData parses the binary authenticator data structure
+func ParseAuthenticatorData(b []byte) (*AuthenticatorData, error) {
+	if len(b) < 37 {
+		return nil, errors.New("authenticator data too short")
+	}
+
+	authData := &AuthenticatorData{
+		RPIDHash:  b[:32],
+		Flags:     b[32],
+		SignCount: binary.BigEndian.Uint32(b[33:37]),
+	}
+
+	rest := b[37:]
+	if authData.Flags&flagAttestedCredData != 0 {
+		if len(rest) < 18 {
+			return nil, errors.New("attested credential data too short")
+		}
+		authData.AAGUID = rest[:16]
+		idLen := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if idLen == 0 || idLen > 1023 || len(rest) < idLen {
+			return nil, errors.New("invalid credential id length")
+		}
+		authData.CredentialID = rest[:idLen]
+		rest = rest[idLen:]
+
+		_, n, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, fmt.Errorf("invalid credential public key: %w", err)
+		}
+		authData.PublicKey = rest[:n]
+		rest = rest[n:]
+	}
+
+	// Any remaining bytes are the extensions map, which is not used here.
+	if len(rest) > 0 {
+		if _, _, err := decodeCBOR(rest); err != nil {
+			return nil, fmt.Errorf("invalid extensions: %w", err)
+		}
+	}
+
+	return authData, nil
+}
+
+func (rp *RelyingParty) verifyClientData(encoded, ceremony, challenge string) ([]byte, error) {
+	raw, err := DecodeBase64URL(encoded)
+	if err != nil {
+		return nil, errors.New("invalid clientDataJSON encoding")
+	}
+
+	var cd clientData
+	if err := json.Unmarshal(raw, &cd); err != nil {
+		return nil, errors.New("invalid clientDataJSON")
+	}
+
+	if cd.Type != ceremony {
+		return nil, errors.New("unexpected ceremony type")
+	}
+
+	if subtle.ConstantTimeCompare([]byte(strings.TrimRight(cd.Challenge, "=")), []byte(challenge)) != 1 {
+		return nil, errors.New("challenge mismatch")
+	}
+
+	if !slices.Contains(rp.Origins, cd.Origin) {
+		return nil, errors.New("origin not allowed")
+	}
+
+	return raw, nil
+}
+
+func (rp *RelyingParty) checkAuthenticatorData(authData *AuthenticatorData) error {
+	expected := sha256.Sum256([]byte(rp.ID))
+	if subtle.ConstantTimeCompare(authData.RPIDHash, expected[:]) != 1 {
+		return errors.New("rp id hash mismatch")
+	}
+
+	if !authData.UserPresent() {
+		return errors.New("user presence flag not set")
+	}
+
+	return nil
+}
@@ -0,0 +1,138 @@
+package webauthn_test
+
+import (
+	"bytes"
+	"cmp"
+	"testing"
+
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/webauthn"
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/webauthn/webauthntest"
+)
+
+func TestVerifyRegistration(t *testing.T) {
+	rp := webauthntest.RelyingParty()
+	a := webauthntest.NewAuthenticator(t)
+	challenge := webauthn.NewChallenge()
+
+	authData, err := rp.VerifyRegistration(a.Attest(challenge, webauthntest.Ceremony{}), challenge)
+	if err != nil {
+		t.Fatalf("VerifyRegistration: %v", err)
+	}
+
+	if !bytes.Equal(authData.CredentialID, a.CredentialID) {
+		t.Errorf("credential id = %x, want %x", authData.CredentialID, a.CredentialID)
+	}
+	if !bytes.Equal(authData.PublicKey, a.COSEKey()) {
+		t.Error("public key does not match the authenticator's")
+	}
+	if !authData.UserPresent() || !authData.UserVerified() {
+		t.Errorf("flags = %#x, want UP and UV", authData.Flags)
+	}
+}
+
+func TestVerifyRegistrationRejects(t *testing.T) {
+	rp := webauthntest.RelyingParty()
+	a := webauthntest.NewAuthenticator(t)
+	challenge := webauthn.NewChallenge()
+
+	tests := []struct {
+		name      string
+		challenge string
+		ceremony  webauthntest.Ceremony
+		tamper    func(*webauthn.AttestationResponse)
+	}{
+		{name: "wrong origin", ceremony: webauthntest.Ceremony{Origin: "https://evil.example"}},
+		{name: "wrong challenge", challenge: webauthn.NewChallenge()},
+		{name: "wrong rp id hash", ceremony: webauthntest.Ceremony{RPID: "evil.example"}},
+		{name: "missing user presence", ceremony: webauthntest.Ceremony{Flags: webauthntest.FlagUV}},
+		{
+			name: "credential id mismatch",
+			tamper: func(resp *webauthn.AttestationResponse) {
+				resp.RawID = webauthn.EncodeBase64URL([]byte("another credential"))
+			},
+		},
+		{
+			name: "assertion client data",
+			tamper: func(resp *webauthn.AttestationResponse) {
+				clientData := webauthntest.ClientDataJSON("webauthn.get", challenge, webauthntest.Origin)
+				resp.Response.ClientDataJSON = webauthn.EncodeBase64URL(clientData)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := a.Attest(cmp.Or(tt.challenge, challenge), tt.ceremony)
+			if tt.tamper != nil {
+				tt.tamper(resp)
+			}
+
+			if _, err := rp.VerifyRegistration(resp, challenge); err == nil {
+				t.Fatal("VerifyRegistration succeeded, want error")
+			}
+		})
+	}
+}
+
+func TestVerifyAssertion(t *testing.T) {
+	rp := webauthntest.RelyingParty()
+	a := webauthntest.NewAuthenticator(t)
+	a.SignCount = 7
+	challenge := webauthn.NewChallenge()
+
+	authData, err := rp.VerifyAssertion(a.Assert(t, challenge, webauthntest.Ceremony{}), challenge, a.COSEKey())
+	if err != nil {
+		t.Fatalf("VerifyAssertion: %v", err)
+	}
+
+	if authData.SignCount != 7 {
+		t.Errorf("sign count = %d, want 7", authData.SignCount)
+	}
+}
+
+func TestVerifyAssertionRejects(t *testing.T) {
+	rp := webauthntest.RelyingParty()
+	a := webauthntest.NewAuthenticator(t)
+	other := webauthntest.NewAuthenticator(t)
+	challenge := webauthn.NewChallenge()
+
+	tests := []struct {
+		name      string
+		challenge string
+		ceremony  webauthntest.Ceremony
+		publicKey []byte
+		tamper    func(*webauthn.AssertionResponse)
+	}{
+		{name: "wrong origin", ceremony: webauthntest.Ceremony{Origin: "https://evil.example"}},
+		{name: "wrong challenge", challenge: webauthn.NewChallenge()},
+		{name: "wrong rp id hash", ceremony: webauthntest.Ceremony{RPID: "evil.example"}},
+		{name: "missing user presence", ceremony: webauthntest.Ceremony{Flags: webauthntest.FlagUV}},
+		{name: "other credential's key", publicKey: other.COSEKey()},
+		{
+			name: "tampered authenticator data",
+			tamper: func(resp *webauthn.AssertionResponse) {
+				raw, _ := webauthn.DecodeBase64URL(resp.Response.AuthenticatorData)
+				raw[len(raw)-1]++
+				resp.Response.AuthenticatorData = webauthn.EncodeBase64URL(raw)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := a.Assert(t, cmp.Or(tt.challenge, challenge), tt.ceremony)
+			if tt.tamper != nil {
+				tt.tamper(resp)
+			}
+
+			publicKey := a.COSEKey()
+			if tt.publicKey != nil {
+				publicKey = tt.publicKey
+			}
+
+			if _, err := rp.VerifyAssertion(resp, challenge, publicKey); err == nil {
+				t.Fatal("VerifyAssertion succeeded, want error")
+			}
+		})
+	}
+}
@@ -0,0 +1,218 @@
+// Package webauthntest provides a software authenticator for tests of passkey ceremonies
+package webauthntest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/KasumiMercury/cse_sync_poc/cse_sync_back/webauthn"
+)
+
+const (
+	// RPID and Origin are the relying party the authenticator answers by default
+	RPID   = "localhost"
+	Origin = "http://localhost:5173"
+
+	FlagUP byte = 0x01
+	FlagUV byte = 0x04
+	flagAT byte = 0x40
+)
+
+// RelyingParty returns a relying party for RPID served from Origin
+func RelyingParty() *webauthn.RelyingParty {
+	return &webauthn.RelyingParty{
+		ID:      RPID,
+		Name:    "CSE Sync",
+		Origins: []string{Origin},
+		Timeout: time.Minute,
+	}
+}
+
+// Authenticator is a software ECDSA P-256 authenticator. It answers the way a
+// platform authenticator would, except that every input a relying party checks can
+// be chosen by the test.
+type Authenticator struct {
+	Key          *ecdsa.PrivateKey
+	CredentialID []byte
+	UserHandle   []byte
+	SignCount    uint32
+}
+
+// NewAuthenticator returns an authenticator holding a new credential
+func NewAuthenticator(t testing.TB) *Authenticator {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	credentialID := make([]byte, 16)
+	rand.Read(credentialID)
+
+	return &Authenticator{Key: key, CredentialID: credentialID}
+}
+
+// Ceremony is what an authenticator response is built from; a zero value field
+// takes the value a well-behaved client would send
+type Ceremony struct {
+	RPID   string
+	Origin string
+	Flags  byte
+}
+
+func (c Ceremony) withDefaults() Ceremony {
+	if c.RPID == "" {
+		c.RPID = RPID
+	}
+	if c.Origin == "" {
+		c.Origin = Origin
+	}
+	if c.Flags == 0 {
+		c.Flags = FlagUP | FlagUV
+	}
+	return c
+}
+
+// COSEKey returns the credential public key as stored by the relying party
+func (a *Authenticator) COSEKey() []byte {
+	x := make([]byte, 32)
+	y := make([]byte, 32)
+	a.Key.X.FillBytes(x)
+	a.Key.Y.FillBytes(y)
+
+	return cborMap(
+		cborInt(1), cborInt(2), // kty: EC2
+		cborInt(3), cborInt(webauthn.AlgES256),
+		cborInt(-1), cborInt(1), // crv: P-256
+		cborInt(-2), cborBytes(x),
+		cborInt(-3), cborBytes(y),
+	)
+}
+
+func (a *Authenticator) authenticatorData(cer Ceremony, attested bool) []byte {
+	rpIDHash := sha256.Sum256([]byte(cer.RPID))
+
+	data := append([]byte{}, rpIDHash[:]...)
+	flags := cer.Flags
+	if attested {
+		flags |= flagAT
+	}
+	data = append(data, flags)
+	data = binary.BigEndian.AppendUint32(data, a.SignCount)
+
+	if attested {
+		data = append(data, make([]byte, 16)...) // AAGUID
+		data = binary.BigEndian.AppendUint16(data, uint16(len(a.CredentialID)))
+		data = append(data, a.CredentialID...)
+		data = append(data, a.COSEKey()...)
+	}
+
+	return data
+}
+
+// ClientDataJSON returns the client data a browser collects for a ceremony
+func ClientDataJSON(ceremonyType, challenge, origin string) []byte {
+	raw, _ := json.Marshal(map[string]string{
+		"type":      ceremonyType,
+		"challenge": challenge,
+		"origin":    origin,
+	})
+	return raw
+}
+
+// Attest answers navigator.credentials.create with "none" attestation
+func (a *Authenticator) Attest(challenge string, cer Ceremony) *webauthn.AttestationResponse {
+	cer = cer.withDefaults()
+
+	attestationObject := cborMap(
+		cborText("fmt"), cborText("none"),
+		cborText("attStmt"), cborMap(),
+		cborText("authData"), cborBytes(a.authenticatorData(cer, true)),
+	)
+
+	resp := &webauthn.AttestationResponse{
+		ID:    webauthn.EncodeBase64URL(a.CredentialID),
+		RawID: webauthn.EncodeBase64URL(a.CredentialID),
+		Type:  "public-key",
+	}
+	resp.Response.ClientDataJSON = webauthn.EncodeBase64URL(ClientDataJSON("webauthn.create", challenge, cer.Origin))
+	resp.Response.AttestationObject = webauthn.EncodeBase64URL(attestationObject)
+
+	return resp
+}
+
+// Assert answers navigator.credentials.get, signing with the current sign count
+func (a *Authenticator) Assert(t testing.TB, challenge string, cer Ceremony) *webauthn.AssertionResponse {
+	t.Helper()
+	cer = cer.withDefaults()
+
+	authData := a.authenticatorData(cer, false)
+	clientData := ClientDataJSON("webauthn.get", challenge, cer.Origin)
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+
+	sig, err := ecdsa.SignASN1(rand.Reader, a.Key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp := &webauthn.AssertionResponse{
+		ID:    webauthn.EncodeBase64URL(a.CredentialID),
+		RawID: webauthn.EncodeBase64URL(a.CredentialID),
+		Type:  "public-key",
+	}
+	resp.Response.ClientDataJSON = webauthn.EncodeBase64URL(clientData)
+	resp.Response.AuthenticatorData = webauthn.EncodeBase64URL(authData)
+	resp.Response.Signature = webauthn.EncodeBase64URL(sig)
+	if a.UserHandle != nil {
+		resp.Response.UserHandle = webauthn.EncodeBase64URL(a.UserHandle)
+	}
+
+	return resp
+}
+
+// Minimal canonical CBOR encoding, enough for attestation objects and COSE keys
+
+func cborHead(major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return []byte{major<<5 | byte(n)}
+	case n <= 0xff:
+		return []byte{major<<5 | 24, byte(n)}
+	case n <= 0xffff:
+		return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32([]byte{major<<5 | 26}, uint32(n))
+	}
+}
+
+func cborInt(v int64) []byte {
+	if v < 0 {
+		return cborHead(1, uint64(-1-v))
+	}
+	return cborHead(0, uint64(v))
+}
+
+func cborBytes(b []byte) []byte {
+	return append(cborHead(2, uint64(len(b))), b...)
+}
+
+func cborText(s string) []byte {
+	return append(cborHead(3, uint64(len(s))), s...)
+}
+
+// cborMap encodes alternating keys and values
+func cborMap(items ...[]byte) []byte {
+	encoded := cborHead(5, uint64(len(items)/2))
+	for _, item := range items {
+		encoded = append(encoded, item...)
+	}
+	return encoded
+}
@@ -1,56 +1,118 @@
 import { API_BASE_URL } from "../../../shared/constants/api";
-import type { PassphraseRecoveryPayload } from "../../../shared/crypto/keyManagement";
-import type { DeviceInfo, DeviceRegistrationResponse } from "../types/device";
+import {
+  csrfHeaders,
+  setCSRFToken,
+} from "../../../shared/storage/csrfToken";
+import {
+  type PassphraseRecoveryPayload,
+  signUMKChallenge,
+} from "../../../shared/crypto/keyManagement";
+import { proofOfWorkHeaders } from "../../../shared/crypto/proofOfWork";
 import type {
+  AccountDeletion,
+  UsernameChangeResponse,
+} from "../types/account";
+import type {
+  DeviceInfo,
+  DeviceRegistrationResponse,
+  DeviceWrap,
+} from "../types/device";
+import type {
+  ActiveSession,
   LoginRequest,
   LoginResponse,
   RegisterInitRequest,
   RegisterInitResponse,
   RegisterRequest,
+  RegistrationMode,
+  RegistrationModeResponse,
   RegisterResponse,
   SessionInfo,
+  StepUpBeginResponse,
+  StepUpMethod,
+  StepUpRequest,
+  StepUpStatus,
 } from "../types/session";
+import type { TOTPEnrollment, TOTPStatus } from "../types/totp";
+
+export async function getRegistrationMode(): Promise<RegistrationMode> {
+  const response = await fetch(`${API_BASE_URL}/register/mode`, {
+    credentials: "include",
+  });
+
+  if (!response.ok) {
+    throw new Error("Failed to get registration mode");
+  }
+
+  const result: RegistrationModeResponse = await response.json();
+  return result.mode;
+}
 
 export async function registerInit(
   username: string,
+  inviteToken?: string,
 ): Promise<RegisterInitResponse> {
   const response = await fetch(`${API_BASE_URL}/register/init`, {
     method: "POST",
     headers: {
       "Content-Type": "application/json",
+      ...(await proofOfWorkHeaders()),
     },
     credentials: "include",
-    body: JSON.stringify({ username } as RegisterInitRequest),
+    body: JSON.stringify({
+      username,
+      invite_token: inviteToken,
+    } as RegisterInitRequest),
   });
 
   if (!response.ok) {
+    if (response.status === 400) {
+      const body = await response.json().catch(() => null);
+      throw new Error(body?.message ?? "Invalid username");
+    }
+    if (response.status === 403) {
+      const body = await response.json().catch(() => null);
+      throw new Error(body?.message ?? "Registration is not available");
+    }
     if (response.status === 409) {
       throw new Error("Username already exists");
     }
+    if (response.status === 429) {
+      throw new Error("Too many attempts, try again later");
+    }
     throw new Error("Failed to initialize registration");
   }
 
-  return response.json();
+  const result: RegisterInitResponse = await response.json();
+  setCSRFToken(result.csrf_token);
+  return result;
 }
 
 export async function registerFinalize(
   wrappedUMK: string,
   recovery: PassphraseRecoveryPayload,
+  umkVerifier: string,
 ): Promise<RegisterResponse> {
   const response = await fetch(`${API_BASE_URL}/register`, {
     method: "POST",
     headers: {
       "Content-Type": "application/json",
+      ...csrfHeaders(),
     },
     credentials: "include",
     body: JSON.stringify({
       wrapped_umk: wrappedUMK,
       recovery,
+      umk_verifier: umkVerifier,
     } as RegisterRequest),
   });
 
   if (!response.ok) {
     if (response.status === 409) {
+      const body = await response.json().catch(() => null);
+      if (body?.message === "registration already completed") {
+        throw new Error("Registration already completed. Please log in.");
+      }
       throw new Error("Username already exists");
     }
     if (response.status === 401) {
@@ -62,7 +124,9 @@ export async function registerFinalize(
     throw new Error("Registration failed");
   }
 
-  return response.json();
+  const result: RegisterResponse = await response.json();
+  setCSRFToken(result.csrf_token);
+  return result;
 }
 
 export async function login(
@@ -78,18 +142,160 @@ export async function login(
     method: "POST",
     headers: {
       "Content-Type": "application/json",
+      ...(await proofOfWorkHeaders()),
     },
     credentials: "include",
     body: JSON.stringify(payload),
   });
 
   if (!response.ok) {
+    if (response.status === 429) {
+      throw new Error("Too many attempts, try again later");
+    }
     throw new Error("Login failed");
   }
 
+  const result: LoginResponse = await response.json();
+  setCSRFToken(result.csrf_token);
+  return result;
+}
+
+export async function verifyLoginTOTP(code: string): Promise<LoginResponse> {
+  const response = await fetch(`${API_BASE_URL}/login/totp`, {
+    method: "POST",
+    headers: {
+      "Content-Type": "application/json",
+      ...csrfHeaders(),
+    },
+    credentials: "include",
+    body: JSON.stringify({ code }),
+  });
+
+  if (!response.ok) {
+    if (response.status === 429) {
+      throw new Error("Too many attempts, try again later");
+    }
+    throw new Error("Invalid two-factor code");
+  }
+
+  const result: LoginResponse = await response.json();
+  setCSRFToken(result.csrf_token);
+  return result;
+}
+
+export async function getTOTPStatus(): Promise<TOTPStatus> {
+  const response = await fetch(`${API_BASE_URL}/totp`, {
+    method: "GET",
+    credentials: "include",
+  });
+
+  if (!response.ok) {
+    throw new Error("Failed to fetch two-factor status");
+  }
+
+  return response.json();
+}
+
+export async function enrollTOTP(): Promise<TOTPEnrollment> {
+  const response = await fetch(`${API_BASE_URL}/totp/enroll`, {
+    method: "POST",
+    headers: csrfHeaders(),
+    credentials: "include",
+  });
+
+  if (!response.ok) {
+    throw new Error("Failed to start two-factor enrollment");
+  }
+
   return response.json();
 }
 
+async function postTOTPCode(path: string, code: string): Promise<Response> {
+  const response = await fetch(`${API_BASE_URL}${path}`, {
+    method: "POST",
+    headers: {
+      "Content-Type": "application/json",
+      ...csrfHeaders(),
+    },
+    credentials: "include",
+    body: JSON.stringify({ code }),
+  });
+
+  if (!response.ok) {
+    if (response.status === 429) {
+      throw new Error("Too many attempts, try again later");
+    }
+    throw new Error("Invalid two-factor code");
+  }
+
+  return response;
+}
+
+export async function confirmTOTP(code: string): Promise<string[]> {
+  const response = await postTOTPCode("/totp/confirm", code);
+  const result: { backup_codes: string[] } = await response.json();
+  return result.backup_codes;
+}
+
+export async function disableTOTP(code: string): Promise<void> {
+  await postTOTPCode("/totp/disable", code);
+}
+
+export async function regenerateTOTPBackupCodes(
+  code: string,
+): Promise<string[]> {
+  const response = await postTOTPCode("/totp/backup-codes", code);
+  const result: { backup_codes: string[] } = await response.json();
+  return result.backup_codes;
+}
+
+export async function beginOIDCLogin(): Promise<string> {
+  const response = await fetch(`${API_BASE_URL}/oidc/begin`, {
+    method: "POST",
+    credentials: "include",
+  });
+
+  if (!response.ok) {
+    throw new Error("Single sign-on is not available");
+  }
+
+  const result: { authorization_url: string } = await response.json();
+  return result.authorization_url;
+}
+
+export async function finishOIDCLogin(
+  code: string,
+  state: string,
+  deviceId?: string,
+  inviteToken?: string,
+): Promise<LoginResponse> {
+  const response = await fetch(`${API_BASE_URL}/oidc/finish`, {
+    method: "POST",
+    headers: {
+      "Content-Type": "application/json",
+    },
+    credentials: "include",
+    body: JSON.stringify({
+      code,
+      state,
+      device_id: deviceId,
+      invite_token: inviteToken,
+    }),
+  });
+
+  if (!response.ok) {
+    if (response.status === 403) {
+      const body = await response.json().catch(() => null);
+      throw new Error(body?.message ?? "Registration is not available");
+    }
+    throw new Error("Single sign-on failed");
+  }
+
+  const result: LoginResponse = await response.json();
+  setCSRFToken(result.csrf_token);
+  return result;
+}
+
 export async function registerDevice(
   wrappedUMK: string,
 ): Promise<DeviceRegistrationResponse> {
@@ -97,12 +303,16 @@ export async function registerDevice(
     method: "POST",
     headers: {
       "Content-Type": "application/json",
+      ...csrfHeaders(),
     },
     credentials: "include",
     body: JSON.stringify({ wrapped_umk: wrappedUMK }),
   });
 
   if (!response.ok) {
+    if (await isReauthRequired(response)) {
+      throw new Error("Please verify it's you again before adding a device");
+    }
     throw new Error("Device registration failed");
   }
 
@@ -121,6 +331,9 @@ export async function getRecovery(): Promise<PassphraseRecoveryPayload> {
         "Recovery data not found. Complete passphrase setup on another device.",
       );
     }
+    if (await isReauthRequired(response)) {
+      throw new Error("Please verify it's you again to fetch recovery data");
+    }
     throw new Error("Failed to fetch recovery data");
   }
 
@@ -137,18 +350,63 @@ export async function getSession(): Promise<SessionInfo> {
     throw new Error("Session not found");
   }
 
+  const result: SessionInfo = await response.json();
+  setCSRFToken(result.csrf_token);
+  return result;
+}
+
+export async function listSessions(): Promise<ActiveSession[]> {
+  const response = await fetch(`${API_BASE_URL}/sessions`, {
+    method: "GET",
+    credentials: "include",
+  });
+
+  if (!response.ok) {
+    throw new Error("Failed to fetch sessions");
+  }
+
   return response.json();
 }
 
+export async function revokeSession(sessionId: string): Promise<void> {
+  const response = await fetch(`${API_BASE_URL}/sessions/${sessionId}`, {
+    method: "DELETE",
+    headers: csrfHeaders(),
+    credentials: "include",
+  });
+
+  if (!response.ok) {
+    throw new Error("Failed to revoke session");
+  }
+}
+
+export async function revokeOtherSessions(): Promise<number> {
+  const response = await fetch(`${API_BASE_URL}/sessions/revoke-others`, {
+    method: "POST",
+    headers: csrfHeaders(),
+    credentials: "include",
+  });
+
+  if (!response.ok) {
+    throw new Error("Failed to sign out other sessions");
+  }
+
+  const result: { revoked: number } = await response.json();
+  return result.revoked;
+}
+
 export async function logout(): Promise<void> {
   const response = await fetch(`${API_BASE_URL}/logout`, {
     method: "POST",
+    headers: csrfHeaders(),
     credentials: "include",
   });
 
   if (!response.ok) {
     throw new Error("Logout failed");
   }
+
+  setCSRFToken(null);
 }
 
 export async function getDevice(deviceId: string): Promise<DeviceInfo> {
@@ -171,3 +429,224 @@ export async function getDevice(deviceId: string): Promise<DeviceInfo> {
   console.log("Device fetched successfully:", deviceId);
   return deviceInfo;
 }
+
+export async function updateDeviceWrappedUMK(
+  deviceId: string,
+  wrappedUMK: string,
+  wrap: DeviceWrap,
+): Promise<DeviceInfo> {
+  const response = await fetch(
+    `${API_BASE_URL}/devices/${deviceId}/wrapped-umk`,
+    {
+      method: "PUT",
+      headers: {
+        "Content-Type": "application/json",
+        ...csrfHeaders(),
+      },
+      credentials: "include",
+      body: JSON.stringify({ wrapped_umk: wrappedUMK, wrap }),
+    },
+  );
+
+  if (!response.ok) {
+    if (response.status === 409) {
+      throw new Error("Device key epoch is out of date");
+    }
+    throw new Error("Failed to update wrapped UMK");
+  }
+
+  return response.json();
+}
+
+// isReauthRequired reports whether a failed response asks for a step-up
+async function isReauthRequired(response: Response): Promise<boolean> {
+  if (response.status !== 403) {
+    return false;
+  }
+  const body: { error?: string } | null = await response
+    .clone()
+    .json()
+    .catch(() => null);
+  return body?.error === "reauth_required";
+}
+
+export async function getStepUpStatus(): Promise<StepUpStatus> {
+  const response = await fetch(`${API_BASE_URL}/session/step-up`, {
+    method: "GET",
+    credentials: "include",
+  });
+
+  if (!response.ok) {
+    throw new Error("Failed to fetch step-up status");
+  }
+
+  return response.json();
+}
+
+export async function beginStepUp(
+  method: StepUpMethod,
+): Promise<StepUpBeginResponse> {
+  const response = await fetch(`${API_BASE_URL}/session/step-up/begin`, {
+    method: "POST",
+    headers: {
+      "Content-Type": "application/json",
+      ...csrfHeaders(),
+    },
+    credentials: "include",
+    body: JSON.stringify({ method }),
+  });
+
+  if (!response.ok) {
+    throw new Error("Failed to start verification");
+  }
+
+  return response.json();
+}
+
+export async function stepUp(request: StepUpRequest): Promise<string> {
+  const response = await fetch(`${API_BASE_URL}/session/step-up`, {
+    method: "POST",
+    headers: {
+      "Content-Type": "application/json",
+      ...csrfHeaders(),
+    },
+    credentials: "include",
+    body: JSON.stringify(request),
+  });
+
+  if (!response.ok) {
+    if (response.status === 429) {
+      throw new Error("Too many attempts, try again later");
+    }
+    throw new Error("Verification failed");
+  }
+
+  const result: { authenticated_at: string } = await response.json();
+  return result.authenticated_at;
+}
+
+// Steps up with the unlocked UMK, the factor every account has
+export async function stepUpWithUMK(
+  umk: Uint8Array,
+  userId: string,
+): Promise<string> {
+  const begin = await beginStepUp("umk");
+  if (!begin.challenge_id || !begin.challenge) {
+    throw new Error("Failed to start verification");
+  }
+
+  const proof = await signUMKChallenge(umk, begin.challenge, userId);
+  return stepUp({
+    method: "umk",
+    challenge_id: begin.challenge_id,
+    proof,
+  });
+}
+
+export async function revokeDevice(deviceId: string): Promise<number> {
+  const response = await fetch(`${API_BASE_URL}/devices/${deviceId}`, {
+    method: "DELETE",
+    headers: csrfHeaders(),
+    credentials: "include",
+  });
+
+  if (!response.ok) {
+    if (await isReauthRequired(response)) {
+      throw new Error("Please verify it's you again before removing a device");
+    }
+    throw new Error("Failed to remove device");
+  }
+
+  const result: { revoked_sessions: number } = await response.json();
+  return result.revoked_sessions;
+}
+
+export async function deleteAccount(
+  graceDays?: number,
+): Promise<AccountDeletion> {
+  const response = await fetch(`${API_BASE_URL}/account`, {
+    method: "DELETE",
+    headers: {
+      "Content-Type": "application/json",
+      ...csrfHeaders(),
+    },
+    credentials: "include",
+    body: JSON.stringify({ grace_days: graceDays ?? 0 }),
+  });
+
+  if (!response.ok) {
+    if (await isReauthRequired(response)) {
+      throw new Error("Please verify it's you again before deleting your account");
+    }
+    if (response.status === 409) {
+      throw new Error("Account deletion is already scheduled");
+    }
+    throw new Error("Failed to delete account");
+  }
+
+  return response.json();
+}
+
+export async function getAccountDeletion(): Promise<AccountDeletion | null> {
+  const response = await fetch(`${API_BASE_URL}/account/deletion`, {
+    method: "GET",
+    credentials: "include",
+  });
+
+  if (response.status === 404) {
+    return null;
+  }
+
+  if (!response.ok) {
+    throw new Error("Failed to fetch account deletion");
+  }
+
+  return response.json();
+}
+
+export async function cancelAccountDeletion(): Promise<AccountDeletion> {
+  const response = await fetch(`${API_BASE_URL}/account/deletion/cancel`, {
+    method: "POST",
+    headers: csrfHeaders(),
+    credentials: "include",
+  });
+
+  if (!response.ok) {
+    throw new Error("Failed to cancel account deletion");
+  }
+
+  return response.json();
+}
+
+export async function changeUsername(
+  username: string,
+): Promise<UsernameChangeResponse> {
+  const response = await fetch(`${API_BASE_URL}/account/username`, {
+    method: "PUT",
+    headers: {
+      "Content-Type": "application/json",
+      ...csrfHeaders(),
+    },
+    credentials: "include",
+    body: JSON.stringify({ username }),
+  });
+
+  if (!response.ok) {
+    if (await isReauthRequired(response)) {
+      throw new Error("Please verify it's you again before changing your username");
+    }
+    if (response.status === 400) {
+      const body = await response.json().catch(() => null);
+      throw new Error(body?.message ?? "Invalid username");
+    }
+    if (response.status === 409) {
+      throw new Error("Username is not available");
+    }
+    if (response.status === 429) {
+      throw new Error("Username was changed too recently");
+    }
+    throw new Error("Failed to change username");
+  }
+
+  return response.json();
+}
@@ -4,6 +4,7 @@ import {
   buildLocalKEKKeyName,
   buildUMKWrapAAD,
   createPassphraseRecoveryPayload,
+  deriveUMKVerifier,
   generateLocalKEK,
   generateUMK,
   recoverUMKWithPassphrase,
@@ -32,7 +33,10 @@ import {
   registerDevice,
   registerFinalize,
   registerInit,
+  stepUpWithUMK,
+  verifyLoginTOTP,
 } from "../api/authApi";
+import type { LoginResponse } from "../types/session";
 
 interface LoginFormProps {
   onLoginSuccess: () => void;
@@ -59,8 +63,12 @@ export function LoginForm({ onLoginSuccess, onShowDebug }: LoginFormProps) {
   const [newDeviceError, setNewDeviceError] = useState("");
   const [newDeviceContext, setNewDeviceContext] =
     useState<NewDeviceContext | null>(null);
+  const [isTOTPModalOpen, setIsTOTPModalOpen] = useState(false);
+  const [totpCode, setTOTPCode] = useState("");
+  const [totpError, setTOTPError] = useState("");
   const [debugOfflineEnabled, setDebugOfflineEnabled] = useState(false);
   const usernameId = useId();
+  const totpCodeId = useId();
   const passphraseId = useId();
   const passphraseConfirmId = useId();
   const newDevicePassphraseId = useId();
@@ -90,9 +98,66 @@ export function LoginForm({ onLoginSuccess, onShowDebug }: LoginFormProps) {
     setSuccessMessage("");
 
     try {
-      const storedDeviceId = getDeviceId();
-      const response = await login(username, storedDeviceId ?? undefined);
+      const response = await login(username, getDeviceId() ?? undefined);
 
+      if (response.mfa_required) {
+        setTOTPCode("");
+        setTOTPError("");
+        setIsTOTPModalOpen(true);
+        return;
+      }
+
+      await completeLogin(response);
+    } catch (err) {
+      const errorMessage =
+        err instanceof Error ? err.message : "Login failed. Please try again.";
+      setError(errorMessage);
+      console.error(err);
+    } finally {
+      setIsLoading(false);
+    }
+  };
+
+  const handleTOTPModalClose = () => {
+    if (isLoading) {
+      return;
+    }
+    setIsTOTPModalOpen(false);
+    setTOTPCode("");
+    setTOTPError("");
+  };
+
+  const handleTOTPSubmit = async (e: React.FormEvent<HTMLFormElement>) => {
+    e.preventDefault();
+
+    if (!totpCode.trim()) {
+      setTOTPError("Code is required");
+      return;
+    }
+
+    setIsLoading(true);
+    setTOTPError("");
+
+    try {
+      const response = await verifyLoginTOTP(totpCode.trim());
+      setIsTOTPModalOpen(false);
+      setTOTPCode("");
+      await completeLogin(response);
+    } catch (err) {
+      const message =
+        err instanceof Error ? err.message : "Verification failed.";
+      setTOTPError(message);
+      console.error(err);
+    } finally {
+      setIsLoading(false);
+    }
+  };
+
+  // completeLogin unlocks the UMK on this device once the session is fully authenticated
+  const completeLogin = async (response: LoginResponse) => {
+    const storedDeviceId = getDeviceId();
+
+    try {
       if (response.requires_device_registration) {
         if (storedDeviceId) {
           clearDeviceId();
@@ -159,8 +224,6 @@ export function LoginForm({ onLoginSuccess, onShowDebug }: LoginFormProps) {
         err instanceof Error ? err.message : "Login failed. Please try again.";
       setError(errorMessage);
       console.error(err);
-    } finally {
-      setIsLoading(false);
     }
   };
 
@@ -237,12 +300,16 @@ export function LoginForm({ onLoginSuccess, onShowDebug }: LoginFormProps) {
       );
       console.log("Recovery payload generated for passphrase-based restore");
 
+      const umkVerifier = await deriveUMKVerifier(umk);
+      console.log("UMK verifier derived");
+
       storeUMK(umk);
       console.log("UMK stored locally for active session");
 
       const completeResponse = await registerFinalize(
         wrappedUMK,
         recoveryPayload,
+        umkVerifier,
       );
       console.log(
         "Registration finalized, Device ID:",
@@ -362,6 +429,10 @@ export function LoginForm({ onLoginSuccess, onShowDebug }: LoginFormProps) {
       const wrappedUMK = await wrapUMK(umk, localKEK, wrapAAD);
       storeUMK(umk);
 
+      // Adding a device needs a recent login factor; the recovered UMK is one
+      // even if the passphrase prompt was left open past the step-up window
+      await stepUpWithUMK(umk, newDeviceContext.userId);
+
       const registrationResponse = await registerDevice(wrappedUMK);
       await cacheDeviceWrap({
         deviceId: registrationResponse.device_id,
@@ -395,6 +466,64 @@ export function LoginForm({ onLoginSuccess, onShowDebug }: LoginFormProps) {
 
   return (
     <div className="min-h-screen flex items-center justify-center bg-gray-100">
+      {isTOTPModalOpen && (
+        <div className="fixed inset-0 bg-black bg-opacity-40 flex items-center justify-center z-50 px-4">
+          <div className="bg-white rounded-lg shadow-lg w-full max-w-md p-6 space-y-4">
+            <div>
+              <h2 className="text-xl font-semibold text-gray-800">
+                Two-Factor Authentication
+              </h2>
+              <p className="text-sm text-gray-600 mt-2">
+                Enter the code from your authenticator app, or one of your
+                backup codes.
+              </p>
+            </div>
+
+            {totpError && (
+              <div className="text-red-600 text-sm">{totpError}</div>
+            )}
+
+            <form onSubmit={handleTOTPSubmit} className="space-y-4">
+              <div>
+                <label
+                  htmlFor={totpCodeId}
+                  className="block text-sm font-medium text-gray-700 mb-1"
+                >
+                  Code
+                </label>
+                <input
+                  type="text"
+                  id={totpCodeId}
+                  value={totpCode}
+                  onChange={(e) => setTOTPCode(e.target.value)}
+                  className="w-full px-3 py-2 border border-gray-300 rounded-md focus:outline-none focus:ring-2 focus:ring-blue-500"
+                  placeholder="123456"
+                  autoComplete="one-time-code"
+                  disabled={isLoading}
+                />
+              </div>
+              <div className="flex justify-end space-x-2">
+                <button
+                  type="button"
+                  onClick={handleTOTPModalClose}
+                  className="px-4 py-2 text-sm rounded-md border border-gray-300 text-gray-700 hover:bg-gray-50 disabled:opacity-50"
+                  disabled={isLoading}
+                >
+                  Cancel
+                </button>
+                <button
+                  type="submit"
+                  className="px-4 py-2 text-sm rounded-md bg-blue-600 text-white hover:bg-blue-700 disabled:bg-gray-400 disabled:cursor-not-allowed"
+                  disabled={isLoading}
+                >
+                  {isLoading ? "Verifying..." : "Verify"}
+                </button>
+              </div>
+            </form>
+          </div>
+        </div>
+      )}
+
       {isNewDeviceModalOpen && (
         <div className="fixed inset-0 bg-black bg-opacity-40 flex items-center justify-center z-50 px-4">
           <div className="bg-white rounded-lg shadow-lg w-full max-w-md p-6 space-y-4">
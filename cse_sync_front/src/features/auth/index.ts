@@ -3,6 +3,7 @@
 // API
 export {
   getDevice,
+  getRegistrationMode,
   getSession,
   login,
   logout,
@@ -19,5 +20,6 @@ export type {
   RegisterInitResponse,
   RegisterRequest,
   RegisterResponse,
+  RegistrationMode,
   SessionInfo,
 } from "./types/session";
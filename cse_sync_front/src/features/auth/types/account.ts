@@ -0,0 +1,33 @@
+export type AccountDeletionStatus =
+  | "scheduled"
+  | "canceled"
+  | "completed"
+  | "failed";
+
+export interface AccountPurgeCounts {
+  devices: number;
+  sessions: number;
+  messages: number;
+  passkeys: number;
+  access_tokens: number;
+}
+
+export interface AccountDeletion {
+  id: string;
+  user_id: string;
+  username: string;
+  status: AccountDeletionStatus;
+  requested_at: string;
+  purge_at: string;
+  canceled_at?: string;
+  completed_at?: string;
+  failed_at?: string;
+  error?: string;
+  purged?: AccountPurgeCounts;
+}
+
+export interface UsernameChangeResponse {
+  user_id: string;
+  username: string;
+  username_changed_at: string;
+}
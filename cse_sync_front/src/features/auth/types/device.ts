@@ -1,8 +1,17 @@
+export interface DeviceWrap {
+  version: number;
+  algorithm: string;
+  aad_scheme: string;
+  key_epoch: number;
+}
+
 export interface DeviceInfo {
   id: string;
   user_id: string;
   wrapped_umk: string;
+  wrap: DeviceWrap;
   created_at: string;
+  wrap_updated_at?: string;
 }
 
 export interface DeviceRegistrationResponse {
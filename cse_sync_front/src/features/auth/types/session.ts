@@ -3,26 +3,41 @@ import type { PassphraseRecoveryPayload } from "../../../shared/crypto/keyManage
 export interface SessionInfo {
   user_id: string;
   username: string;
+  mfa_required?: boolean;
+  registration_pending?: boolean;
+  csrf_token?: string;
 }
 
 export interface RegisterRequest {
   wrapped_umk: string;
   recovery: PassphraseRecoveryPayload;
+  umk_verifier: string;
 }
 
 export interface RegisterResponse {
   user_id: string;
   username: string;
   device_id: string;
+  csrf_token: string;
+}
+
+export type RegistrationMode = "open" | "invite" | "closed";
+
+export interface RegistrationModeResponse {
+  mode: RegistrationMode;
+  single_sign_on: boolean;
 }
 
 export interface RegisterInitRequest {
   username: string;
+  invite_token?: string;
 }
 
 export interface RegisterInitResponse {
   user_id: string;
   username: string;
+  expires_at: string;
+  csrf_token: string;
 }
 
 export interface LoginRequest {
@@ -37,4 +52,42 @@ export interface LoginResponse {
   device_verified: boolean;
   requires_device_registration: boolean;
   recovery_available: boolean;
+  recovery_codes_remaining: number;
+  mfa_required: boolean;
+  csrf_token: string;
+}
+
+export interface ActiveSession {
+  id: string;
+  device_id?: string;
+  ip_address: string;
+  user_agent: string;
+  created_at: string;
+  last_seen_at: string;
+  expires_at: string;
+  current: boolean;
+}
+
+export type StepUpMethod = "passkey" | "totp" | "umk";
+
+export interface StepUpStatus {
+  authenticated_at: string;
+  max_age_seconds: number;
+  methods: StepUpMethod[];
+}
+
+export interface StepUpBeginResponse {
+  method: StepUpMethod;
+  public_key?: Record<string, unknown>;
+  challenge_id?: string;
+  challenge?: string;
+  expires_at?: string;
+}
+
+export interface StepUpRequest {
+  method: StepUpMethod;
+  code?: string;
+  assertion?: unknown;
+  challenge_id?: string;
+  proof?: string;
 }
@@ -0,0 +1,12 @@
+export interface TOTPStatus {
+  enabled: boolean;
+  pending: boolean;
+  confirmed_at?: string;
+  backup_codes_remaining: number;
+}
+
+export interface TOTPEnrollment {
+  secret: string;
+  otpauth_uri: string;
+  expires_at: string;
+}
@@ -5,6 +5,7 @@ import {
   getCachedMessagesForUser,
   saveMessagesForUser,
 } from "../../../shared/db/indexedDB";
+import { csrfHeaders } from "../../../shared/storage/csrfToken";
 import { getSodium } from "../../../shared/utils";
 import { isActuallyOffline } from "../../../shared/utils/debugOffline";
 import type { SessionInfo } from "../../auth/types/session";
@@ -48,6 +49,7 @@ export async function sendMessage(
     method: "POST",
     headers: {
       "Content-Type": "application/json",
+      ...csrfHeaders(),
     },
     credentials: "include",
     body: JSON.stringify({
@@ -1,12 +1,40 @@
 import { API_BASE_URL } from "../../../shared/constants/api";
-import type { DebugInfo } from "../types/debug";
+import type { DebugInfo, DebugQuery } from "../types/debug";
 
-export async function getDebugInfo(): Promise<DebugInfo> {
-  const response = await fetch(`${API_BASE_URL}/debug`, {
+// The debug endpoint is only served in dev mode and takes the admin token
+export async function getDebugInfo(
+  adminToken: string,
+  query: DebugQuery = {},
+): Promise<DebugInfo> {
+  const params = new URLSearchParams();
+  if (query.userId) {
+    params.set("user_id", query.userId);
+  }
+  if (query.offset !== undefined) {
+    params.set("offset", query.offset.toString());
+  }
+  if (query.limit !== undefined) {
+    params.set("limit", query.limit.toString());
+  }
+
+  const response = await fetch(`${API_BASE_URL}/admin/debug?${params}`, {
     method: "GET",
+    headers: {
+      Authorization: `Bearer ${adminToken}`,
+    },
   });
 
   if (!response.ok) {
+    if (response.status === 401) {
+      throw new Error("Invalid admin token");
+    }
+    if (response.status === 404) {
+      throw new Error("Debug endpoint is disabled");
+    }
+    if (response.status === 400) {
+      const body = await response.json().catch(() => null);
+      throw new Error(body?.message ?? "Invalid debug query");
+    }
     throw new Error("Failed to fetch debug info");
   }
 
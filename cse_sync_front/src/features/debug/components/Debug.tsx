@@ -1,34 +1,53 @@
-import { useCallback, useEffect, useState } from "react";
+import { useCallback, useState } from "react";
 import { getDebugInfo } from "../api/debugApi";
 import type { DebugInfo } from "../types/debug";
 
+const PAGE_LIMIT = 20;
+
 interface DebugProps {
   onBack: () => void;
 }
 
 export function Debug({ onBack }: DebugProps) {
   const [debugInfo, setDebugInfo] = useState<DebugInfo | null>(null);
-  const [isLoading, setIsLoading] = useState(true);
+  const [isLoading, setIsLoading] = useState(false);
   const [error, setError] = useState("");
+  // Kept in memory only so the admin token never reaches storage
+  const [adminToken, setAdminToken] = useState("");
+  const [userFilter, setUserFilter] = useState("");
+  const [offset, setOffset] = useState(0);
 
-  const loadDebugInfo = useCallback(async () => {
-    setIsLoading(true);
-    setError("");
+  const loadDebugInfo = useCallback(
+    async (pageOffset: number) => {
+      if (!adminToken) {
+        setError("Enter the admin token to load debug information");
+        return;
+      }
 
-    try {
-      const info = await getDebugInfo();
-      setDebugInfo(info);
-    } catch (err) {
-      setError("Failed to load debug information");
-      console.error(err);
-    } finally {
-      setIsLoading(false);
-    }
-  }, []);
+      setIsLoading(true);
+      setError("");
 
-  useEffect(() => {
-    loadDebugInfo();
-  }, [loadDebugInfo]);
+      try {
+        const info = await getDebugInfo(adminToken, {
+          userId: userFilter.trim() || undefined,
+          offset: pageOffset,
+          limit: PAGE_LIMIT,
+        });
+        setDebugInfo(info);
+        setOffset(pageOffset);
+      } catch (err) {
+        setError(
+          err instanceof Error
+            ? err.message
+            : "Failed to load debug information",
+        );
+        console.error(err);
+      } finally {
+        setIsLoading(false);
+      }
+    },
+    [adminToken, userFilter],
+  );
 
   const formatDateTime = (dateStr: string) => {
     const date = new Date(dateStr);
@@ -47,7 +66,7 @@ export function Debug({ onBack }: DebugProps) {
           <div className="space-x-2">
             <button
               type="button"
-              onClick={loadDebugInfo}
+              onClick={() => loadDebugInfo(offset)}
               className="bg-blue-600 text-white px-4 py-2 rounded-md hover:bg-blue-700 transition-colors text-sm"
             >
               Reload
@@ -64,6 +83,36 @@ export function Debug({ onBack }: DebugProps) {
       </header>
 
       <main className="max-w-7xl mx-auto px-4 py-8 sm:px-6 lg:px-8">
+        <form
+          className="bg-white rounded-lg shadow p-4 mb-6 flex flex-wrap gap-2 items-center"
+          onSubmit={(e) => {
+            e.preventDefault();
+            loadDebugInfo(0);
+          }}
+        >
+          <input
+            type="password"
+            value={adminToken}
+            onChange={(e) => setAdminToken(e.target.value)}
+            placeholder="Admin token"
+            autoComplete="off"
+            className="border border-gray-300 rounded-md px-3 py-2 text-sm flex-1 min-w-48"
+          />
+          <input
+            type="text"
+            value={userFilter}
+            onChange={(e) => setUserFilter(e.target.value)}
+            placeholder="Filter by user ID"
+            className="border border-gray-300 rounded-md px-3 py-2 text-sm font-mono flex-1 min-w-48"
+          />
+          <button
+            type="submit"
+            className="bg-blue-600 text-white px-4 py-2 rounded-md hover:bg-blue-700 transition-colors text-sm"
+          >
+            Load
+          </button>
+        </form>
+
         {isLoading && (
           <div className="text-center text-gray-600">Loading...</div>
         )}
@@ -80,7 +129,7 @@ export function Debug({ onBack }: DebugProps) {
             <div className="bg-white rounded-lg shadow">
               <div className="px-6 py-4 border-b border-gray-200">
                 <h2 className="text-lg font-semibold text-gray-800">
-                  Users ({debugInfo.users.length})
+                  Users ({debugInfo.counts.users})
                 </h2>
               </div>
               <div className="overflow-x-auto">
@@ -113,27 +162,10 @@ export function Debug({ onBack }: DebugProps) {
                             {user.username}
                           </td>
                           <td className="px-6 py-4 text-sm text-gray-900">
-                            {user.recovery_wrapped_umk ? (
+                            {user.recovery_fingerprint ? (
                               <div className="font-mono text-xs space-y-1">
-                                <div>
-                                  Salt:{" "}
-                                  {user.recovery_salt
-                                    ? `${user.recovery_salt.substring(0, 12)}...`
-                                    : "N/A"}
-                                </div>
-                                <div>
-                                  IV:{" "}
-                                  {user.recovery_iv
-                                    ? `${user.recovery_iv.substring(0, 12)}...`
-                                    : "N/A"}
-                                </div>
-                                <div>
-                                  UMK:{" "}
-                                  {`${user.recovery_wrapped_umk.substring(
-                                    0,
-                                    20,
-                                  )}...`}
-                                </div>
+                                <div>Version: {user.recovery_version}</div>
+                                <div>{user.recovery_fingerprint}</div>
                               </div>
                             ) : (
                               <span className="text-gray-500">Not set</span>
@@ -151,7 +183,7 @@ export function Debug({ onBack }: DebugProps) {
             <div className="bg-white rounded-lg shadow">
               <div className="px-6 py-4 border-b border-gray-200">
                 <h2 className="text-lg font-semibold text-gray-800">
-                  Sessions ({debugInfo.sessions.length})
+                  Sessions ({debugInfo.counts.sessions})
                 </h2>
               </div>
               <div className="overflow-x-auto">
@@ -164,7 +196,7 @@ export function Debug({ onBack }: DebugProps) {
                     <thead className="bg-gray-50">
                       <tr>
                         <th className="px-6 py-3 text-left text-xs font-medium text-gray-500 uppercase tracking-wider">
-                          Session ID
+                          Session ID (Fingerprint)
                         </th>
                         <th className="px-6 py-3 text-left text-xs font-medium text-gray-500 uppercase tracking-wider">
                           User ID
@@ -182,9 +214,9 @@ export function Debug({ onBack }: DebugProps) {
                     </thead>
                     <tbody className="bg-white divide-y divide-gray-200">
                       {debugInfo.sessions.map((session) => (
-                        <tr key={session.id}>
+                        <tr key={session.id_fingerprint}>
                           <td className="px-6 py-4 whitespace-nowrap text-sm font-mono text-gray-900">
-                            {session.id}
+                            {session.id_fingerprint}
                           </td>
                           <td className="px-6 py-4 whitespace-nowrap text-sm font-mono text-gray-900">
                             {session.user_id}
@@ -218,11 +250,11 @@ export function Debug({ onBack }: DebugProps) {
             <div className="bg-white rounded-lg shadow">
               <div className="px-6 py-4 border-b border-gray-200">
                 <h2 className="text-lg font-semibold text-gray-800">
-                  Devices ({debugInfo.devices?.length || 0})
+                  Devices ({debugInfo.counts.devices})
                 </h2>
               </div>
               <div className="overflow-x-auto">
-                {!debugInfo.devices || debugInfo.devices.length === 0 ? (
+                {debugInfo.devices.length === 0 ? (
                   <p className="px-6 py-4 text-gray-500 text-sm">
                     No devices registered
                   </p>
@@ -237,7 +269,7 @@ export function Debug({ onBack }: DebugProps) {
                           User ID
                         </th>
                         <th className="px-6 py-3 text-left text-xs font-medium text-gray-500 uppercase tracking-wider">
-                          Wrapped UMK (Preview)
+                          Wrapped UMK (Fingerprint)
                         </th>
                         <th className="px-6 py-3 text-left text-xs font-medium text-gray-500 uppercase tracking-wider">
                           Created At
@@ -254,9 +286,7 @@ export function Debug({ onBack }: DebugProps) {
                             {device.user_id}
                           </td>
                           <td className="px-6 py-4 text-sm font-mono text-gray-900">
-                            <div className="max-w-xs truncate">
-                              {device.wrapped_umk?.substring(0, 40) || "N/A"}...
-                            </div>
+                            {device.wrapped_umk_fingerprint}
                           </td>
                           <td className="px-6 py-4 whitespace-nowrap text-sm text-gray-900">
                             {formatDateTime(device.created_at)}
@@ -273,11 +303,11 @@ export function Debug({ onBack }: DebugProps) {
             <div className="bg-white rounded-lg shadow">
               <div className="px-6 py-4 border-b border-gray-200">
                 <h2 className="text-lg font-semibold text-gray-800">
-                  Messages ({debugInfo.messages?.length || 0})
+                  Messages ({debugInfo.counts.messages})
                 </h2>
               </div>
               <div className="overflow-x-auto">
-                {!debugInfo.messages || debugInfo.messages.length === 0 ? (
+                {debugInfo.messages.length === 0 ? (
                   <p className="px-6 py-4 text-gray-500 text-sm">
                     No messages sent
                   </p>
@@ -292,10 +322,7 @@ export function Debug({ onBack }: DebugProps) {
                           User ID
                         </th>
                         <th className="px-6 py-3 text-left text-xs font-medium text-gray-500 uppercase tracking-wider">
-                          Encrypted Content (Preview)
-                        </th>
-                        <th className="px-6 py-3 text-left text-xs font-medium text-gray-500 uppercase tracking-wider">
-                          Nonce (Preview)
+                          Encrypted Size
                         </th>
                         <th className="px-6 py-3 text-left text-xs font-medium text-gray-500 uppercase tracking-wider">
                           Created At
@@ -311,17 +338,8 @@ export function Debug({ onBack }: DebugProps) {
                           <td className="px-6 py-4 whitespace-nowrap text-sm font-mono text-gray-900">
                             {message.user_id}
                           </td>
-                          <td className="px-6 py-4 text-sm font-mono text-gray-900">
-                            <div className="max-w-xs truncate">
-                              {message.encrypted_content?.substring(0, 40) ||
-                                "N/A"}
-                              ...
-                            </div>
-                          </td>
-                          <td className="px-6 py-4 text-sm font-mono text-gray-900">
-                            <div className="max-w-xs truncate">
-                              {message.nonce?.substring(0, 40) || "N/A"}...
-                            </div>
+                          <td className="px-6 py-4 whitespace-nowrap text-sm text-gray-900">
+                            {message.content_length} bytes
                           </td>
                           <td className="px-6 py-4 whitespace-nowrap text-sm text-gray-900">
                             {formatDateTime(message.created_at)}
@@ -333,6 +351,29 @@ export function Debug({ onBack }: DebugProps) {
                 )}
               </div>
             </div>
+
+            {/* Pagination */}
+            <div className="flex justify-between items-center text-sm text-gray-600">
+              <button
+                type="button"
+                onClick={() => loadDebugInfo(Math.max(offset - PAGE_LIMIT, 0))}
+                disabled={offset === 0 || isLoading}
+                className="bg-gray-600 text-white px-4 py-2 rounded-md hover:bg-gray-700 transition-colors disabled:opacity-50"
+              >
+                Previous
+              </button>
+              <span>
+                Page {Math.floor(debugInfo.offset / debugInfo.limit) + 1}
+              </span>
+              <button
+                type="button"
+                onClick={() => loadDebugInfo(offset + PAGE_LIMIT)}
+                disabled={!debugInfo.has_more || isLoading}
+                className="bg-gray-600 text-white px-4 py-2 rounded-md hover:bg-gray-700 transition-colors disabled:opacity-50"
+              >
+                Next
+              </button>
+            </div>
           </div>
         )}
       </main>
@@ -5,4 +5,9 @@ export { getDebugInfo } from "./api/debugApi";
 export { Debug } from "./components/Debug";
 
 // Types
-export type { DebugInfo, DebugSession, DebugUser } from "./types/debug";
+export type {
+  DebugInfo,
+  DebugQuery,
+  DebugSession,
+  DebugUser,
+} from "./types/debug";
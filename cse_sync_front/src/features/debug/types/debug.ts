@@ -1,36 +1,60 @@
 export interface DebugUser {
   id: string;
   username: string;
-  recovery_wrapped_umk?: string;
-  recovery_salt?: string;
-  recovery_iv?: string;
+  sso: boolean;
+  recovery_version?: number;
+  recovery_fingerprint?: string;
+  recovery_updated_at?: string;
 }
 
 export interface DebugSession {
-  id: string;
+  id_fingerprint: string;
   user_id: string;
+  device_id?: string;
+  mfa_pending?: boolean;
+  registration?: boolean;
+  decoy?: boolean;
   created_at: string;
+  last_seen_at: string;
   expires_at: string;
+  idle_expires_at: string;
+  authenticated_at: string;
 }
 
 export interface DebugDevice {
   id: string;
   user_id: string;
-  wrapped_umk: string;
+  wrapped_umk_fingerprint: string;
   created_at: string;
 }
 
 export interface DebugMessage {
   id: string;
   user_id: string;
-  encrypted_content: string;
-  nonce: string;
+  content_length: number;
   created_at: string;
 }
 
+export interface DebugCounts {
+  users: number;
+  sessions: number;
+  devices: number;
+  messages: number;
+}
+
 export interface DebugInfo {
+  offset: number;
+  limit: number;
+  has_more: boolean;
+  counts: DebugCounts;
   users: DebugUser[];
   sessions: DebugSession[];
   devices: DebugDevice[];
   messages: DebugMessage[];
 }
+
+export interface DebugQuery {
+  userId?: string;
+  offset?: number;
+  limit?: number;
+}
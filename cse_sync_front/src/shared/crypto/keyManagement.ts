@@ -8,14 +8,39 @@ const AES_GCM_ALGORITHM = "AES-GCM";
 const AES_GCM_IV_LENGTH = 12;
 
 const PASSPHRASE_SALT_LENGTH = 16;
-const PASSPHRASE_ITERATIONS = 310000;
+const PASSPHRASE_ITERATIONS = 600000;
 const PASSPHRASE_KEY_LENGTH = 256;
 const PASSPHRASE_HASH = "SHA-256";
 
+const UMK_VERIFIER_INFO = "cse-sync umk-verifier v1";
+const UMK_VERIFIER_BITS = 256;
+
+const KDF_ALGORITHM_PBKDF2_SHA256 = "pbkdf2-sha256";
+const KDF_DESCRIPTOR_VERSION = 1;
+
+export interface KDFDescriptor {
+  algorithm: string;
+  iterations: number;
+  memory_kib?: number;
+  parallelism?: number;
+  version: number;
+}
+
+// Payloads stored before descriptors existed were derived with these parameters
+const LEGACY_KDF: KDFDescriptor = {
+  algorithm: KDF_ALGORITHM_PBKDF2_SHA256,
+  iterations: 310000,
+  version: KDF_DESCRIPTOR_VERSION,
+};
+
 export interface PassphraseRecoveryPayload {
   wrapped_umk: string;
   salt: string;
   iv: string;
+  kdf?: KDFDescriptor;
+  version?: number;
+  kdf_upgrade_required?: boolean;
+  recommended_kdf?: KDFDescriptor;
 }
 
 let storedUMK: Uint8Array | null = null;
@@ -103,14 +128,49 @@ export function clearStoredUMK(): void {
   console.log("Stored UMK cleared from memory");
 }
 
+// The server keeps this key to check UMK possession: clients prove it by
+// MACing server challenges, so it must not reveal the UMK itself
+export async function deriveUMKVerifier(umk: Uint8Array): Promise<string> {
+  return bytesToBase64(await deriveUMKVerifierBytes(umk));
+}
+
+// Answers a UMK challenge (step-up or recovery change):
+// base64(HMAC-SHA256(verifier, challenge || user_id))
+export async function signUMKChallenge(
+  umk: Uint8Array,
+  challenge: string,
+  userId: string,
+): Promise<string> {
+  const macKey = await crypto.subtle.importKey(
+    "raw",
+    await deriveUMKVerifierBytes(umk),
+    { name: "HMAC", hash: "SHA-256" },
+    false,
+    ["sign"],
+  );
+
+  const mac = await crypto.subtle.sign(
+    "HMAC",
+    macKey,
+    concatBytes(base64ToBytes(challenge), textEncoder.encode(userId)),
+  );
+
+  return bytesToBase64(new Uint8Array(mac));
+}
+
 export async function createPassphraseRecoveryPayload(
   passphrase: string,
   umk: Uint8Array,
 ): Promise<PassphraseRecoveryPayload> {
   const salt = randomBytes(PASSPHRASE_SALT_LENGTH);
   const iv = randomBytes(AES_GCM_IV_LENGTH);
+  const kdf: KDFDescriptor = {
+    algorithm: KDF_ALGORITHM_PBKDF2_SHA256,
+    iterations: PASSPHRASE_ITERATIONS,
+    version: KDF_DESCRIPTOR_VERSION,
+  };
 
-  const passphraseKey = await derivePassphraseKey(passphrase, salt);
+  const passphraseKey = await derivePassphraseKey(passphrase, salt, kdf);
   const encrypted = await crypto.subtle.encrypt(
     {
       name: AES_GCM_ALGORITHM,
@@ -124,6 +184,7 @@ export async function createPassphraseRecoveryPayload(
     wrapped_umk: bytesToBase64(new Uint8Array(encrypted)),
     salt: bytesToBase64(salt),
     iv: bytesToBase64(iv),
+    kdf,
   };
 }
 
@@ -135,7 +196,11 @@ export async function recoverUMKWithPassphrase(
   const iv = base64ToBytes(payload.iv);
   const encrypted = base64ToBytes(payload.wrapped_umk);
 
-  const passphraseKey = await derivePassphraseKey(passphrase, salt);
+  const passphraseKey = await derivePassphraseKey(
+    passphrase,
+    salt,
+    payload.kdf ?? LEGACY_KDF,
+  );
   const decrypted = await crypto.subtle.decrypt(
     {
       name: AES_GCM_ALGORITHM,
@@ -148,6 +213,25 @@ export async function recoverUMKWithPassphrase(
   return new Uint8Array(decrypted);
 }
 
+async function deriveUMKVerifierBytes(umk: Uint8Array): Promise<Uint8Array> {
+  const baseKey = await crypto.subtle.importKey("raw", umk, "HKDF", false, [
+    "deriveBits",
+  ]);
+
+  const bits = await crypto.subtle.deriveBits(
+    {
+      name: "HKDF",
+      hash: "SHA-256",
+      salt: new Uint8Array(),
+      info: textEncoder.encode(UMK_VERIFIER_INFO),
+    },
+    baseKey,
+    UMK_VERIFIER_BITS,
+  );
+
+  return new Uint8Array(bits);
+}
+
 async function importAesKey(
   keyMaterial: Uint8Array,
   extractable: boolean,
@@ -164,7 +248,15 @@ async function importAesKey(
 async function derivePassphraseKey(
   passphrase: string,
   salt: Uint8Array,
+  kdf: KDFDescriptor,
 ): Promise<CryptoKey> {
+  if (
+    kdf.algorithm !== KDF_ALGORITHM_PBKDF2_SHA256 ||
+    kdf.version !== KDF_DESCRIPTOR_VERSION
+  ) {
+    throw new Error(`Unsupported passphrase KDF: ${kdf.algorithm}`);
+  }
+
   const baseKey = await crypto.subtle.importKey(
     "raw",
     textEncoder.encode(passphrase),
@@ -179,7 +271,7 @@ async function derivePassphraseKey(
     {
       name: "PBKDF2",
       salt,
-      iterations: PASSPHRASE_ITERATIONS,
+      iterations: kdf.iterations,
       hash: PASSPHRASE_HASH,
     },
     baseKey,
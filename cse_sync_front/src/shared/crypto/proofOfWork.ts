@@ -0,0 +1,66 @@
+import { API_BASE_URL } from "../constants/api";
+
+const POW_CHALLENGE_HEADER = "X-PoW-Challenge";
+const POW_NONCE_HEADER = "X-PoW-Nonce";
+const POW_ALGORITHM = "sha256";
+
+const textEncoder = new TextEncoder();
+
+interface PoWChallenge {
+  id: string;
+  algorithm: string;
+  seed: string;
+  difficulty: number;
+  expires_at: string;
+}
+
+function leadingZeroBits(digest: Uint8Array): number {
+  let count = 0;
+  for (const byte of digest) {
+    if (byte !== 0) {
+      return count + Math.clz32(byte) - 24;
+    }
+    count += 8;
+  }
+  return count;
+}
+
+// Finds a nonce such that SHA-256(seed + ":" + nonce) starts with
+// difficulty zero bits
+async function solveChallenge(challenge: PoWChallenge): Promise<string> {
+  for (let nonce = 0; ; nonce++) {
+    const digest = await crypto.subtle.digest(
+      "SHA-256",
+      textEncoder.encode(`${challenge.seed}:${nonce}`),
+    );
+    if (leadingZeroBits(new Uint8Array(digest)) >= challenge.difficulty) {
+      return nonce.toString();
+    }
+  }
+}
+
+// Fetches and solves a fresh challenge; the headers answer it once and
+// must be requested again for every guarded call
+export async function proofOfWorkHeaders(): Promise<Record<string, string>> {
+  const response = await fetch(`${API_BASE_URL}/pow/challenge`, {
+    method: "POST",
+    credentials: "include",
+  });
+
+  if (!response.ok) {
+    throw new Error("Failed to get proof-of-work challenge");
+  }
+
+  const challenge: PoWChallenge = await response.json();
+  if (challenge.algorithm !== POW_ALGORITHM) {
+    throw new Error(
+      `Unsupported proof-of-work algorithm: ${challenge.algorithm}`,
+    );
+  }
+
+  const nonce = await solveChallenge(challenge);
+  return {
+    [POW_CHALLENGE_HEADER]: challenge.id,
+    [POW_NONCE_HEADER]: nonce,
+  };
+}
@@ -0,0 +1,13 @@
+const CSRF_TOKEN_HEADER = "X-CSRF-Token";
+
+// Issued alongside the session and kept in memory only;
+// App restores it through getSession after a reload.
+let csrfToken: string | null = null;
+
+export function setCSRFToken(token: string | null | undefined): void {
+  csrfToken = token ?? null;
+}
+
+export function csrfHeaders(): Record<string, string> {
+  return csrfToken ? { [CSRF_TOKEN_HEADER]: csrfToken } : {};
+}